@@ -1,11 +1,19 @@
 package app
 
 import (
+	"errors"
+	"time"
+
 	"github.com/urfave/cli/v2"
 	"go.uber.org/fx"
 
 	"github.com/lambda-feedback/shimmy/config"
+	"github.com/lambda-feedback/shimmy/handler"
+	"github.com/lambda-feedback/shimmy/internal/auth"
+	"github.com/lambda-feedback/shimmy/internal/metrics"
+	"github.com/lambda-feedback/shimmy/internal/ratelimit"
 	"github.com/lambda-feedback/shimmy/internal/shell"
+	"github.com/lambda-feedback/shimmy/internal/tracing"
 	"github.com/lambda-feedback/shimmy/runtime"
 	"github.com/lambda-feedback/shimmy/util/conf"
 	"github.com/lambda-feedback/shimmy/util/logging"
@@ -28,9 +36,69 @@ func New(ctx *cli.Context) (*shell.Shell, error) {
 		// provide global config
 		fx.Supply(config),
 
-		// provide runtime module
-		runtime.Module(config.Runtime),
+		// provide metrics
+		fx.Provide(metrics.New),
+
+		// export traces, if enabled
+		tracing.Module(config.Tracing),
+
+		// provide api keys
+		auth.Module(config.Auth),
+
+		// limit the rate of requests, if enabled
+		ratelimit.Module(config.RateLimit),
+
+		// provide runtime and handlers
+		functionModule(config),
 	)
 
-	return shell.New(log, appModule), nil
+	// allow in-flight requests to drain, and workers to stop
+	stopTimeoutOption := fx.StopTimeout(stopTimeout(config))
+
+	return shell.New(log, appModule, stopTimeoutOption), nil
+}
+
+// functionModule provides the runtime and handlers for a single function,
+// or for each function if multiple functions are declared.
+func functionModule(config config.Config) fx.Option {
+	if len(config.Functions) > 0 {
+		// shadow traffic is configured for the single function only
+		if config.Shadow.Enabled() {
+			return fx.Error(errors.New("shadow traffic is not supported with multiple functions"))
+		}
+
+		return fx.Options(
+			runtime.FunctionsModule(config.Functions),
+			handler.FunctionsModule(),
+		)
+	}
+
+	return fx.Options(
+		runtime.Module(config.Runtime, config.Shadow),
+		handler.Module(),
+	)
+}
+
+// stopTimeout returns the timeout for stopping the application, which
+// covers draining in-flight requests and stopping the workers. Multiple
+// functions are stopped concurrently.
+func stopTimeout(config config.Config) time.Duration {
+	timeout := runtimeStopTimeout(config.Runtime)
+
+	// the shadow version is stopped after the primary version
+	if config.Shadow.Enabled() {
+		timeout += config.Runtime.Supervisor.StopParams.Timeout
+	}
+
+	for _, fn := range config.Functions {
+		timeout = max(timeout, runtimeStopTimeout(fn))
+	}
+
+	// leave some time for the remaining components to stop
+	return max(timeout+5*time.Second, fx.DefaultTimeout)
+}
+
+// runtimeStopTimeout returns the time to drain and stop a runtime.
+func runtimeStopTimeout(config runtime.Config) time.Duration {
+	return config.DrainTimeout + config.Supervisor.StopParams.Timeout
 }
@@ -24,6 +24,9 @@ type LambdaHandlerParams struct {
 	// Handlers is a slice of HTTP handlers grouped together.
 	Handlers []*server.HttpHandler `group:"handlers"`
 
+	// Middlewares wrap the HTTP handlers.
+	Middlewares []server.Middleware `group:"middlewares"`
+
 	// Context is the context for the Lambda handler.
 	Context context.Context
 
@@ -44,11 +47,7 @@ type LambdaHandler struct {
 func NewLambdaHandler(params LambdaHandlerParams) *LambdaHandler {
 	ctx, cancel := context.WithCancel(params.Context)
 
-	mux := http.NewServeMux()
-
-	for _, handler := range params.Handlers {
-		mux.Handle(handler.Name, handler.Handler)
-	}
+	mux := server.NewServeMux(params.Handlers, params.Middlewares)
 
 	return &LambdaHandler{
 		config: params.Config,
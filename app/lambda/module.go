@@ -3,7 +3,6 @@ package lambda
 import (
 	"go.uber.org/fx"
 
-	"github.com/lambda-feedback/shimmy/handler"
 	"github.com/lambda-feedback/shimmy/util/logging"
 )
 
@@ -14,8 +13,6 @@ func Module(config Config) fx.Option {
 		fx.Supply(config),
 		// rename logger for module
 		logging.DecorateLogger("lambda"),
-		// provide handlers
-		handler.Module(),
 		// provide server
 		fx.Provide(NewLifecycleHandler),
 		// invoke server
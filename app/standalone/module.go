@@ -3,7 +3,6 @@ package standalone
 import (
 	"go.uber.org/fx"
 
-	"github.com/lambda-feedback/shimmy/handler"
 	"github.com/lambda-feedback/shimmy/internal/server"
 	"github.com/lambda-feedback/shimmy/util/logging"
 )
@@ -13,8 +12,6 @@ func Module(config Config) fx.Option {
 		"serve",
 		// rename logger for module
 		logging.DecorateLogger("serve"),
-		// provide handlers
-		handler.Module(),
 		// provide server
 		server.Module(config.HttpConfig),
 	)
@@ -2,14 +2,17 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
+	"regexp"
 	"time"
 
 	"github.com/urfave/cli/v2"
 	"go.uber.org/zap"
 
 	"github.com/lambda-feedback/shimmy/config"
+	"github.com/lambda-feedback/shimmy/runtime"
 	"github.com/lambda-feedback/shimmy/util/conf"
 	"github.com/lambda-feedback/shimmy/util/logging"
 )
@@ -36,6 +39,11 @@ functions on arbitrary, serverless platforms.`
 				Usage:   "set the log format. Options: production, development.",
 				EnvVars: []string{"LOG_FORMAT"},
 			},
+			&cli.PathFlag{
+				Name:    "config",
+				Usage:   "the path to a json config file, e.g. declaring multiple functions. Flags and env vars take precedence.",
+				EnvVars: []string{"CONFIG_FILE"},
+			},
 			// auth flags
 			&cli.StringFlag{
 				Name:     "auth-key",
@@ -43,6 +51,84 @@ functions on arbitrary, serverless platforms.`
 				Category: "auth",
 				EnvVars:  []string{"AUTH_KEY"},
 			},
+			&cli.PathFlag{
+				Name:     "auth-keys-file",
+				Usage:    "the path to a json file holding a list of labelled keys, accepted in addition to the auth key. The file is re-read when it changes.",
+				Category: "auth",
+				EnvVars:  []string{"AUTH_KEYS_FILE"},
+			},
+			&cli.DurationFlag{
+				Name:     "auth-keys-reload-interval",
+				Usage:    "the interval to check the keys file and the token keys for changes.",
+				Value:    10 * time.Second,
+				Category: "auth",
+				EnvVars:  []string{"AUTH_KEYS_RELOAD_INTERVAL"},
+			},
+			&cli.PathFlag{
+				Name:     "auth-jwks-file",
+				Usage:    "the path to a JSON Web Key Set to verify bearer tokens against. The file is re-read when it changes.",
+				Category: "auth",
+				EnvVars:  []string{"AUTH_JWKS_FILE"},
+			},
+			&cli.PathFlag{
+				Name:     "auth-jwt-public-key-file",
+				Usage:    "the path to a PEM encoded public key or certificate to verify bearer tokens against, as an alternative to a JWKS file.",
+				Category: "auth",
+				EnvVars:  []string{"AUTH_JWT_PUBLIC_KEY_FILE"},
+			},
+			&cli.StringFlag{
+				Name:     "auth-jwt-issuer",
+				Usage:    "the expected issuer of bearer tokens.",
+				Category: "auth",
+				EnvVars:  []string{"AUTH_JWT_ISSUER"},
+			},
+			&cli.StringFlag{
+				Name:     "auth-jwt-audience",
+				Usage:    "the expected audience of bearer tokens.",
+				Category: "auth",
+				EnvVars:  []string{"AUTH_JWT_AUDIENCE"},
+			},
+			&cli.DurationFlag{
+				Name:     "auth-jwt-clock-skew",
+				Usage:    "the tolerated clock skew when checking the expiry of bearer tokens.",
+				Value:    30 * time.Second,
+				Category: "auth",
+				EnvVars:  []string{"AUTH_JWT_CLOCK_SKEW"},
+			},
+			&cli.StringFlag{
+				Name:     "auth-jwt-tenant-claim",
+				Usage:    "the claim of bearer tokens holding the tenant.",
+				Value:    "tenant",
+				Category: "auth",
+				EnvVars:  []string{"AUTH_JWT_TENANT_CLAIM"},
+			},
+			&cli.StringFlag{
+				Name:     "auth-jwt-user-claim",
+				Usage:    "the claim of bearer tokens holding the user.",
+				Value:    "sub",
+				Category: "auth",
+				EnvVars:  []string{"AUTH_JWT_USER_CLAIM"},
+			},
+			&cli.StringFlag{
+				Name:     "auth-hmac-secret",
+				Usage:    "the secret shared with callers signing their requests, accepted as an alternative to the auth key.",
+				Category: "auth",
+				EnvVars:  []string{"AUTH_HMAC_SECRET"},
+			},
+			&cli.DurationFlag{
+				Name:     "auth-hmac-window",
+				Usage:    "the duration a signed request is valid for, before and after its timestamp.",
+				Value:    5 * time.Minute,
+				Category: "auth",
+				EnvVars:  []string{"AUTH_HMAC_WINDOW"},
+			},
+			&cli.BoolFlag{
+				Name:     "auth-hmac-sign-responses",
+				Usage:    "sign the responses to signed requests, so callers can verify them.",
+				Value:    false,
+				Category: "auth",
+				EnvVars:  []string{"AUTH_HMAC_SIGN_RESPONSES"},
+			},
 			// shim flags
 			&cli.StringFlag{
 				Name:     "interface",
@@ -52,13 +138,19 @@ functions on arbitrary, serverless platforms.`
 				Category: "function",
 				EnvVars:  []string{"FUNCTION_INTERFACE"},
 			},
+			&cli.StringFlag{
+				Name:     "encoding",
+				Usage:    "the encoding of messages exchanged with the worker process. Options: json, msgpack, cbor.",
+				Value:    "json",
+				Category: "function",
+				EnvVars:  []string{"FUNCTION_ENCODING"},
+			},
 			&cli.StringFlag{
 				Name:     "command",
 				Aliases:  []string{"c"},
-				Usage:    "the command to invoke to start the worker process.",
+				Usage:    "the command to invoke to start the worker process. Required, unless attaching to endpoints.",
 				Category: "function",
 				EnvVars:  []string{"FUNCTION_COMMAND"},
-				Required: true,
 			},
 			&cli.StringFlag{
 				Name:     "cwd",
@@ -90,6 +182,119 @@ functions on arbitrary, serverless platforms.`
 				Category:    "function",
 				EnvVars:     []string{"FUNCTION_MAX_PROCS"},
 			},
+			&cli.IntFlag{
+				Name:     "min-idle-workers",
+				Usage:    "the number of idle worker processes to keep started.",
+				Value:    0,
+				Category: "function",
+				EnvVars:  []string{"FUNCTION_MIN_IDLE_WORKERS"},
+			},
+			&cli.BoolFlag{
+				Name:     "autoscale",
+				Usage:    "scale the number of worker processes between --autoscale-min-workers and --max-workers, based on the time requests wait for a worker.",
+				Value:    false,
+				Category: "autoscale",
+				EnvVars:  []string{"FUNCTION_AUTOSCALE"},
+			},
+			&cli.IntFlag{
+				Name:     "autoscale-min-workers",
+				Usage:    "the minimum number of worker processes when autoscaling.",
+				Value:    1,
+				Category: "autoscale",
+				EnvVars:  []string{"FUNCTION_AUTOSCALE_MIN_WORKERS"},
+			},
+			&cli.DurationFlag{
+				Name:     "autoscale-target-wait",
+				Usage:    "the time requests may wait for a worker. More workers are started while the 90th percentile of the wait exceeds the target.",
+				Value:    50 * time.Millisecond,
+				Category: "autoscale",
+				EnvVars:  []string{"FUNCTION_AUTOSCALE_TARGET_WAIT"},
+			},
+			&cli.DurationFlag{
+				Name:     "autoscale-idle-timeout",
+				Usage:    "the duration after which idle worker processes are stopped when autoscaling.",
+				Value:    time.Minute,
+				Category: "autoscale",
+				EnvVars:  []string{"FUNCTION_AUTOSCALE_IDLE_TIMEOUT"},
+			},
+			&cli.DurationFlag{
+				Name:     "autoscale-interval",
+				Usage:    "the interval between two scaling decisions.",
+				Value:    5 * time.Second,
+				Category: "autoscale",
+				EnvVars:  []string{"FUNCTION_AUTOSCALE_INTERVAL"},
+			},
+			&cli.IntFlag{
+				Name:        "autoscale-memory-budget",
+				Usage:       "the resident memory all worker processes may use in MiB, based on the observed memory per worker. Only supported on linux.",
+				DefaultText: "unlimited",
+				Value:       0,
+				Category:    "autoscale",
+				EnvVars:     []string{"FUNCTION_AUTOSCALE_MEMORY_BUDGET"},
+			},
+			&cli.IntFlag{
+				Name:        "queue-max-length",
+				Usage:       "the maximum number of requests waiting for a worker. Excess requests are rejected with 503.",
+				DefaultText: "unlimited",
+				Value:       0,
+				Category:    "queue",
+				EnvVars:     []string{"FUNCTION_QUEUE_MAX_LENGTH"},
+			},
+			&cli.DurationFlag{
+				Name:        "queue-max-wait",
+				Usage:       "the maximum time a request waits for a worker, before it is rejected with 503.",
+				DefaultText: "unlimited",
+				Value:       0,
+				Category:    "queue",
+				EnvVars:     []string{"FUNCTION_QUEUE_MAX_WAIT"},
+			},
+			&cli.StringSliceFlag{
+				Name:     "queue-priority",
+				Usage:    "the weight of a command when workers are busy, as command=weight, e.g. eval=10. May be repeated. Default weight is 1.",
+				Category: "queue",
+				EnvVars:  []string{"FUNCTION_QUEUE_PRIORITIES"},
+			},
+			&cli.StringFlag{
+				Name:     "queue-tenant-header",
+				Usage:    "the request header identifying the tenant of a request, to queue requests of different tenants fairly.",
+				Category: "queue",
+				EnvVars:  []string{"FUNCTION_QUEUE_TENANT_HEADER"},
+			},
+			&cli.StringSliceFlag{
+				Name:     "queue-tenant-weight",
+				Usage:    "the weight of a tenant when workers are busy, as tenant=weight. May be repeated. Default weight is 1.",
+				Category: "queue",
+				EnvVars:  []string{"FUNCTION_QUEUE_TENANT_WEIGHTS"},
+			},
+			&cli.IntFlag{
+				Name:        "breaker-threshold",
+				Usage:       "the number of consecutive worker failures after which requests are rejected with 503, until a probe request succeeds.",
+				DefaultText: "disabled",
+				Value:       0,
+				Category:    "worker",
+				EnvVars:     []string{"FUNCTION_BREAKER_THRESHOLD"},
+			},
+			&cli.DurationFlag{
+				Name:     "breaker-cooldown",
+				Usage:    "the duration requests are rejected after the circuit breaker opened, before a single request probes the worker.",
+				Value:    30 * time.Second,
+				Category: "worker",
+				EnvVars:  []string{"FUNCTION_BREAKER_COOLDOWN"},
+			},
+			&cli.BoolFlag{
+				Name:     "prewarm",
+				Usage:    "start the idle worker processes on startup, and report readiness once they are started.",
+				Value:    false,
+				Category: "function",
+				EnvVars:  []string{"FUNCTION_PREWARM"},
+			},
+			&cli.DurationFlag{
+				Name:     "drain-timeout",
+				Usage:    "the duration to wait for in-flight requests to finish on shutdown, before they are aborted.",
+				Value:    10 * time.Second,
+				Category: "worker",
+				EnvVars:  []string{"FUNCTION_DRAIN_TIMEOUT"},
+			},
 			&cli.DurationFlag{
 				Name:     "worker-stop-timeout",
 				Usage:    "the duration to wait for a worker process to stop.",
@@ -104,6 +309,13 @@ functions on arbitrary, serverless platforms.`
 				Category: "worker",
 				EnvVars:  []string{"FUNCTION_WORKER_SEND_TIMEOUT"},
 			},
+			&cli.IntFlag{
+				Name:     "worker-max-concurrency",
+				Usage:    "the maximum number of concurrent messages sent to a single persistent worker or attach endpoint.",
+				Value:    1,
+				Category: "worker",
+				EnvVars:  []string{"FUNCTION_WORKER_MAX_CONCURRENCY"},
+			},
 			&cli.StringFlag{
 				Name:     "rpc-transport",
 				Aliases:  []string{"t"},
@@ -112,6 +324,24 @@ functions on arbitrary, serverless platforms.`
 				EnvVars:  []string{"FUNCTION_RPC_TRANSPORT"},
 				Category: "rpc",
 			},
+			&cli.Int64Flag{
+				Name:     "rpc-transport-stdio-max-message-size",
+				Usage:    "the maximum size of a single message in bytes for the stdio transport. Default: 64 MiB",
+				EnvVars:  []string{"FUNCTION_RPC_TRANSPORT_STDIO_MAX_MESSAGE_SIZE"},
+				Category: "rpc",
+			},
+			&cli.BoolFlag{
+				Name:     "rpc-initialize",
+				Usage:    "perform the capability handshake with the worker after connecting.",
+				EnvVars:  []string{"FUNCTION_RPC_INITIALIZE"},
+				Category: "rpc",
+			},
+			&cli.BoolFlag{
+				Name:     "rpc-notifications",
+				Usage:    "enable progress and log notifications from the worker.",
+				EnvVars:  []string{"FUNCTION_RPC_NOTIFICATIONS"},
+				Category: "rpc",
+			},
 			&cli.StringFlag{
 				Name:     "rpc-transport-ipc-endpoint",
 				Usage:    "the IPC endpoint to use for the IPC transport. Default: /tmp/eval.sock",
@@ -139,6 +369,141 @@ functions on arbitrary, serverless platforms.`
 				Value:    "127.0.0.1:7321",
 				Category: "rpc",
 			},
+			&cli.BoolFlag{
+				Name:     "rpc-allocate-endpoint",
+				Usage:    "allocate a free port or unique socket path for each worker, instead of the configured endpoint.",
+				EnvVars:  []string{"FUNCTION_RPC_ALLOCATE_ENDPOINT"},
+				Category: "rpc",
+			},
+			&cli.StringSliceFlag{
+				Name:     "rpc-attach-endpoint",
+				Usage:    "attach to an externally managed worker at the given endpoint, instead of spawning a worker process. May be repeated.",
+				EnvVars:  []string{"FUNCTION_RPC_ATTACH_ENDPOINTS"},
+				Category: "rpc",
+			},
+			&cli.StringFlag{
+				Name:     "rpc-attach-balancing",
+				Usage:    "the strategy to balance messages across attached endpoints. Options: round_robin, least_inflight.",
+				Value:    "round_robin",
+				EnvVars:  []string{"FUNCTION_RPC_ATTACH_BALANCING"},
+				Category: "rpc",
+			},
+			&cli.DurationFlag{
+				Name:     "rpc-attach-health-check-interval",
+				Usage:    "the interval between health checks of attached endpoints.",
+				Value:    10 * time.Second,
+				EnvVars:  []string{"FUNCTION_RPC_ATTACH_HEALTH_CHECK_INTERVAL"},
+				Category: "rpc",
+			},
+			&cli.StringFlag{
+				Name:     "rpc-attach-health-check-method",
+				Usage:    "the rpc method to call on attached endpoints during health checks.",
+				EnvVars:  []string{"FUNCTION_RPC_ATTACH_HEALTH_CHECK_METHOD"},
+				Category: "rpc",
+			},
+			&cli.StringFlag{
+				Name:        "file-scratch-dir",
+				Usage:       "the base directory for per-request scratch directories of the file interface.",
+				DefaultText: "$TMPDIR/shimmy",
+				EnvVars:     []string{"FUNCTION_FILE_SCRATCH_DIR"},
+				Category:    "file",
+			},
+			&cli.BoolFlag{
+				Name:     "file-keep-failed",
+				Usage:    "keep the scratch directories of failed requests for debugging.",
+				EnvVars:  []string{"FUNCTION_FILE_KEEP_FAILED"},
+				Category: "file",
+			},
+			&cli.DurationFlag{
+				Name:     "file-keep-failed-ttl",
+				Usage:    "the duration to keep the scratch directories of failed requests.",
+				Value:    time.Hour,
+				EnvVars:  []string{"FUNCTION_FILE_KEEP_FAILED_TTL"},
+				Category: "file",
+			},
+			&cli.StringFlag{
+				Name:     "shadow-command",
+				Usage:    "the command to invoke to start a shadow version of the function, which handles a sample of the requests to compare its results.",
+				Category: "shadow",
+				EnvVars:  []string{"SHADOW_COMMAND"},
+			},
+			&cli.StringFlag{
+				Name:        "shadow-cwd",
+				Usage:       "the working directory for the shadow worker process.",
+				DefaultText: "the working directory of the function",
+				Category:    "shadow",
+				EnvVars:     []string{"SHADOW_WORKING_DIR"},
+			},
+			&cli.StringSliceFlag{
+				Name:     "shadow-arg",
+				Usage:    "additional arguments for the shadow worker process.",
+				Category: "shadow",
+				EnvVars:  []string{"SHADOW_ARGS"},
+			},
+			&cli.StringSliceFlag{
+				Name:     "shadow-env",
+				Usage:    "additional environment variables for the shadow worker process, added to those of the function.",
+				Category: "shadow",
+				EnvVars:  []string{"SHADOW_ENV"},
+			},
+			&cli.Float64Flag{
+				Name:        "shadow-sample-rate",
+				Usage:       "the fraction of requests sent to the shadow version, between 0 and 1.",
+				DefaultText: "disabled",
+				Value:       0,
+				Category:    "shadow",
+				EnvVars:     []string{"SHADOW_SAMPLE_RATE"},
+			},
+			&cli.DurationFlag{
+				Name:     "shadow-timeout",
+				Usage:    "the duration a shadow request may take.",
+				Value:    30 * time.Second,
+				Category: "shadow",
+				EnvVars:  []string{"SHADOW_TIMEOUT"},
+			},
+			&cli.StringFlag{
+				Name:     "tracing-exporter",
+				Usage:    "the destination traces are exported to. Options: none, stdout, otlp.",
+				Value:    "none",
+				Category: "tracing",
+				EnvVars:  []string{"TRACING_EXPORTER"},
+			},
+			&cli.StringFlag{
+				Name:        "tracing-endpoint",
+				Usage:       "the URL of the OTLP collector traces are sent to, e.g. http://localhost:4318.",
+				DefaultText: "read from the OTEL_EXPORTER_OTLP_* env variables",
+				Category:    "tracing",
+				EnvVars:     []string{"TRACING_ENDPOINT"},
+			},
+			&cli.Float64Flag{
+				Name:     "tracing-sample-ratio",
+				Usage:    "the fraction of traces started by the shim that are recorded, between 0 and 1. Traces continued from a client follow its sampling decision.",
+				Value:    1,
+				Category: "tracing",
+				EnvVars:  []string{"TRACING_SAMPLE_RATIO"},
+			},
+			// rate limit flags
+			&cli.Float64Flag{
+				Name:        "rate-limit",
+				Usage:       "the number of requests per second each client may send on average, across commands without a limit of their own. Clients are identified by their token subject, key label or IP address.",
+				DefaultText: "disabled",
+				Value:       0,
+				Category:    "rate limit",
+				EnvVars:     []string{"RATE_LIMIT"},
+			},
+			&cli.IntFlag{
+				Name:        "rate-limit-burst",
+				Usage:       "the number of requests each client may send at once, before being limited to the rate limit.",
+				DefaultText: "the rate limit",
+				Category:    "rate limit",
+				EnvVars:     []string{"RATE_LIMIT_BURST"},
+			},
+			&cli.StringSliceFlag{
+				Name:     "rate-limit-command",
+				Usage:    "the rate limit of a command, as command=rate or command=rate:burst. May be repeated.",
+				Category: "rate limit",
+				EnvVars:  []string{"RATE_LIMIT_COMMANDS"},
+			},
 		},
 		Before: func(ctx *cli.Context) error {
 			// create the logger
@@ -249,30 +614,134 @@ func parseRootConfig(ctx *cli.Context) (config.Config, error) {
 
 	// map cli flags to config fields
 	cliMap := map[string]string{
-		"auth-key":                   "auth.key",
-		"max-workers":                "runtime.max_workers",
-		"command":                    "runtime.cmd",
-		"cwd":                        "runtime.cwd",
-		"arg":                        "runtime.arg",
-		"env":                        "runtime.env",
-		"interface":                  "runtime.io.interface",
-		"rpc-transport":              "runtime.io.rpc.transport",
-		"rpc-transport-ipc-endpoint": "runtime.io.rpc.ipc.endpoint",
-		"rpc-transport-http-url":     "runtime.io.rpc.http.url",
-		"rpc-transport-ws-url":       "runtime.io.rpc.ws.url",
-		"rpc-transport-tcp-address":  "runtime.io.rpc.tcp.address",
-		"worker-send-timeout":        "runtime.send.timeout",
-		"worker-stop-timeout":        "runtime.stop.timeout",
+		"auth-key":                             "auth.key",
+		"auth-keys-file":                       "auth.keys_file",
+		"auth-keys-reload-interval":            "auth.reload_interval",
+		"auth-jwks-file":                       "auth.jwt.jwks_file",
+		"auth-jwt-public-key-file":             "auth.jwt.public_key_file",
+		"auth-jwt-issuer":                      "auth.jwt.issuer",
+		"auth-jwt-audience":                    "auth.jwt.audience",
+		"auth-jwt-clock-skew":                  "auth.jwt.clock_skew",
+		"auth-jwt-tenant-claim":                "auth.jwt.tenant_claim",
+		"auth-jwt-user-claim":                  "auth.jwt.user_claim",
+		"auth-hmac-secret":                     "auth.hmac.secret",
+		"auth-hmac-window":                     "auth.hmac.window",
+		"auth-hmac-sign-responses":             "auth.hmac.sign_responses",
+		"max-workers":                          "runtime.max_workers",
+		"min-idle-workers":                     "runtime.min_idle",
+		"autoscale":                            "runtime.autoscale.enabled",
+		"autoscale-min-workers":                "runtime.autoscale.min_workers",
+		"autoscale-target-wait":                "runtime.autoscale.target_wait",
+		"autoscale-idle-timeout":               "runtime.autoscale.idle_timeout",
+		"autoscale-interval":                   "runtime.autoscale.interval",
+		"autoscale-memory-budget":              "runtime.autoscale.memory_budget",
+		"prewarm":                              "runtime.prewarm_on_start",
+		"queue-max-length":                     "runtime.queue.max_length",
+		"queue-max-wait":                       "runtime.queue.max_wait",
+		"queue-priority":                       "runtime.queue.priorities",
+		"queue-tenant-header":                  "runtime.queue.tenant_header",
+		"queue-tenant-weight":                  "runtime.queue.tenant_weights",
+		"command":                              "runtime.cmd",
+		"cwd":                                  "runtime.cwd",
+		"arg":                                  "runtime.arg",
+		"env":                                  "runtime.env",
+		"interface":                            "runtime.io.interface",
+		"encoding":                             "runtime.io.encoding",
+		"rpc-transport":                        "runtime.io.rpc.transport",
+		"rpc-transport-ipc-endpoint":           "runtime.io.rpc.ipc.endpoint",
+		"rpc-transport-stdio-max-message-size": "runtime.io.rpc.stdio.max_message_size",
+		"rpc-transport-http-url":               "runtime.io.rpc.http.url",
+		"rpc-transport-ws-url":                 "runtime.io.rpc.ws.url",
+		"rpc-transport-tcp-address":            "runtime.io.rpc.tcp.address",
+		"rpc-notifications":                    "runtime.io.rpc.notifications",
+		"rpc-allocate-endpoint":                "runtime.io.rpc.allocate_endpoint",
+		"rpc-attach-endpoint":                  "runtime.io.rpc.attach.endpoints",
+		"rpc-attach-balancing":                 "runtime.io.rpc.attach.balancing",
+		"rpc-attach-health-check-interval":     "runtime.io.rpc.attach.health_check_interval",
+		"rpc-attach-health-check-method":       "runtime.io.rpc.attach.health_check_method",
+		"rpc-initialize":                       "runtime.io.rpc.initialize",
+		"file-scratch-dir":                     "runtime.io.file.scratch_dir",
+		"file-keep-failed":                     "runtime.io.file.keep_failed",
+		"file-keep-failed-ttl":                 "runtime.io.file.keep_failed_ttl",
+		"drain-timeout":                        "runtime.drain_timeout",
+		"breaker-threshold":                    "runtime.breaker.threshold",
+		"breaker-cooldown":                     "runtime.breaker.cooldown",
+		"worker-max-concurrency":               "runtime.max_concurrency",
+		"worker-send-timeout":                  "runtime.send.timeout",
+		"worker-stop-timeout":                  "runtime.stop.timeout",
+		"shadow-command":                       "shadow.cmd",
+		"shadow-cwd":                           "shadow.cwd",
+		"shadow-arg":                           "shadow.arg",
+		"shadow-env":                           "shadow.env",
+		"shadow-sample-rate":                   "shadow.sample_rate",
+		"shadow-timeout":                       "shadow.timeout",
+		"tracing-exporter":                     "tracing.exporter",
+		"tracing-endpoint":                     "tracing.endpoint",
+		"tracing-sample-ratio":                 "tracing.sample_ratio",
+		"rate-limit":                           "rate_limit.rate",
+		"rate-limit-burst":                     "rate_limit.burst",
+		"rate-limit-command":                   "rate_limit.commands",
 	}
 
-	// parse config using env
+	// parse config using file, env and cli flags. functions
+	// inherit the runtime config, and override it as needed.
 	cfg, err := conf.Parse[config.Config](conf.ParseOptions{
-		Cli:    ctx,
-		CliMap: cliMap,
+		Cli:      ctx,
+		CliMap:   cliMap,
+		FileName: ctx.Path("config"),
+		Inherit:  map[string]string{"functions": "runtime"},
 	})
 	if err != nil {
 		return config.Config{}, err
 	}
 
-	return cfg, err
+	if cfg.Shadow.SampleRate < 0 || cfg.Shadow.SampleRate > 1 {
+		return config.Config{}, errors.New("the shadow sample rate must be between 0 and 1")
+	}
+
+	if cfg.Tracing.SampleRatio < 0 || cfg.Tracing.SampleRatio > 1 {
+		return config.Config{}, errors.New("the tracing sample ratio must be between 0 and 1")
+	}
+
+	if cfg.RateLimit.Rate < 0 || cfg.RateLimit.Burst < 0 {
+		return config.Config{}, errors.New("the rate limit and burst must not be negative")
+	}
+
+	if len(cfg.Functions) == 0 {
+		if err := validateRuntimeConfig(cfg.Runtime); err != nil {
+			return config.Config{}, err
+		}
+
+		return cfg, nil
+	}
+
+	if cfg.Shadow.Enabled() {
+		return config.Config{}, errors.New("shadow traffic is not supported with multiple functions")
+	}
+
+	for name, fn := range cfg.Functions {
+		if !functionNamePattern.MatchString(name) {
+			return config.Config{}, fmt.Errorf("invalid function name '%s'", name)
+		}
+
+		if err := validateRuntimeConfig(fn); err != nil {
+			return config.Config{}, fmt.Errorf("function '%s': %w", name, err)
+		}
+	}
+
+	return cfg, nil
+}
+
+// functionNamePattern matches valid function names, which are
+// used as a segment of the request path.
+var functionNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+func validateRuntimeConfig(rt runtime.Config) error {
+	// a command is required, unless attaching to external workers
+	supervisor := rt.Supervisor
+	if supervisor.StartParams.Cmd == "" && len(supervisor.IO.Rpc.Attach.Endpoints) == 0 {
+		return errors.New("a command is required, unless attaching to endpoints")
+	}
+
+	return nil
 }
@@ -1,6 +1,8 @@
 package cmd
 
 import (
+	"time"
+
 	"github.com/urfave/cli/v2"
 
 	"github.com/lambda-feedback/shimmy/app"
@@ -46,6 +48,38 @@ itely, processing incoming http requests.`
 				EnvVars:  []string{"HTTP_H2C"},
 				Category: "http",
 			},
+			&cli.PathFlag{
+				Name:     "tls-cert",
+				Usage:    "the path to the PEM encoded certificate chain. If set, the server serves HTTPS.",
+				EnvVars:  []string{"HTTP_TLS_CERT"},
+				Category: "tls",
+			},
+			&cli.PathFlag{
+				Name:     "tls-key",
+				Usage:    "the path to the PEM encoded private key of the certificate.",
+				EnvVars:  []string{"HTTP_TLS_KEY"},
+				Category: "tls",
+			},
+			&cli.PathFlag{
+				Name:     "tls-client-ca",
+				Usage:    "the path to the PEM encoded CA bundle to verify client certificates against. If set, clients are asked for a certificate.",
+				EnvVars:  []string{"HTTP_TLS_CLIENT_CA"},
+				Category: "tls",
+			},
+			&cli.StringFlag{
+				Name:     "tls-client-auth",
+				Usage:    "the policy for client certificates, if a client CA bundle is set. Options: require, optional.",
+				Value:    "require",
+				EnvVars:  []string{"HTTP_TLS_CLIENT_AUTH"},
+				Category: "tls",
+			},
+			&cli.DurationFlag{
+				Name:     "tls-reload-interval",
+				Usage:    "the interval to check the certificate, key and client CA bundle for changes, which are reloaded without a restart.",
+				Value:    10 * time.Second,
+				EnvVars:  []string{"HTTP_TLS_RELOAD_INTERVAL"},
+				Category: "tls",
+			},
 		},
 	}
 )
@@ -63,6 +97,13 @@ func serveAction(ctx *cli.Context) error {
 
 	cfg, err := conf.Parse[standalone.Config](conf.ParseOptions{
 		Cli: ctx,
+		CliMap: map[string]string{
+			"tls-cert":            "tls.cert",
+			"tls-key":             "tls.key",
+			"tls-client-ca":       "tls.client_ca",
+			"tls-client-auth":     "tls.client_auth",
+			"tls-reload-interval": "tls.reload_interval",
+		},
 	})
 	if err != nil {
 		return err
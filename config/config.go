@@ -1,17 +1,24 @@
 package config
 
-import "github.com/lambda-feedback/shimmy/runtime"
+import (
+	"github.com/lambda-feedback/shimmy/internal/auth"
+	"github.com/lambda-feedback/shimmy/internal/ratelimit"
+	"github.com/lambda-feedback/shimmy/internal/tracing"
+	"github.com/lambda-feedback/shimmy/runtime"
+)
 
-type MessageEncoding string
+// MessageEncoding is the encoding of messages exchanged with the worker.
+type MessageEncoding = runtime.MessageEncoding
 
 const (
-	JSON MessageEncoding = "json"
+	JSON    MessageEncoding = runtime.JSONEncoding
+	MsgPack MessageEncoding = runtime.MsgPackEncoding
+	CBOR    MessageEncoding = runtime.CBOREncoding
 )
 
-type AuthConfig struct {
-	// Key is the secret key for the application
-	Key string `conf:"key"`
-}
+// AuthConfig is the configuration of the API keys, bearer tokens and
+// signed requests.
+type AuthConfig = auth.Config
 
 type Config struct {
 	// LogLevel is the log level for the application
@@ -20,9 +27,25 @@ type Config struct {
 	// LogFormat is the log format for the application
 	LogFormat string `conf:"log_format"`
 
-	// Runtime is the runtime configuration
+	// Runtime is the runtime configuration. If functions are declared,
+	// it holds the defaults inherited by all functions.
 	Runtime runtime.Config `conf:"runtime"`
 
+	// Functions are the evaluation functions hosted by the application,
+	// by name. If no function is declared, the application hosts a
+	// single function, described by Runtime.
+	Functions map[string]runtime.Config `conf:"functions"`
+
+	// Shadow is a second version of the evaluation function, which
+	// handles a sample of the requests to compare its results.
+	Shadow runtime.ShadowConfig `conf:"shadow"`
+
 	// Auth is the authentication configuration
 	Auth AuthConfig `conf:"auth"`
+
+	// Tracing is the tracing configuration
+	Tracing tracing.Config `conf:"tracing"`
+
+	// RateLimit is the rate limit configuration
+	RateLimit ratelimit.Config `conf:"rate_limit"`
 }
@@ -0,0 +1,165 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+
+	"github.com/lambda-feedback/shimmy/config"
+	"github.com/lambda-feedback/shimmy/internal/auth"
+	"github.com/lambda-feedback/shimmy/internal/metrics"
+	"github.com/lambda-feedback/shimmy/runtime"
+)
+
+type FunctionsHandlerParams struct {
+	fx.In
+
+	Functions runtime.Functions
+	Config    config.Config
+	Keyring   *auth.Keyring
+	Tokens    *auth.Verifier   `optional:"true"`
+	Signer    *auth.Signer     `optional:"true"`
+	Metrics   *metrics.Metrics `optional:"true"`
+	Log       *zap.Logger
+}
+
+// FunctionsHandler routes requests to the command handler of the
+// function named in the request path.
+type FunctionsHandler struct {
+	functions runtime.Functions
+	commands  map[string]*CommandHandler
+}
+
+func NewFunctionsHandler(params FunctionsHandlerParams) *FunctionsHandler {
+	commands := make(map[string]*CommandHandler, len(params.Functions))
+
+	for name, fn := range params.Functions {
+		// the function config takes the place of the runtime config
+		cfg := params.Config
+		cfg.Runtime = fn.Config
+
+		commands[name] = NewCommandHandler(CommandHandlerParams{
+			Handler:  fn.Handler,
+			Config:   cfg,
+			Keyring:  params.Keyring,
+			Tokens:   params.Tokens,
+			Signer:   params.Signer,
+			Metrics:  params.Metrics,
+			Function: name,
+			Log:      params.Log.With(zap.String("function", name)),
+		})
+	}
+
+	return &FunctionsHandler{
+		functions: params.Functions,
+		commands:  commands,
+	}
+}
+
+func (h *FunctionsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	handler, ok := h.commands[r.PathValue("name")]
+	if !ok {
+		http.Error(w, "function not found", http.StatusNotFound)
+		return
+	}
+
+	// the command in the path is resolved by the command handler, so
+	// the signature of the request is verified as it was sent
+	handler.ServeHTTP(w, r)
+}
+
+// Function returns a handler that serves the request using the handler
+// created for the runtime of the function named in the request path.
+func (h *FunctionsHandler) Function(newHandler func(runtime.Runtime) http.HandlerFunc) http.HandlerFunc {
+	handlers := make(map[string]http.HandlerFunc, len(h.functions))
+	for name, fn := range h.functions {
+		handlers[name] = newHandler(fn.Runtime)
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		handler, ok := handlers[r.PathValue("name")]
+		if !ok {
+			http.Error(w, "function not found", http.StatusNotFound)
+			return
+		}
+
+		handler(w, r)
+	}
+}
+
+// NewFunctionsReadyHandler returns a handler that responds with the
+// readiness of all functions. The instance is ready as long as any
+// function is ready, so a single broken function does not take the
+// healthy functions out of service. The readiness of each function
+// is reported by /functions/{name}/ready.
+func NewFunctionsReadyHandler(functions runtime.Functions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		ready := 0
+
+		states := make(map[string]string, len(functions))
+		for name, fn := range functions {
+			states[name] = "starting"
+			if fn.Runtime.Ready() {
+				states[name] = "ready"
+				ready++
+			}
+		}
+
+		status := "ready"
+		statusCode := http.StatusOK
+
+		switch {
+		case ready == 0:
+			status = "starting"
+			statusCode = http.StatusServiceUnavailable
+		case ready < len(functions):
+			status = "degraded"
+		}
+
+		w.WriteHeader(statusCode)
+		json.NewEncoder(w).Encode(map[string]any{
+			"status":    status,
+			"functions": states,
+		})
+	}
+}
+
+// NewFunctionsStatsHandler returns a handler that responds with the
+// statistics of all functions.
+func NewFunctionsStatsHandler(functions runtime.Functions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		stats := make(map[string]runtime.Stats, len(functions))
+		for name, fn := range functions {
+			stats[name] = fn.Runtime.Stats()
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]any{"functions": stats})
+	}
+}
+
+// NewFunctionsQueueHandler returns a handler that responds with the
+// number of requests waiting for a worker, across all functions.
+func NewFunctionsQueueHandler(functions runtime.Functions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var total int
+
+		depths := make(map[string]int, len(functions))
+		for name, fn := range functions {
+			depths[name] = fn.Runtime.QueueDepth()
+			total += depths[name]
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]any{
+			"depth":     total,
+			"functions": depths,
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.uber.org/zap"
+
+	"github.com/lambda-feedback/shimmy/config"
+	"github.com/lambda-feedback/shimmy/internal/auth"
+	"github.com/lambda-feedback/shimmy/runtime"
+)
+
+// --- Stub runtime ---
+type stubRuntime struct {
+	runtime.Runtime
+
+	ready bool
+	depth int
+	stats runtime.Stats
+}
+
+func (r *stubRuntime) Ready() bool {
+	return r.ready
+}
+
+func (r *stubRuntime) QueueDepth() int {
+	return r.depth
+}
+
+func (r *stubRuntime) Stats() runtime.Stats {
+	return r.stats
+}
+
+func newFunctionsMux(functions runtime.Functions) *http.ServeMux {
+	handler := NewFunctionsHandler(FunctionsHandlerParams{
+		Functions: functions,
+		Config:    config.Config{},
+		Log:       zap.NewNop(),
+	})
+
+	mux := http.NewServeMux()
+	mux.Handle("/functions/{name}", handler)
+	mux.Handle("/functions/{name}/{command}", handler)
+	mux.Handle("/functions/{name}/ready", handler.Function(NewReadyHandler))
+
+	return mux
+}
+
+func TestFunctionsHandler_RoutesToFunction(t *testing.T) {
+	alpha := new(MockHandler)
+	beta := new(MockHandler)
+
+	alpha.On("Handle", mock.Anything, mock.MatchedBy(func(r runtime.Request) bool {
+		return r.Header.Get("command") == "eval"
+	})).Return(runtime.Response{StatusCode: http.StatusOK, Body: []byte(`{"function":"alpha"}`)})
+
+	mux := newFunctionsMux(runtime.Functions{
+		"alpha": {Name: "alpha", Runtime: &stubRuntime{}, Handler: alpha},
+		"beta":  {Name: "beta", Runtime: &stubRuntime{}, Handler: beta},
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/functions/alpha/eval", nil)
+	w := httptest.NewRecorder()
+
+	mux.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"function":"alpha"}`, w.Body.String())
+	alpha.AssertExpectations(t)
+	beta.AssertNotCalled(t, "Handle", mock.Anything, mock.Anything)
+}
+
+func TestFunctionsHandler_SignedRequest(t *testing.T) {
+	alpha := new(MockHandler)
+	alpha.On("Handle", mock.Anything, mock.MatchedBy(func(r runtime.Request) bool {
+		return r.Header.Get("command") == "preview"
+	})).Return(runtime.Response{StatusCode: http.StatusOK, Body: []byte(`{}`)})
+
+	signer := auth.NewSigner(config.AuthConfig{HMAC: auth.HMACConfig{Secret: "shared-secret"}})
+
+	handler := NewFunctionsHandler(FunctionsHandlerParams{
+		Functions: runtime.Functions{
+			"alpha": {Name: "alpha", Runtime: &stubRuntime{}, Handler: alpha},
+		},
+		Config:  config.Config{},
+		Keyring: newKeyring(t, config.AuthConfig{}),
+		Signer:  signer,
+		Log:     zap.NewNop(),
+	})
+
+	mux := http.NewServeMux()
+	mux.Handle("/functions/{name}/{command}", handler)
+
+	// the request is signed without a command header, as sent by clients
+	body := []byte(`{"response": 1}`)
+	req := httptest.NewRequest(http.MethodPost, "/functions/alpha/preview", bytes.NewReader(body))
+	signer.SignRequest(req, body, "nonce-1")
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, req.Header.Get("command"))
+	alpha.AssertExpectations(t)
+}
+
+func TestFunctionsHandler_UnknownFunction(t *testing.T) {
+	mux := newFunctionsMux(runtime.Functions{
+		"alpha": {Name: "alpha", Runtime: &stubRuntime{}, Handler: new(MockHandler)},
+	})
+
+	for _, path := range []string{"/functions/beta/eval", "/functions/beta/ready"} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, nil))
+
+		assert.Equal(t, http.StatusNotFound, w.Code, path)
+	}
+}
+
+func TestFunctionsHandler_Ready_PerFunction(t *testing.T) {
+	mux := newFunctionsMux(runtime.Functions{
+		"alpha": {Name: "alpha", Runtime: &stubRuntime{ready: true}, Handler: new(MockHandler)},
+		"beta":  {Name: "beta", Runtime: &stubRuntime{}, Handler: new(MockHandler)},
+	})
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/functions/alpha/ready", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/functions/beta/ready", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
+
+func TestFunctionsReadyHandler(t *testing.T) {
+	functions := runtime.Functions{
+		"alpha": {Name: "alpha", Runtime: &stubRuntime{ready: true}},
+		"beta":  {Name: "beta", Runtime: &stubRuntime{}},
+	}
+
+	w := httptest.NewRecorder()
+	NewFunctionsReadyHandler(functions)(w, httptest.NewRequest(http.MethodGet, "/ready", nil))
+
+	var body struct {
+		Status    string            `json:"status"`
+		Functions map[string]string `json:"functions"`
+	}
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&body))
+	assert.Equal(t, "degraded", body.Status)
+	assert.Equal(t, map[string]string{"alpha": "ready", "beta": "starting"}, body.Functions)
+}
+
+func TestFunctionsReadyHandler_NoFunctionReady(t *testing.T) {
+	functions := runtime.Functions{
+		"alpha": {Name: "alpha", Runtime: &stubRuntime{}},
+		"beta":  {Name: "beta", Runtime: &stubRuntime{}},
+	}
+
+	w := httptest.NewRecorder()
+	NewFunctionsReadyHandler(functions)(w, httptest.NewRequest(http.MethodGet, "/ready", nil))
+
+	var body struct {
+		Status string `json:"status"`
+	}
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&body))
+	assert.Equal(t, "starting", body.Status)
+}
+
+func TestFunctionsQueueHandler(t *testing.T) {
+	functions := runtime.Functions{
+		"alpha": {Name: "alpha", Runtime: &stubRuntime{depth: 2}},
+		"beta":  {Name: "beta", Runtime: &stubRuntime{depth: 3}},
+	}
+
+	w := httptest.NewRecorder()
+	NewFunctionsQueueHandler(functions)(w, httptest.NewRequest(http.MethodGet, "/queue", nil))
+
+	var body struct {
+		Depth     int            `json:"depth"`
+		Functions map[string]int `json:"functions"`
+	}
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&body))
+	assert.Equal(t, 5, body.Depth)
+	assert.Equal(t, map[string]int{"alpha": 2, "beta": 3}, body.Functions)
+}
@@ -1,13 +1,23 @@
 package handler
 
 import (
+	"bytes"
+	"context"
 	"io"
 	"net/http"
+	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/fx"
 	"go.uber.org/zap"
 
 	"github.com/lambda-feedback/shimmy/config"
+	"github.com/lambda-feedback/shimmy/internal/auth"
+	"github.com/lambda-feedback/shimmy/internal/metrics"
+	"github.com/lambda-feedback/shimmy/internal/server"
+	"github.com/lambda-feedback/shimmy/internal/tracing"
 	"github.com/lambda-feedback/shimmy/runtime"
 )
 
@@ -16,21 +26,38 @@ type CommandHandlerParams struct {
 
 	Handler runtime.Handler
 	Config  config.Config
+	Keyring *auth.Keyring
+	Tokens  *auth.Verifier   `optional:"true"`
+	Signer  *auth.Signer     `optional:"true"`
+	Metrics *metrics.Metrics `optional:"true"`
 	Log     *zap.Logger
+
+	// Function is the name of the function, if hosting multiple functions
+	Function string `optional:"true"`
 }
 
 func NewCommandHandler(params CommandHandlerParams) *CommandHandler {
 	return &CommandHandler{
-		handler: params.Handler,
-		config:  params.Config,
-		log:     params.Log,
+		handler:  params.Handler,
+		config:   params.Config,
+		keys:     params.Keyring,
+		tokens:   params.Tokens,
+		signer:   params.Signer,
+		metrics:  params.Metrics,
+		function: params.Function,
+		log:      params.Log,
 	}
 }
 
 type CommandHandler struct {
-	handler runtime.Handler
-	config  config.Config
-	log     *zap.Logger
+	handler  runtime.Handler
+	config   config.Config
+	keys     *auth.Keyring
+	tokens   *auth.Verifier
+	signer   *auth.Signer
+	metrics  *metrics.Metrics
+	function string
+	log      *zap.Logger
 }
 
 func (h *CommandHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -39,11 +66,96 @@ func (h *CommandHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		zap.String("method", r.Method),
 	)
 
-	// Check for authorization
-	if h.config.Auth.Key != "" && r.Header.Get("api-key") != h.config.Auth.Key {
-		log.Debug("unauthorized request")
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
-		return
+	start := time.Now()
+
+	// Continue the trace of the client, if any
+	ctx, span := tracing.Start(tracing.Extract(r.Context(), r.Header), "shimmy.request",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("http.request.method", r.Method),
+			attribute.String("url.path", r.URL.Path),
+			attribute.String("shimmy.function", h.function),
+		),
+	)
+	defer span.End()
+
+	// Clients authenticated using a certificate are identified by its subject
+	if subject, ok := server.ClientSubject(r); ok {
+		log = log.With(zap.String("client", subject))
+		span.SetAttributes(attribute.String("shimmy.client.subject", subject))
+	}
+
+	// nonce is the nonce of a signed request, to sign its response
+	var nonce string
+
+	// Check for authorization. Clients may send a bearer token or sign
+	// the request instead of sending an API key, if accepted.
+	if token, ok := auth.BearerToken(r); ok && h.tokens.Enabled() {
+		// The token may have been verified by the rate limiter already
+		identity, verified := auth.IdentityFromContext(ctx)
+		if !verified {
+			var err error
+			if identity, err = h.tokens.Verify(token); err != nil {
+				log.Debug("invalid bearer token", zap.Error(err))
+				h.observe(ctx, r, http.StatusUnauthorized, start)
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+
+		log = log.With(
+			zap.String("subject", identity.Subject),
+			zap.String("tenant", identity.Tenant),
+			zap.String("user", identity.User),
+		)
+		span.SetAttributes(
+			attribute.String("shimmy.auth.subject", identity.Subject),
+			attribute.String("shimmy.auth.tenant", identity.Tenant),
+			attribute.String("shimmy.auth.user", identity.User),
+		)
+
+		ctx = auth.ContextWithIdentity(ctx, identity)
+	} else if auth.IsSigned(r) && h.signer.Enabled() {
+		// The signature covers the body, so it is read upfront
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			log.Debug("failed to read body", zap.Error(err))
+			http.Error(w, "failed to read body", http.StatusBadRequest)
+			return
+		}
+
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		if err := h.signer.VerifyRequest(r, body); err != nil {
+			log.Debug("invalid request signature", zap.Error(err))
+			h.observe(ctx, r, http.StatusUnauthorized, start)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		nonce = r.Header.Get(auth.NonceHeader)
+
+		log = log.With(zap.Bool("signed", true))
+		span.SetAttributes(attribute.Bool("shimmy.auth.signed", true))
+	} else if h.keys.Enabled() || h.tokens.Enabled() || h.signer.Enabled() {
+		key, ok := h.keys.Authenticate(r.Header.Get("api-key"))
+		if !ok {
+			log.Debug("unauthorized request")
+			h.observe(ctx, r, http.StatusUnauthorized, start)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		log = log.With(zap.String("key", key.Label))
+		span.SetAttributes(attribute.String("shimmy.auth.key", key.Label))
+
+		// Keys may be restricted to some commands
+		if command := runtime.RequestCommand(r); !key.Allows(command) {
+			log.Debug("command not allowed for key", zap.String("command", command))
+			h.observe(ctx, r, http.StatusForbidden, start)
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
 	}
 
 	body, err := io.ReadAll(r.Body)
@@ -53,15 +165,51 @@ func (h *CommandHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The runtime reads the command from the header, so the command of
+	// the path is passed on once the request is authorized
+	header := r.Header.Clone()
+	header.Set("command", runtime.RequestCommand(r))
+
 	request := runtime.Request{
 		Path:   r.URL.Path,
 		Method: r.Method,
-		Header: r.Header,
+		Header: header,
 		Body:   body,
 	}
 
+	// Queue requests of different tenants fairly. The tenant of a
+	// verified token takes precedence over the tenant header.
+	if identity, ok := auth.IdentityFromContext(ctx); ok && identity.Tenant != "" {
+		ctx = runtime.ContextWithTenant(ctx, identity.Tenant)
+	} else if header := h.config.Runtime.Queue.TenantHeader; header != "" {
+		ctx = runtime.ContextWithTenant(ctx, r.Header.Get(header))
+	}
+
+	// Responses to signed requests are signed, if enabled. They are
+	// never streamed, as the signature covers the whole response.
+	sign := nonce != "" && h.signer.SignsResponses()
+
+	// Stream progress to clients that accept server-sent events
+	var stream *eventStream
+	var streaming bool
+	if !sign {
+		stream, streaming = newEventStream(w, r, log)
+	}
+
+	if streaming {
+		stream.open()
+		ctx = runtime.ContextWithProgressListener(ctx, stream.progress)
+	}
+
 	// Handle the request
-	response := h.handler.Handle(r.Context(), request)
+	response := h.handler.Handle(ctx, request)
+
+	h.observe(ctx, r, response.StatusCode, start)
+
+	if streaming {
+		stream.close(response)
+		return
+	}
 
 	// Map response headers
 	for k, v := range response.Header {
@@ -70,6 +218,11 @@ func (h *CommandHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Sign the response to signed requests, so callers can verify it
+	if sign {
+		h.signer.SignResponse(w.Header(), response.StatusCode, nonce, response.Body)
+	}
+
 	// Write response headers and status code
 	w.WriteHeader(response.StatusCode)
 
@@ -79,3 +232,25 @@ func (h *CommandHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "failed to write response", http.StatusInternalServerError)
 	}
 }
+
+// observe records the metrics of a handled request, and its status
+// in the span of the request.
+func (h *CommandHandler) observe(ctx context.Context, r *http.Request, status int, start time.Time) {
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attribute.Int("http.response.status_code", status))
+	if status >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(status))
+	}
+
+	if h.metrics == nil {
+		return
+	}
+
+	// unknown commands are grouped, to bound the number of series
+	command := "unknown"
+	if c, ok := runtime.ParseCommand(runtime.RequestCommand(r)); ok {
+		command = string(c)
+	}
+
+	h.metrics.ObserveRequest(h.function, command, status, time.Since(start))
+}
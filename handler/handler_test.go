@@ -3,15 +3,31 @@ package handler
 import (
 	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
 	"github.com/lambda-feedback/shimmy/config"
+	"github.com/lambda-feedback/shimmy/internal/auth"
 	"github.com/lambda-feedback/shimmy/runtime"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 // --- Mock handler ---
@@ -24,6 +40,13 @@ func (m *MockHandler) Handle(ctx context.Context, req runtime.Request) runtime.R
 	return args.Get(0).(runtime.Response)
 }
 
+func newKeyring(t *testing.T, config config.AuthConfig) *auth.Keyring {
+	keyring, err := auth.NewKeyring(config, zap.NewNop())
+	require.NoError(t, err)
+
+	return keyring
+}
+
 // --- Test ---
 func TestServeHTTP_Success(t *testing.T) {
 	mockHandler := new(MockHandler)
@@ -54,6 +77,7 @@ func TestServeHTTP_Success(t *testing.T) {
 			Runtime:  runtime.Config{},
 			Auth:     config.AuthConfig{Key: "secret"},
 		},
+		keys: newKeyring(t, config.AuthConfig{Key: "secret"}),
 	}
 
 	handler.ServeHTTP(w, req)
@@ -85,6 +109,7 @@ func TestServeHTTP_Unauthorized(t *testing.T) {
 			Runtime:  runtime.Config{},
 			Auth:     config.AuthConfig{Key: "Secret"},
 		},
+		keys: newKeyring(t, config.AuthConfig{Key: "Secret"}),
 	}
 
 	handler.ServeHTTP(w, req)
@@ -100,3 +125,292 @@ func TestServeHTTP_Unauthorized(t *testing.T) {
 	// Ensure handler was not called
 	mockHandler.AssertNotCalled(t, "Handle", mock.Anything, mock.Anything)
 }
+
+func TestServeHTTP_EventStream(t *testing.T) {
+	mockHandler := new(MockHandler)
+
+	req := httptest.NewRequest(http.MethodPost, "/eval", bytes.NewReader([]byte(`{}`)))
+	req.Header.Set("Accept", "text/event-stream")
+
+	w := httptest.NewRecorder()
+
+	mockHandler.On("Handle", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		progress, ok := runtime.ProgressListenerFromContext(args.Get(0).(context.Context))
+		if assert.True(t, ok) {
+			progress(runtime.Progress{Message: "working"})
+		}
+	}).Return(runtime.Response{
+		StatusCode: http.StatusOK,
+		Body:       []byte(`{"ok":true}`),
+	})
+
+	handler := &CommandHandler{
+		handler: mockHandler,
+		log:     zap.NewNop(),
+	}
+
+	handler.ServeHTTP(w, req)
+
+	res := w.Result()
+	defer res.Body.Close()
+
+	body, _ := io.ReadAll(res.Body)
+
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+	assert.Equal(t, "event: progress\ndata: {\"message\":\"working\"}\n\n"+
+		"event: result\ndata: {\"ok\":true}\n\n", string(body))
+}
+
+func TestServeHTTP_EventStream_Error(t *testing.T) {
+	mockHandler := new(MockHandler)
+
+	req := httptest.NewRequest(http.MethodPost, "/eval", bytes.NewReader([]byte(`{}`)))
+	req.Header.Set("Accept", "application/json, text/event-stream")
+
+	w := httptest.NewRecorder()
+
+	mockHandler.On("Handle", mock.Anything, mock.Anything).Return(runtime.Response{
+		StatusCode: http.StatusBadRequest,
+		Body:       []byte(`{"error":{}}`),
+	})
+
+	handler := &CommandHandler{
+		handler: mockHandler,
+		log:     zap.NewNop(),
+	}
+
+	handler.ServeHTTP(w, req)
+
+	body, _ := io.ReadAll(w.Result().Body)
+
+	assert.Equal(t, "event: error\ndata: {\"error\":{}}\n\n", string(body))
+}
+
+func TestServeHTTP_ContinuesClientTrace(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	mockHandler := new(MockHandler)
+	mockHandler.On("Handle", mock.Anything, mock.Anything).Return(runtime.Response{
+		StatusCode: http.StatusOK,
+		Body:       []byte(`{}`),
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte(`{}`)))
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	handler := &CommandHandler{
+		handler: mockHandler,
+		log:     zap.NewNop(),
+	}
+
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 1)
+
+	span := spans[0]
+	assert.Equal(t, "shimmy.request", span.Name())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", span.Parent().SpanID().String())
+	assert.Contains(t, span.Attributes(), attribute.Int("http.response.status_code", http.StatusOK))
+
+	// the runtime handler continues the trace
+	ctx := mockHandler.Calls[0].Arguments.Get(0).(context.Context)
+	assert.Equal(t, span.SpanContext().SpanID(), trace.SpanContextFromContext(ctx).SpanID())
+}
+
+func TestServeHTTP_RestrictedKey(t *testing.T) {
+	mockHandler := new(MockHandler)
+	mockHandler.On("Handle", mock.Anything, mock.Anything).Return(runtime.Response{
+		StatusCode: http.StatusOK,
+		Body:       []byte(`{}`),
+	})
+
+	handler := &CommandHandler{
+		handler: mockHandler,
+		log:     zap.NewNop(),
+		keys: newKeyring(t, config.AuthConfig{
+			Keys: []auth.Key{
+				{Label: "grader", Key: "grader-secret"},
+				{Label: "frontend", Key: "frontend-secret", Commands: []string{"preview"}},
+			},
+		}),
+	}
+
+	for _, tc := range []struct {
+		key     string
+		command string
+		status  int
+	}{
+		{"grader-secret", "", http.StatusOK},
+		{"grader-secret", "preview", http.StatusOK},
+		{"frontend-secret", "preview", http.StatusOK},
+		{"frontend-secret", "eval", http.StatusForbidden},
+		{"frontend-secret", "", http.StatusForbidden},
+		{"unknown", "preview", http.StatusUnauthorized},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte(`{}`)))
+		req.Header.Set("api-key", tc.key)
+		if tc.command != "" {
+			req.Header.Set("command", tc.command)
+		}
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		assert.Equal(t, tc.status, w.Code, "key %s, command %s", tc.key, tc.command)
+	}
+
+	mockHandler.AssertNumberOfCalls(t, "Handle", 3)
+}
+
+func TestServeHTTP_BearerToken(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	jwk := jose.JSONWebKey{Key: key, KeyID: "current", Use: "sig"}
+	jwks, err := json.Marshal(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{jwk.Public()}})
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, jwks, 0600))
+
+	verifier, err := auth.NewVerifier(config.AuthConfig{JWT: auth.JWTConfig{JWKSFile: path}}, zap.NewNop())
+	require.NoError(t, err)
+
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: jwk}, nil)
+	require.NoError(t, err)
+
+	sign := func(expiry time.Time) string {
+		token, err := jwt.Signed(signer).Claims(jwt.Claims{
+			Subject: "user-1",
+			Expiry:  jwt.NewNumericDate(expiry),
+		}).Claims(map[string]any{"tenant": "course-1"}).Serialize()
+		require.NoError(t, err)
+
+		return token
+	}
+
+	var tenants []string
+	mockHandler := new(MockHandler)
+	mockHandler.On("Handle", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		tenants = append(tenants, runtime.TenantFromContext(args.Get(0).(context.Context)))
+	}).Return(runtime.Response{
+		StatusCode: http.StatusOK,
+		Body:       []byte(`{}`),
+	})
+
+	handler := &CommandHandler{
+		handler: mockHandler,
+		log:     zap.NewNop(),
+		keys:    newKeyring(t, config.AuthConfig{Key: "secret"}),
+		tokens:  verifier,
+	}
+
+	for _, tc := range []struct {
+		name   string
+		header string
+		value  string
+		status int
+	}{
+		{"valid token", "Authorization", "Bearer " + sign(time.Now().Add(time.Hour)), http.StatusOK},
+		{"expired token", "Authorization", "Bearer " + sign(time.Now().Add(-time.Hour)), http.StatusUnauthorized},
+		{"invalid token", "Authorization", "Bearer secret", http.StatusUnauthorized},
+		{"api key", "api-key", "secret", http.StatusOK},
+		{"no credentials", "", "", http.StatusUnauthorized},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte(`{}`)))
+		if tc.header != "" {
+			req.Header.Set(tc.header, tc.value)
+		}
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		assert.Equal(t, tc.status, w.Code, tc.name)
+	}
+
+	// tokens verified by the rate limiter are not verified again
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte(`{}`)))
+	req.Header.Set("Authorization", "Bearer verified")
+	req = req.WithContext(auth.ContextWithIdentity(req.Context(), auth.Identity{Subject: "user-2", Tenant: "course-2"}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// the tenant of the token is used for fair queuing
+	assert.Equal(t, []string{"course-1", "", "course-2"}, tenants)
+}
+
+func TestServeHTTP_SignedRequest(t *testing.T) {
+	mockHandler := new(MockHandler)
+	mockHandler.On("Handle", mock.Anything, mock.MatchedBy(func(req runtime.Request) bool {
+		return string(req.Body) == `{"response": 1}`
+	})).Return(runtime.Response{
+		StatusCode: http.StatusOK,
+		Body:       []byte(`{"is_correct": true}`),
+	})
+
+	signer := auth.NewSigner(config.AuthConfig{HMAC: auth.HMACConfig{
+		Secret:        "shared-secret",
+		SignResponses: true,
+	}})
+
+	handler := &CommandHandler{
+		handler: mockHandler,
+		log:     zap.NewNop(),
+		keys:    newKeyring(t, config.AuthConfig{Key: "secret"}),
+		signer:  signer,
+	}
+
+	body := []byte(`{"response": 1}`)
+
+	send := func(req *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	signer.SignRequest(req, body, "nonce-1")
+
+	w := send(req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, signer.VerifyResponse(w.Header(), w.Code, "nonce-1", w.Body.Bytes()))
+
+	// responses to signed requests are signed instead of streamed
+	streamed := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	streamed.Header.Set("Accept", "text/event-stream")
+	signer.SignRequest(streamed, body, "nonce-3")
+
+	w = send(streamed)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotEqual(t, "text/event-stream", w.Header().Get("Content-Type"))
+	assert.NoError(t, signer.VerifyResponse(w.Header(), w.Code, "nonce-3", w.Body.Bytes()))
+
+	// replayed requests are rejected
+	replay := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	replay.Header = req.Header.Clone()
+	assert.Equal(t, http.StatusUnauthorized, send(replay).Code)
+
+	// tampered requests are rejected
+	tampered := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte(`{"response": 2}`)))
+	signer.SignRequest(tampered, body, "nonce-2")
+	assert.Equal(t, http.StatusUnauthorized, send(tampered).Code)
+
+	// responses to requests using an API key are not signed
+	keyed := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	keyed.Header.Set("api-key", "secret")
+	w = send(keyed)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get(auth.SignatureHeader))
+
+	mockHandler.AssertNumberOfCalls(t, "Handle", 3)
+}
@@ -0,0 +1,28 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/lambda-feedback/shimmy/runtime"
+)
+
+// NewInfoHandler returns a handler that responds with the capabilities
+// reported by the evaluation function during the handshake.
+func NewInfoHandler(rt runtime.Runtime) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		caps := rt.Capabilities()
+		if caps == nil {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]any{
+				"error": map[string]string{"message": "capabilities not available"},
+			})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(caps)
+	}
+}
@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"maps"
+	"slices"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/lambda-feedback/shimmy/runtime"
+)
+
+// runtimeGauge describes a metric family read from the runtime stats.
+type runtimeGauge struct {
+	desc  *prometheus.Desc
+	typ   prometheus.ValueType
+	value func(runtime.Stats) float64
+}
+
+func newRuntimeGauge(name, help string, typ prometheus.ValueType, value func(runtime.Stats) float64) runtimeGauge {
+	return runtimeGauge{
+		desc:  prometheus.NewDesc(name, help, []string{"function"}, nil),
+		typ:   typ,
+		value: value,
+	}
+}
+
+var runtimeGauges = []runtimeGauge{
+	newRuntimeGauge("shimmy_pool_max_workers", "The maximum number of workers.", prometheus.GaugeValue,
+		func(s runtime.Stats) float64 { return float64(s.Pool.Max) }),
+	newRuntimeGauge("shimmy_pool_target_workers", "The number of workers the pool is scaled to.", prometheus.GaugeValue,
+		func(s runtime.Stats) float64 { return float64(s.Pool.Target) }),
+	newRuntimeGauge("shimmy_pool_acquires_total", "The number of workers acquired to handle a message.", prometheus.CounterValue,
+		func(s runtime.Stats) float64 { return float64(s.Pool.AcquireCount) }),
+	newRuntimeGauge("shimmy_pool_empty_acquires_total", "The number of acquires that waited for a worker to be started or released.", prometheus.CounterValue,
+		func(s runtime.Stats) float64 { return float64(s.Pool.EmptyAcquireCount) }),
+	newRuntimeGauge("shimmy_queue_depth", "The number of messages waiting for a worker.", prometheus.GaugeValue,
+		func(s runtime.Stats) float64 { return float64(s.Queue.Depth) }),
+	newRuntimeGauge("shimmy_queue_inflight", "The number of messages being handled.", prometheus.GaugeValue,
+		func(s runtime.Stats) float64 { return float64(s.Queue.Inflight) }),
+	newRuntimeGauge("shimmy_queue_capacity", "The number of messages handled concurrently.", prometheus.GaugeValue,
+		func(s runtime.Stats) float64 { return float64(s.Queue.Capacity) }),
+	newRuntimeGauge("shimmy_queue_rejected_total", "The number of messages rejected by admission control.", prometheus.CounterValue,
+		func(s runtime.Stats) float64 { return float64(s.Queue.Rejected) }),
+	newRuntimeGauge("shimmy_breaker_open", "Whether the circuit breaker rejects messages.", prometheus.GaugeValue,
+		func(s runtime.Stats) float64 { return boolValue(s.Breaker.State != "" && s.Breaker.State != "closed") }),
+	newRuntimeGauge("shimmy_worker_boots_total", "The number of workers started.", prometheus.CounterValue,
+		func(s runtime.Stats) float64 { return float64(s.Workers.Boots) }),
+	newRuntimeGauge("shimmy_worker_boot_failures_total", "The number of workers that failed to start.", prometheus.CounterValue,
+		func(s runtime.Stats) float64 { return float64(s.Workers.BootFailures) }),
+	newRuntimeGauge("shimmy_worker_crashes_total", "The number of messages that failed due to the worker or its connection.", prometheus.CounterValue,
+		func(s runtime.Stats) float64 { return float64(s.Workers.Crashes) }),
+	newRuntimeGauge("shimmy_worker_recycles_total", "The number of transient workers stopped after handling a message.", prometheus.CounterValue,
+		func(s runtime.Stats) float64 { return float64(s.Workers.Recycles) }),
+}
+
+var (
+	readyDesc = prometheus.NewDesc("shimmy_ready",
+		"Whether the function is able to handle requests without waiting for workers to boot.",
+		[]string{"function"}, nil)
+	poolWorkersDesc = prometheus.NewDesc("shimmy_pool_workers",
+		"The number of workers, by state.",
+		[]string{"function", "state"}, nil)
+	workerExitsDesc = prometheus.NewDesc("shimmy_worker_exits_total",
+		"The number of worker processes that exited, by exit code.",
+		[]string{"function", "code"}, nil)
+	workerSignalsDesc = prometheus.NewDesc("shimmy_worker_signals_total",
+		"The number of worker processes terminated by a signal, by signal number.",
+		[]string{"function", "signal"}, nil)
+	queueWaitDesc = prometheus.NewDesc("shimmy_queue_wait_seconds",
+		"The time messages waited for a worker.",
+		[]string{"function"}, nil)
+)
+
+// runtimeCollector exports the stats of the runtimes, by function name.
+// The stats are read at scrape time.
+type runtimeCollector struct {
+	runtimes map[string]runtime.Runtime
+	names    []string
+}
+
+// NewRuntimeCollector returns a collector exporting the stats of the
+// runtimes, by function name.
+func NewRuntimeCollector(runtimes map[string]runtime.Runtime) prometheus.Collector {
+	return &runtimeCollector{
+		runtimes: runtimes,
+		names:    slices.Sorted(maps.Keys(runtimes)),
+	}
+}
+
+func (c *runtimeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- readyDesc
+	ch <- poolWorkersDesc
+	ch <- workerExitsDesc
+	ch <- workerSignalsDesc
+	ch <- queueWaitDesc
+
+	for _, gauge := range runtimeGauges {
+		ch <- gauge.desc
+	}
+}
+
+func (c *runtimeCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, name := range c.names {
+		rt := c.runtimes[name]
+		s := rt.Stats()
+
+		ch <- prometheus.MustNewConstMetric(readyDesc, prometheus.GaugeValue, boolValue(rt.Ready()), name)
+
+		ch <- prometheus.MustNewConstMetric(poolWorkersDesc, prometheus.GaugeValue, float64(s.Pool.Idle), name, "idle")
+		ch <- prometheus.MustNewConstMetric(poolWorkersDesc, prometheus.GaugeValue, float64(s.Pool.Acquired), name, "acquired")
+		ch <- prometheus.MustNewConstMetric(poolWorkersDesc, prometheus.GaugeValue, float64(s.Pool.Constructing), name, "constructing")
+
+		for _, gauge := range runtimeGauges {
+			ch <- prometheus.MustNewConstMetric(gauge.desc, gauge.typ, gauge.value(s), name)
+		}
+
+		for code, n := range s.Workers.ExitCodes {
+			ch <- prometheus.MustNewConstMetric(workerExitsDesc, prometheus.CounterValue, float64(n), name, code)
+		}
+
+		for signal, n := range s.Workers.ExitSignals {
+			ch <- prometheus.MustNewConstMetric(workerSignalsDesc, prometheus.CounterValue, float64(n), name, signal)
+		}
+
+		histogram := s.AcquireWait.Histogram
+
+		buckets := make(map[float64]uint64, len(histogram.Bounds))
+		for i, bound := range histogram.Bounds {
+			buckets[bound.Seconds()] = histogram.Counts[i]
+		}
+
+		ch <- prometheus.MustNewConstHistogram(queueWaitDesc, uint64(s.AcquireWait.Count), histogram.Sum.Seconds(), buckets, name)
+	}
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.uber.org/zap"
+
+	"github.com/lambda-feedback/shimmy/config"
+	"github.com/lambda-feedback/shimmy/internal/metrics"
+	"github.com/lambda-feedback/shimmy/runtime"
+)
+
+func TestServeHTTP_RecordsMetrics(t *testing.T) {
+	mockHandler := new(MockHandler)
+	mockHandler.On("Handle", mock.Anything, mock.Anything).
+		Return(runtime.Response{StatusCode: http.StatusOK})
+
+	m := metrics.New()
+
+	handler := NewCommandHandler(CommandHandlerParams{
+		Handler:  mockHandler,
+		Config:   config.Config{Auth: config.AuthConfig{Key: "secret"}},
+		Keyring:  newKeyring(t, config.AuthConfig{Key: "secret"}),
+		Metrics:  m,
+		Function: "alpha",
+		Log:      zap.NewNop(),
+	})
+
+	for _, key := range []string{"secret", "wrong"} {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{}`))
+		req.Header.Set("api-key", key)
+		req.Header.Set("command", "preview")
+
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	body := w.Body.String()
+
+	assert.Contains(t, body, `shimmy_requests_total{command="preview",function="alpha",status="200"} 1`)
+	assert.Contains(t, body, `shimmy_requests_total{command="preview",function="alpha",status="401"} 1`)
+	assert.Contains(t, body, `shimmy_request_duration_seconds_count{command="preview",function="alpha",status="200"} 1`)
+}
+
+func TestRuntimeCollector(t *testing.T) {
+	stats := runtime.Stats{}
+	stats.Pool.Max = 4
+	stats.Pool.Idle = 1
+	stats.Pool.Acquired = 3
+	stats.Queue.Depth = 2
+	stats.Workers.Boots = 5
+	stats.Workers.ExitCodes = map[string]int64{"1": 2}
+	stats.Workers.ExitSignals = map[string]int64{"9": 1}
+
+	m := metrics.New()
+	m.Register(NewRuntimeCollector(map[string]runtime.Runtime{
+		"alpha": &stubRuntime{ready: true, stats: stats},
+	}))
+
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	body := w.Body.String()
+
+	assert.Contains(t, body, `shimmy_ready{function="alpha"} 1`)
+	assert.Contains(t, body, `shimmy_pool_workers{function="alpha",state="acquired"} 3`)
+	assert.Contains(t, body, `shimmy_pool_max_workers{function="alpha"} 4`)
+	assert.Contains(t, body, `shimmy_queue_depth{function="alpha"} 2`)
+	assert.Contains(t, body, `shimmy_worker_boots_total{function="alpha"} 5`)
+	assert.Contains(t, body, `shimmy_worker_exits_total{code="1",function="alpha"} 2`)
+	assert.Contains(t, body, `shimmy_worker_signals_total{function="alpha",signal="9"} 1`)
+	assert.Contains(t, body, `shimmy_queue_wait_seconds_count{function="alpha"} 0`)
+}
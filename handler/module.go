@@ -8,5 +8,31 @@ func Module() fx.Option {
 		fx.Provide(NewLegacyRoute),
 		fx.Provide(NewCommandRoute),
 		fx.Provide(NewHealthRoute),
+		fx.Provide(NewReadyRoute),
+		fx.Provide(NewQueueRoute),
+		fx.Provide(NewStatsRoute),
+		fx.Provide(NewMetricsRoute),
+		fx.Provide(NewShadowRoute),
+		fx.Provide(NewInfoRoute),
+		fx.Provide(NewRuntimeDrainer),
+	)
+}
+
+// FunctionsModule provides the handlers for hosting multiple functions.
+func FunctionsModule() fx.Option {
+	return fx.Module("functions",
+		fx.Provide(NewFunctionsHandler),
+		fx.Provide(NewFunctionRoute),
+		fx.Provide(NewFunctionCommandRoute),
+		fx.Provide(NewFunctionReadyRoute),
+		fx.Provide(NewFunctionQueueRoute),
+		fx.Provide(NewFunctionStatsRoute),
+		fx.Provide(NewFunctionInfoRoute),
+		fx.Provide(NewHealthRoute),
+		fx.Provide(NewFunctionsReadyRoute),
+		fx.Provide(NewFunctionsQueueRoute),
+		fx.Provide(NewFunctionsStatsRoute),
+		fx.Provide(NewFunctionsMetricsRoute),
+		fx.Provide(NewFunctionsDrainer),
 	)
 }
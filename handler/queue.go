@@ -0,0 +1,18 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/lambda-feedback/shimmy/runtime"
+)
+
+// NewQueueHandler returns a handler that responds with the number of
+// requests waiting for a worker, e.g. to be used by autoscalers.
+func NewQueueHandler(rt runtime.Runtime) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]int{"depth": rt.QueueDepth()})
+	}
+}
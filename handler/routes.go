@@ -3,17 +3,104 @@ package handler
 import (
 	"net/http"
 
+	"github.com/lambda-feedback/shimmy/internal/metrics"
 	"github.com/lambda-feedback/shimmy/internal/server"
+	"github.com/lambda-feedback/shimmy/runtime"
 )
 
 func NewLegacyRoute(handler *CommandHandler) server.HttpHandlerResult {
-	return server.AsHttpHandler("/", handler)
+	return server.AsCommandHttpHandler("/", handler)
 }
 
+// NewCommandRoute serves requests to any path. Unlike the routes of
+// functions, the command is read from the `command` header only.
 func NewCommandRoute(handler *CommandHandler) server.HttpHandlerResult {
-	return server.AsHttpHandler("/{command}", handler)
+	return server.AsCommandHttpHandler("/{path}", handler)
 }
 
 func NewHealthRoute() server.HttpHandlerResult {
 	return server.AsHttpHandler("/health", http.HandlerFunc(HealthHandler))
 }
+
+func NewReadyRoute(rt runtime.Runtime) server.HttpHandlerResult {
+	return server.AsHttpHandler("/ready", NewReadyHandler(rt))
+}
+
+func NewQueueRoute(rt runtime.Runtime) server.HttpHandlerResult {
+	return server.AsHttpHandler("/queue", NewQueueHandler(rt))
+}
+
+func NewStatsRoute(rt runtime.Runtime) server.HttpHandlerResult {
+	return server.AsHttpHandler("/stats", NewStatsHandler(rt))
+}
+
+func NewMetricsRoute(m *metrics.Metrics, rt runtime.Runtime) server.HttpHandlerResult {
+	m.Register(NewRuntimeCollector(map[string]runtime.Runtime{"": rt}))
+
+	return server.AsHttpHandler("/metrics", m)
+}
+
+func NewShadowRoute(rt runtime.Runtime) server.HttpHandlerResult {
+	return server.AsHttpHandler("/shadow", NewShadowHandler(rt))
+}
+
+func NewInfoRoute(rt runtime.Runtime) server.HttpHandlerResult {
+	return server.AsHttpHandler("/info", NewInfoHandler(rt))
+}
+
+func NewRuntimeDrainer(rt runtime.Runtime) server.DrainerResult {
+	return server.AsDrainer(rt)
+}
+
+// MARK: - Functions
+
+func NewFunctionRoute(handler *FunctionsHandler) server.HttpHandlerResult {
+	return server.AsCommandHttpHandler("/functions/{name}", handler)
+}
+
+func NewFunctionCommandRoute(handler *FunctionsHandler) server.HttpHandlerResult {
+	return server.AsCommandHttpHandler("/functions/{name}/{command}", handler)
+}
+
+func NewFunctionReadyRoute(handler *FunctionsHandler) server.HttpHandlerResult {
+	return server.AsHttpHandler("/functions/{name}/ready", handler.Function(NewReadyHandler))
+}
+
+func NewFunctionQueueRoute(handler *FunctionsHandler) server.HttpHandlerResult {
+	return server.AsHttpHandler("/functions/{name}/queue", handler.Function(NewQueueHandler))
+}
+
+func NewFunctionStatsRoute(handler *FunctionsHandler) server.HttpHandlerResult {
+	return server.AsHttpHandler("/functions/{name}/stats", handler.Function(NewStatsHandler))
+}
+
+func NewFunctionInfoRoute(handler *FunctionsHandler) server.HttpHandlerResult {
+	return server.AsHttpHandler("/functions/{name}/info", handler.Function(NewInfoHandler))
+}
+
+func NewFunctionsReadyRoute(functions runtime.Functions) server.HttpHandlerResult {
+	return server.AsHttpHandler("/ready", NewFunctionsReadyHandler(functions))
+}
+
+func NewFunctionsQueueRoute(functions runtime.Functions) server.HttpHandlerResult {
+	return server.AsHttpHandler("/queue", NewFunctionsQueueHandler(functions))
+}
+
+func NewFunctionsStatsRoute(functions runtime.Functions) server.HttpHandlerResult {
+	return server.AsHttpHandler("/stats", NewFunctionsStatsHandler(functions))
+}
+
+func NewFunctionsMetricsRoute(m *metrics.Metrics, functions runtime.Functions) server.HttpHandlerResult {
+	runtimes := make(map[string]runtime.Runtime, len(functions))
+	for name, fn := range functions {
+		runtimes[name] = fn.Runtime
+	}
+
+	m.Register(NewRuntimeCollector(runtimes))
+
+	return server.AsHttpHandler("/metrics", m)
+}
+
+func NewFunctionsDrainer(functions runtime.Functions) server.DrainerResult {
+	return server.AsDrainer(functions)
+}
@@ -0,0 +1,25 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/lambda-feedback/shimmy/runtime"
+)
+
+// NewShadowHandler returns a handler that responds with the comparison
+// of the primary and shadow versions of the function, if shadow traffic
+// is enabled.
+func NewShadowHandler(rt runtime.Runtime) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		reporter, ok := rt.(runtime.ShadowReporter)
+		if !ok {
+			http.Error(w, "shadow traffic not enabled", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(reporter.ShadowStats())
+	}
+}
@@ -0,0 +1,18 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/lambda-feedback/shimmy/runtime"
+)
+
+// NewStatsHandler returns a handler that responds with the statistics
+// of the workers and queue, e.g. to size the worker pool.
+func NewStatsHandler(rt runtime.Runtime) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(rt.Stats())
+	}
+}
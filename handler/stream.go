@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+
+	"github.com/lambda-feedback/shimmy/runtime"
+)
+
+const eventStreamMediaType = "text/event-stream"
+
+// eventStream writes server-sent events to a streaming-capable client.
+// Progress events are written while the request is handled, followed
+// by a single `result` or `error` event containing the response body.
+type eventStream struct {
+	mu      sync.Mutex
+	w       http.ResponseWriter
+	flusher http.Flusher
+	closed  bool
+	log     *zap.Logger
+}
+
+// newEventStream returns an event stream for the request, if the client
+// accepts server-sent events and the response writer supports flushing.
+func newEventStream(w http.ResponseWriter, r *http.Request, log *zap.Logger) (*eventStream, bool) {
+	if !acceptsEventStream(r) {
+		return nil, false
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, false
+	}
+
+	return &eventStream{
+		w:       w,
+		flusher: flusher,
+		log:     log,
+	}, true
+}
+
+// open writes the response headers, committing to a streaming response.
+func (s *eventStream) open() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.w.Header().Set("Content-Type", eventStreamMediaType)
+	s.w.Header().Set("Cache-Control", "no-cache")
+	s.w.WriteHeader(http.StatusOK)
+	s.flusher.Flush()
+}
+
+// progress writes a progress event. Progress reported after the
+// stream has been closed is dropped.
+func (s *eventStream) progress(progress runtime.Progress) {
+	data, err := json.Marshal(progress)
+	if err != nil {
+		s.log.Debug("failed to marshal progress", zap.Error(err))
+		return
+	}
+
+	s.write("progress", data, false)
+}
+
+// close writes the final event for the response and closes the stream.
+func (s *eventStream) close(response runtime.Response) {
+	event := "result"
+	if response.StatusCode >= http.StatusBadRequest {
+		event = "error"
+	}
+
+	s.write(event, response.Body, true)
+}
+
+func (s *eventStream) write(event string, data []byte, last bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+
+	s.closed = last
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "event: %s\n", event)
+	for _, line := range strings.Split(string(data), "\n") {
+		fmt.Fprintf(&buf, "data: %s\n", line)
+	}
+	buf.WriteString("\n")
+
+	if _, err := s.w.Write(buf.Bytes()); err != nil {
+		s.log.Debug("failed to write event", zap.String("event", event), zap.Error(err))
+		return
+	}
+
+	s.flusher.Flush()
+}
+
+// acceptsEventStream returns true if the client accepts server-sent events.
+func acceptsEventStream(r *http.Request) bool {
+	for _, accept := range r.Header.Values("Accept") {
+		for _, part := range strings.Split(accept, ",") {
+			mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err == nil && mediaType == eventStreamMediaType {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,255 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// SignatureHeader holds the signature of a request or response.
+	SignatureHeader = "shimmy-signature"
+
+	// TimestampHeader holds the unix time a request or response was
+	// signed at, in seconds.
+	TimestampHeader = "shimmy-timestamp"
+
+	// NonceHeader holds a unique value of each signed request.
+	NonceHeader = "shimmy-nonce"
+)
+
+// defaultSignatureWindow is the default duration a signed request is
+// valid for, before and after its timestamp.
+const defaultSignatureWindow = 5 * time.Minute
+
+type HMACConfig struct {
+	// Secret is the secret shared with the callers, used to sign
+	// requests and responses. If empty, signed requests are not
+	// accepted.
+	Secret string `conf:"secret"`
+
+	// Window is the duration a signed request is valid for, before
+	// and after its timestamp. Default is 5m.
+	Window time.Duration `conf:"window"`
+
+	// SignResponses signs the responses to signed requests, so callers
+	// can verify the results came from the shim.
+	SignResponses bool `conf:"sign_responses"`
+}
+
+// Enabled returns true if signed requests are accepted.
+func (c HMACConfig) Enabled() bool {
+	return c.Secret != ""
+}
+
+// Signer verifies requests signed using a shared secret, and signs the
+// responses. All methods are safe to call on a nil instance, which
+// accepts no signed request.
+//
+// Requests are signed by computing the hex encoded HMAC-SHA256 of
+//
+//	METHOD\nREQUEST-URI\nCOMMAND\nTIMESTAMP\nNONCE\nSHA256(BODY)
+//
+// where COMMAND is the `command` header, or empty, and SHA256(BODY)
+// is hex encoded. Each nonce is accepted once while its timestamp is
+// within the window, so captured requests can't be replayed.
+type Signer struct {
+	secret        []byte
+	window        time.Duration
+	signResponses bool
+
+	nonces *nonceCache
+
+	// now returns the current time, to check the timestamps
+	now func() time.Time
+}
+
+// NewSigner creates a signer for the config. It returns nil if signed
+// requests are not accepted.
+func NewSigner(config Config) *Signer {
+	hmacConfig := config.HMAC
+	if !hmacConfig.Enabled() {
+		return nil
+	}
+
+	window := hmacConfig.Window
+	if window <= 0 {
+		window = defaultSignatureWindow
+	}
+
+	return &Signer{
+		secret:        []byte(hmacConfig.Secret),
+		window:        window,
+		signResponses: hmacConfig.SignResponses,
+		nonces:        newNonceCache(),
+		now:           time.Now,
+	}
+}
+
+// Enabled returns true if signed requests are accepted.
+func (s *Signer) Enabled() bool {
+	return s != nil
+}
+
+// SignsResponses returns true if responses to signed requests are
+// signed.
+func (s *Signer) SignsResponses() bool {
+	return s != nil && s.signResponses
+}
+
+// IsSigned returns true if the request carries a signature.
+func IsSigned(r *http.Request) bool {
+	return r.Header.Get(SignatureHeader) != ""
+}
+
+// SignRequest sets the signature headers of the request, e.g. in
+// clients. The nonce must be unique for each request.
+func (s *Signer) SignRequest(r *http.Request, body []byte, nonce string) {
+	timestamp := strconv.FormatInt(s.now().Unix(), 10)
+
+	r.Header.Set(TimestampHeader, timestamp)
+	r.Header.Set(NonceHeader, nonce)
+	r.Header.Set(SignatureHeader, s.sign(requestPayload(r, timestamp, nonce, body)))
+}
+
+// VerifyRequest verifies the signature of the request, and that it
+// was not sent before.
+func (s *Signer) VerifyRequest(r *http.Request, body []byte) error {
+	if s == nil {
+		return errors.New("signed requests are not accepted")
+	}
+
+	timestamp := r.Header.Get(TimestampHeader)
+	nonce := r.Header.Get(NonceHeader)
+	if timestamp == "" || nonce == "" {
+		return errors.New("signed request has no timestamp or nonce")
+	}
+
+	signedAt, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid signature timestamp '%s'", timestamp)
+	}
+
+	now := s.now()
+	if age := now.Sub(time.Unix(signedAt, 0)); age > s.window || age < -s.window {
+		return fmt.Errorf("signature timestamp is outside the window of %s", s.window)
+	}
+
+	signature, err := hex.DecodeString(r.Header.Get(SignatureHeader))
+	if err != nil {
+		return errors.New("invalid signature encoding")
+	}
+
+	expected, _ := hex.DecodeString(s.sign(requestPayload(r, timestamp, nonce, body)))
+	if !hmac.Equal(signature, expected) {
+		return errors.New("invalid signature")
+	}
+
+	// only remember the nonces of valid requests, so forged requests
+	// can't fill the cache
+	if !s.nonces.add(nonce, time.Unix(signedAt, 0).Add(s.window), now) {
+		return errors.New("nonce was already used")
+	}
+
+	return nil
+}
+
+// SignResponse sets the signature headers of the response to the
+// request with the nonce.
+func (s *Signer) SignResponse(header http.Header, status int, nonce string, body []byte) {
+	timestamp := strconv.FormatInt(s.now().Unix(), 10)
+
+	header.Set(TimestampHeader, timestamp)
+	header.Set(SignatureHeader, s.sign(responsePayload(status, timestamp, nonce, body)))
+}
+
+// VerifyResponse verifies the signature of the response to the request
+// with the nonce, e.g. in clients.
+func (s *Signer) VerifyResponse(header http.Header, status int, nonce string, body []byte) error {
+	signature, err := hex.DecodeString(header.Get(SignatureHeader))
+	if err != nil {
+		return errors.New("invalid signature encoding")
+	}
+
+	expected, _ := hex.DecodeString(s.sign(responsePayload(status, header.Get(TimestampHeader), nonce, body)))
+	if !hmac.Equal(signature, expected) {
+		return errors.New("invalid signature")
+	}
+
+	return nil
+}
+
+func (s *Signer) sign(payload string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func requestPayload(r *http.Request, timestamp, nonce string, body []byte) string {
+	return strings.Join([]string{
+		r.Method,
+		r.URL.RequestURI(),
+		r.Header.Get("command"),
+		timestamp,
+		nonce,
+		bodyHash(body),
+	}, "\n")
+}
+
+func responsePayload(status int, timestamp, nonce string, body []byte) string {
+	return strings.Join([]string{
+		strconv.Itoa(status),
+		timestamp,
+		nonce,
+		bodyHash(body),
+	}, "\n")
+}
+
+func bodyHash(body []byte) string {
+	hash := sha256.Sum256(body)
+	return hex.EncodeToString(hash[:])
+}
+
+// nonceCache remembers the nonces of signed requests until their
+// signature expires.
+type nonceCache struct {
+	mu      sync.Mutex
+	expires map[string]time.Time
+
+	// nextPrune is the time expired nonces are removed next
+	nextPrune time.Time
+}
+
+func newNonceCache() *nonceCache {
+	return &nonceCache{expires: make(map[string]time.Time)}
+}
+
+// add adds the nonce, and returns false if it is already known.
+func (c *nonceCache) add(nonce string, expires, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if now.After(c.nextPrune) {
+		for n, e := range c.expires {
+			if now.After(e) {
+				delete(c.expires, n)
+			}
+		}
+
+		c.nextPrune = now.Add(time.Minute)
+	}
+
+	if e, ok := c.expires[nonce]; ok && !now.After(e) {
+		return false
+	}
+
+	c.expires[nonce] = expires
+	return true
+}
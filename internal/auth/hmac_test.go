@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestSigner(t *testing.T, secret string) *Signer {
+	s := NewSigner(Config{HMAC: HMACConfig{Secret: secret, Window: time.Minute}})
+	require.True(t, s.Enabled())
+
+	return s
+}
+
+func newSignedRequest(s *Signer, body, nonce string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/eval?x=1", strings.NewReader(body))
+	r.Header.Set("command", "eval")
+	s.SignRequest(r, []byte(body), nonce)
+
+	return r
+}
+
+func TestSigner_VerifyRequest(t *testing.T) {
+	s := newTestSigner(t, "secret")
+
+	r := newSignedRequest(s, `{"response": 1}`, "nonce-1")
+	assert.True(t, IsSigned(r))
+	assert.NoError(t, s.VerifyRequest(r, []byte(`{"response": 1}`)))
+
+	// the same request can't be replayed
+	assert.ErrorContains(t, s.VerifyRequest(r, []byte(`{"response": 1}`)), "nonce was already used")
+}
+
+func TestSigner_RejectsTamperedRequests(t *testing.T) {
+	s := newTestSigner(t, "secret")
+	body := []byte(`{"response": 1}`)
+
+	for name, tamper := range map[string]func(r *http.Request) []byte{
+		"body":    func(r *http.Request) []byte { return []byte(`{"response": 2}`) },
+		"path":    func(r *http.Request) []byte { r.URL.Path = "/preview"; return body },
+		"query":   func(r *http.Request) []byte { r.URL.RawQuery = "x=2"; return body },
+		"method":  func(r *http.Request) []byte { r.Method = http.MethodPut; return body },
+		"command": func(r *http.Request) []byte { r.Header.Set("command", "preview"); return body },
+		"nonce":   func(r *http.Request) []byte { r.Header.Set(NonceHeader, "other"); return body },
+		"signature": func(r *http.Request) []byte {
+			r.Header.Set(SignatureHeader, strings.Repeat("0", 64))
+			return body
+		},
+	} {
+		r := newSignedRequest(s, string(body), "nonce-"+name)
+		tampered := tamper(r)
+
+		assert.ErrorContains(t, s.VerifyRequest(r, tampered), "invalid signature", name)
+	}
+
+	// requests signed using another secret
+	r := newSignedRequest(newTestSigner(t, "other"), string(body), "nonce-other")
+	assert.ErrorContains(t, s.VerifyRequest(r, body), "invalid signature")
+}
+
+func TestSigner_TimestampWindow(t *testing.T) {
+	s := newTestSigner(t, "secret")
+	now := time.Now()
+
+	for offset, valid := range map[time.Duration]bool{
+		0:                 true,
+		-50 * time.Second: true,
+		50 * time.Second:  true,
+		-2 * time.Minute:  false,
+		2 * time.Minute:   false,
+	} {
+		s.now = func() time.Time { return now.Add(offset) }
+		r := newSignedRequest(s, "{}", "nonce-"+offset.String())
+
+		s.now = func() time.Time { return now }
+		err := s.VerifyRequest(r, []byte("{}"))
+
+		if valid {
+			assert.NoError(t, err, offset)
+		} else {
+			assert.ErrorContains(t, err, "outside the window", offset)
+		}
+	}
+
+	r := newSignedRequest(s, "{}", "nonce")
+	r.Header.Del(TimestampHeader)
+	assert.ErrorContains(t, s.VerifyRequest(r, []byte("{}")), "no timestamp or nonce")
+}
+
+func TestSigner_ForgetsExpiredNonces(t *testing.T) {
+	s := newTestSigner(t, "secret")
+	now := time.Now()
+	s.now = func() time.Time { return now }
+
+	require.NoError(t, s.VerifyRequest(newSignedRequest(s, "{}", "nonce"), []byte("{}")))
+
+	// once the first request expired, the nonce may be used again
+	now = now.Add(3 * time.Minute)
+	require.NoError(t, s.VerifyRequest(newSignedRequest(s, "{}", "nonce"), []byte("{}")))
+	assert.Len(t, s.nonces.expires, 1)
+}
+
+func TestSigner_SignResponse(t *testing.T) {
+	s := newTestSigner(t, "secret")
+
+	header := make(http.Header)
+	s.SignResponse(header, http.StatusOK, "nonce", []byte(`{"is_correct": true}`))
+
+	assert.NoError(t, s.VerifyResponse(header, http.StatusOK, "nonce", []byte(`{"is_correct": true}`)))
+	assert.Error(t, s.VerifyResponse(header, http.StatusOK, "nonce", []byte(`{"is_correct": false}`)))
+	assert.Error(t, s.VerifyResponse(header, http.StatusOK, "other", []byte(`{"is_correct": true}`)))
+	assert.Error(t, s.VerifyResponse(header, http.StatusBadRequest, "nonce", []byte(`{"is_correct": true}`)))
+}
+
+func TestSigner_Disabled(t *testing.T) {
+	s := NewSigner(Config{})
+	assert.False(t, s.Enabled())
+	assert.False(t, s.SignsResponses())
+	assert.Error(t, s.VerifyRequest(httptest.NewRequest(http.MethodPost, "/", nil), nil))
+}
@@ -0,0 +1,347 @@
+package auth
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultTenantClaim is the default claim holding the tenant.
+	defaultTenantClaim = "tenant"
+
+	// defaultUserClaim is the default claim holding the user.
+	defaultUserClaim = "sub"
+)
+
+// signatureAlgorithms are the algorithms tokens may be signed with.
+// Only asymmetric algorithms are accepted, so the shim never holds a
+// secret that can issue tokens.
+var signatureAlgorithms = []jose.SignatureAlgorithm{
+	jose.RS256, jose.RS384, jose.RS512,
+	jose.PS256, jose.PS384, jose.PS512,
+	jose.ES256, jose.ES384, jose.ES512,
+	jose.EdDSA,
+}
+
+type JWTConfig struct {
+	// JWKSFile is the path to a JSON Web Key Set holding the public
+	// keys tokens are verified against. The file is re-read when it
+	// changes, so keys can be rotated without a restart.
+	JWKSFile string `conf:"jwks_file"`
+
+	// PublicKeyFile is the path to a PEM encoded public key or
+	// certificate tokens are verified against, as an alternative to
+	// JWKSFile.
+	PublicKeyFile string `conf:"public_key_file"`
+
+	// Issuer is the expected `iss` claim of tokens, if set.
+	Issuer string `conf:"issuer"`
+
+	// Audience is the expected `aud` claim of tokens, if set.
+	Audience string `conf:"audience"`
+
+	// ClockSkew is the tolerated difference between the clocks of the
+	// issuer and the shim, when checking the time based claims.
+	ClockSkew time.Duration `conf:"clock_skew"`
+
+	// TenantClaim is the claim holding the tenant. Default is `tenant`.
+	TenantClaim string `conf:"tenant_claim"`
+
+	// UserClaim is the claim holding the user. Default is `sub`.
+	UserClaim string `conf:"user_claim"`
+}
+
+// Enabled returns true if bearer tokens are accepted.
+func (c JWTConfig) Enabled() bool {
+	return c.JWKSFile != "" || c.PublicKeyFile != ""
+}
+
+// Identity is the verified identity of a client, taken from the claims
+// of its token.
+type Identity struct {
+	// Subject is the `sub` claim of the token.
+	Subject string
+
+	// Tenant is the tenant of the client, if the token has one.
+	Tenant string
+
+	// User is the user of the client, if the token has one.
+	User string
+}
+
+type identityKey struct{}
+
+// ContextWithIdentity returns a context that carries the identity.
+func ContextWithIdentity(ctx context.Context, identity Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// IdentityFromContext returns the identity in ctx, if any.
+func IdentityFromContext(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(Identity)
+	return identity, ok
+}
+
+// BearerToken returns the token of the `Authorization: Bearer` header.
+func BearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "bearer") {
+		return "", false
+	}
+
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// Verifier verifies bearer tokens against local public keys, without
+// contacting the issuer. All methods are safe to call on a nil
+// instance, which accepts no token.
+type Verifier struct {
+	config   JWTConfig
+	keys     atomic.Pointer[jose.JSONWebKeySet]
+	stamp    fileStamp
+	interval time.Duration
+
+	// now returns the current time, to check the time based claims
+	now func() time.Time
+
+	log *zap.Logger
+}
+
+// NewVerifier creates a verifier for the config, and reads the keys.
+// It returns nil if bearer tokens are not accepted.
+func NewVerifier(config Config, log *zap.Logger) (*Verifier, error) {
+	jwtConfig := config.JWT
+	if !jwtConfig.Enabled() {
+		return nil, nil
+	}
+
+	if jwtConfig.JWKSFile != "" && jwtConfig.PublicKeyFile != "" {
+		return nil, errors.New("auth: either a JWKS file or a public key file may be set, not both")
+	}
+
+	if jwtConfig.TenantClaim == "" {
+		jwtConfig.TenantClaim = defaultTenantClaim
+	}
+
+	if jwtConfig.UserClaim == "" {
+		jwtConfig.UserClaim = defaultUserClaim
+	}
+
+	interval := config.ReloadInterval
+	if interval <= 0 {
+		interval = defaultReloadInterval
+	}
+
+	v := &Verifier{
+		config:   jwtConfig,
+		interval: interval,
+		now:      time.Now,
+		log:      log.Named("auth"),
+	}
+
+	if _, err := v.reload(); err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// Enabled returns true if bearer tokens are accepted.
+func (v *Verifier) Enabled() bool {
+	return v != nil
+}
+
+// Verify verifies the signature and claims of the token, and returns
+// the identity of the client.
+func (v *Verifier) Verify(token string) (Identity, error) {
+	if v == nil {
+		return Identity{}, errors.New("bearer tokens are not accepted")
+	}
+
+	parsed, err := jwt.ParseSigned(token, signatureAlgorithms)
+	if err != nil {
+		return Identity{}, fmt.Errorf("invalid token: %w", err)
+	}
+
+	var (
+		claims jwt.Claims
+		extra  map[string]any
+	)
+
+	if err := v.claims(parsed, &claims, &extra); err != nil {
+		return Identity{}, err
+	}
+
+	if claims.Expiry == nil {
+		return Identity{}, errors.New("token has no expiry")
+	}
+
+	expected := jwt.Expected{Issuer: v.config.Issuer, Time: v.now()}
+	if v.config.Audience != "" {
+		expected.AnyAudience = jwt.Audience{v.config.Audience}
+	}
+
+	if err := claims.ValidateWithLeeway(expected, v.config.ClockSkew); err != nil {
+		return Identity{}, err
+	}
+
+	return Identity{
+		Subject: claims.Subject,
+		Tenant:  stringClaim(extra, v.config.TenantClaim),
+		User:    stringClaim(extra, v.config.UserClaim),
+	}, nil
+}
+
+// claims verifies the signature of the token using the key it names,
+// or any key if it names none, and decodes its claims.
+func (v *Verifier) claims(token *jwt.JSONWebToken, dest ...any) error {
+	keys := v.keys.Load()
+
+	candidates := keys.Keys
+	if kid := token.Headers[0].KeyID; kid != "" {
+		candidates = keys.Key(kid)
+	}
+
+	for _, key := range candidates {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+
+		if err := token.Claims(key.Public(), dest...); err == nil {
+			return nil
+		}
+	}
+
+	return errors.New("invalid token signature")
+}
+
+// stringClaim returns the claim, if it is a string.
+func stringClaim(claims map[string]any, name string) string {
+	value, _ := claims[name].(string)
+	return value
+}
+
+// file returns the path of the file holding the keys.
+func (v *Verifier) file() string {
+	if v.config.JWKSFile != "" {
+		return v.config.JWKSFile
+	}
+
+	return v.config.PublicKeyFile
+}
+
+// reload reads the keys, if the file changed since it was last read. If
+// reading fails, the previously read keys are kept.
+func (v *Verifier) reload() (bool, error) {
+	info, err := os.Stat(v.file())
+	if err != nil {
+		return false, fmt.Errorf("auth: %w", err)
+	}
+
+	stamp := fileStamp{modTime: info.ModTime(), size: info.Size()}
+	if stamp == v.stamp {
+		return false, nil
+	}
+
+	data, err := os.ReadFile(v.file())
+	if err != nil {
+		return false, fmt.Errorf("auth: failed to read token keys: %w", err)
+	}
+
+	var keys *jose.JSONWebKeySet
+	if v.config.JWKSFile != "" {
+		keys, err = parseJWKS(data)
+	} else {
+		keys, err = parsePublicKey(data)
+	}
+	if err != nil {
+		return false, fmt.Errorf("auth: %w", err)
+	}
+
+	v.keys.Store(keys)
+	v.stamp = stamp
+
+	return true, nil
+}
+
+func parseJWKS(data []byte) (*jose.JSONWebKeySet, error) {
+	var keys jose.JSONWebKeySet
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("failed to parse JWKS file: %w", err)
+	}
+
+	// symmetric keys have no public part, so they are rejected as well
+	for _, key := range keys.Keys {
+		if public := key.Public(); !public.Valid() {
+			return nil, fmt.Errorf("JWKS file holds an invalid key '%s'", key.KeyID)
+		}
+	}
+
+	return &keys, nil
+}
+
+func parsePublicKey(data []byte) (*jose.JSONWebKeySet, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("public key file holds no PEM block")
+	}
+
+	var key any
+	switch block.Type {
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate: %w", err)
+		}
+		key = cert.PublicKey
+	default:
+		var err error
+		if key, err = x509.ParsePKIXPublicKey(block.Bytes); err != nil {
+			return nil, fmt.Errorf("failed to parse public key: %w", err)
+		}
+	}
+
+	return &jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{Key: key, Use: "sig"}}}, nil
+}
+
+// Watch re-reads the keys periodically, until ctx is done.
+func (v *Verifier) Watch(ctx context.Context) {
+	if v == nil {
+		return
+	}
+
+	ticker := time.NewTicker(v.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		reloaded, err := v.reload()
+		if err != nil {
+			v.log.Error("failed to reload token keys, keeping previous", zap.Error(err))
+			continue
+		}
+
+		if reloaded {
+			v.log.Info("reloaded token keys", zap.Int("count", len(v.keys.Load().Keys)))
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// testIssuer signs tokens for tests.
+type testIssuer struct {
+	kid string
+	alg jose.SignatureAlgorithm
+	key any
+}
+
+func newTestIssuer(t *testing.T, kid string) *testIssuer {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	return &testIssuer{kid: kid, alg: jose.ES256, key: key}
+}
+
+// jwk returns the public key of the issuer.
+func (i *testIssuer) jwk() jose.JSONWebKey {
+	key := jose.JSONWebKey{Key: i.key, KeyID: i.kid, Algorithm: string(i.alg), Use: "sig"}
+	return key.Public()
+}
+
+func (i *testIssuer) sign(t *testing.T, claims jwt.Claims, extra map[string]any) string {
+	opts := (&jose.SignerOptions{}).WithType("JWT")
+	if i.kid != "" {
+		opts = opts.WithHeader("kid", i.kid)
+	}
+
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: i.alg, Key: i.key}, opts)
+	require.NoError(t, err)
+
+	token, err := jwt.Signed(signer).Claims(claims).Claims(extra).Serialize()
+	require.NoError(t, err)
+
+	return token
+}
+
+func writeJWKS(t *testing.T, path string, modTime time.Time, issuers ...*testIssuer) {
+	var keys jose.JSONWebKeySet
+	for _, issuer := range issuers {
+		keys.Keys = append(keys.Keys, issuer.jwk())
+	}
+
+	data, err := json.Marshal(keys)
+	require.NoError(t, err)
+
+	writeKeysFile(t, path, string(data), modTime)
+}
+
+// validClaims returns claims accepted by the verifier of newTestVerifier.
+func validClaims() jwt.Claims {
+	return jwt.Claims{
+		Subject:  "user-1",
+		Issuer:   "https://auth.example.com",
+		Audience: jwt.Audience{"shimmy"},
+		Expiry:   jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}
+}
+
+func newTestVerifier(t *testing.T, issuers ...*testIssuer) (*Verifier, string) {
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, path, time.Now().Add(-time.Minute), issuers...)
+
+	v, err := NewVerifier(Config{JWT: JWTConfig{
+		JWKSFile:  path,
+		Issuer:    "https://auth.example.com",
+		Audience:  "shimmy",
+		ClockSkew: time.Minute,
+	}}, zap.NewNop())
+	require.NoError(t, err)
+	require.True(t, v.Enabled())
+
+	return v, path
+}
+
+func TestVerifier_Verify(t *testing.T) {
+	current, next := newTestIssuer(t, "current"), newTestIssuer(t, "next")
+	v, _ := newTestVerifier(t, current, next)
+
+	for _, issuer := range []*testIssuer{current, next} {
+		identity, err := v.Verify(issuer.sign(t, validClaims(), map[string]any{"tenant": "course-1"}))
+		require.NoError(t, err, issuer.kid)
+		assert.Equal(t, Identity{Subject: "user-1", Tenant: "course-1", User: "user-1"}, identity)
+	}
+
+	// tokens without a key id are verified against all keys
+	anonymous := &testIssuer{alg: next.alg, key: next.key}
+	_, err := v.Verify(anonymous.sign(t, validClaims(), nil))
+	assert.NoError(t, err)
+}
+
+func TestVerifier_ClaimNames(t *testing.T) {
+	issuer := newTestIssuer(t, "current")
+	v, _ := newTestVerifier(t, issuer)
+	v.config.TenantClaim = "org"
+	v.config.UserClaim = "email"
+
+	identity, err := v.Verify(issuer.sign(t, validClaims(), map[string]any{
+		"org":    "org-1",
+		"email":  "user@example.com",
+		"tenant": "ignored",
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, Identity{Subject: "user-1", Tenant: "org-1", User: "user@example.com"}, identity)
+}
+
+func TestVerifier_RejectsInvalidTokens(t *testing.T) {
+	issuer := newTestIssuer(t, "current")
+	v, _ := newTestVerifier(t, issuer)
+
+	withClaims := func(modify func(*jwt.Claims)) string {
+		claims := validClaims()
+		modify(&claims)
+		return issuer.sign(t, claims, nil)
+	}
+
+	impostor := newTestIssuer(t, "current")
+
+	hmac, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.HS256, Key: []byte("0123456789abcdef0123456789abcdef")}, nil)
+	require.NoError(t, err)
+	symmetric, err := jwt.Signed(hmac).Claims(validClaims()).Serialize()
+	require.NoError(t, err)
+
+	for name, token := range map[string]string{
+		"malformed":        "not.a.token",
+		"unknown key":      (&testIssuer{kid: "unknown", alg: issuer.alg, key: issuer.key}).sign(t, validClaims(), nil),
+		"forged signature": impostor.sign(t, validClaims(), nil),
+		"symmetric":        symmetric,
+		"expired": withClaims(func(c *jwt.Claims) {
+			c.Expiry = jwt.NewNumericDate(time.Now().Add(-2 * time.Minute))
+		}),
+		"not yet valid": withClaims(func(c *jwt.Claims) {
+			c.NotBefore = jwt.NewNumericDate(time.Now().Add(2 * time.Minute))
+		}),
+		"no expiry":      withClaims(func(c *jwt.Claims) { c.Expiry = nil }),
+		"wrong issuer":   withClaims(func(c *jwt.Claims) { c.Issuer = "https://evil.example.com" }),
+		"wrong audience": withClaims(func(c *jwt.Claims) { c.Audience = jwt.Audience{"other"} }),
+	} {
+		_, err := v.Verify(token)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestVerifier_ToleratesClockSkew(t *testing.T) {
+	issuer := newTestIssuer(t, "current")
+	v, _ := newTestVerifier(t, issuer)
+
+	claims := validClaims()
+	claims.Expiry = jwt.NewNumericDate(time.Now().Add(-30 * time.Second))
+
+	_, err := v.Verify(issuer.sign(t, claims, nil))
+	assert.NoError(t, err)
+}
+
+func TestVerifier_PublicKeyFile(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	der, err := x509.MarshalPKIXPublicKey(public)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "key.pem")
+	writeKeysFile(t, path, string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})), time.Now())
+
+	v, err := NewVerifier(Config{JWT: JWTConfig{PublicKeyFile: path}}, zap.NewNop())
+	require.NoError(t, err)
+
+	issuer := &testIssuer{alg: jose.EdDSA, key: private}
+
+	identity, err := v.Verify(issuer.sign(t, validClaims(), nil))
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", identity.User)
+}
+
+func TestVerifier_ReloadsJWKS(t *testing.T) {
+	current, next := newTestIssuer(t, "current"), newTestIssuer(t, "next")
+	v, path := newTestVerifier(t, current)
+
+	_, err := v.Verify(next.sign(t, validClaims(), nil))
+	assert.Error(t, err)
+
+	writeJWKS(t, path, time.Now(), next)
+
+	reloaded, err := v.reload()
+	require.NoError(t, err)
+	assert.True(t, reloaded)
+
+	_, err = v.Verify(next.sign(t, validClaims(), nil))
+	assert.NoError(t, err)
+
+	_, err = v.Verify(current.sign(t, validClaims(), nil))
+	assert.Error(t, err)
+
+	// invalid files keep the previous keys
+	writeKeysFile(t, path, `{"keys": [{"kty": "oct", "k": "c2VjcmV0"}]}`, time.Now().Add(time.Minute))
+
+	_, err = v.reload()
+	assert.ErrorContains(t, err, "invalid key")
+
+	_, err = v.Verify(next.sign(t, validClaims(), nil))
+	assert.NoError(t, err)
+}
+
+func TestVerifier_Disabled(t *testing.T) {
+	v, err := NewVerifier(Config{}, zap.NewNop())
+	require.NoError(t, err)
+	assert.False(t, v.Enabled())
+
+	_, err = v.Verify("token")
+	assert.Error(t, err)
+
+	_, err = NewVerifier(Config{JWT: JWTConfig{JWKSFile: "a.json", PublicKeyFile: "b.pem"}}, zap.NewNop())
+	assert.ErrorContains(t, err, "not both")
+}
@@ -0,0 +1,245 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// defaultReloadInterval is the default interval to check the keys
+// file for changes.
+const defaultReloadInterval = 10 * time.Second
+
+// defaultKeyLabel is the label of the key set using Config.Key.
+const defaultKeyLabel = "default"
+
+type Config struct {
+	// Key is the secret key for the application
+	Key string `conf:"key"`
+
+	// Keys are API keys accepted in addition to Key, e.g. declared
+	// in the config file
+	Keys []Key `conf:"keys"`
+
+	// KeysFile is the path to a JSON file holding a list of API keys,
+	// accepted in addition to Key and Keys. The file is re-read when
+	// it changes, so keys can be rotated without a restart.
+	KeysFile string `conf:"keys_file"`
+
+	// ReloadInterval is the interval to check the keys file and the
+	// token keys for changes. Default is 10s.
+	ReloadInterval time.Duration `conf:"reload_interval"`
+
+	// JWT configures bearer tokens, accepted as an alternative to keys
+	JWT JWTConfig `conf:"jwt"`
+
+	// HMAC configures signed requests, accepted as an alternative to
+	// keys
+	HMAC HMACConfig `conf:"hmac"`
+}
+
+// Key is an API key, sent by clients in the `api-key` header.
+type Key struct {
+	// Label identifies the key in logs, e.g. `frontend`. It must not
+	// be secret.
+	Label string `conf:"label" json:"label"`
+
+	// Key is the secret value of the key.
+	Key string `conf:"key" json:"key"`
+
+	// Commands are the commands the key may call, e.g. `preview`.
+	// Default is all commands.
+	Commands []string `conf:"commands" json:"commands,omitempty"`
+}
+
+// Allows returns true if the key may call the command.
+func (k Key) Allows(command string) bool {
+	return len(k.Commands) == 0 || slices.Contains(k.Commands, command)
+}
+
+// keyEntry is a key, along with the hash of its secret. Secrets are
+// compared by hash, so the time taken does not depend on their length.
+type keyEntry struct {
+	key  Key
+	hash [sha256.Size]byte
+}
+
+// fileStamp identifies the version of a file.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// Keyring holds the API keys accepted by the application. All methods
+// are safe to call on a nil instance, which accepts any request.
+type Keyring struct {
+	// static are the keys set in the config
+	static []keyEntry
+
+	// file holds the keys read from the keys file, if any
+	file     string
+	fileKeys atomic.Pointer[[]keyEntry]
+	stamp    fileStamp
+	interval time.Duration
+
+	log *zap.Logger
+}
+
+// NewKeyring creates a keyring holding the keys of the config, and
+// reads the keys file, if any.
+func NewKeyring(config Config, log *zap.Logger) (*Keyring, error) {
+	keys := slices.Clone(config.Keys)
+	if config.Key != "" {
+		keys = append([]Key{{Label: defaultKeyLabel, Key: config.Key}}, keys...)
+	}
+
+	static, err := newKeyEntries(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	interval := config.ReloadInterval
+	if interval <= 0 {
+		interval = defaultReloadInterval
+	}
+
+	k := &Keyring{
+		static:   static,
+		file:     config.KeysFile,
+		interval: interval,
+		log:      log.Named("auth"),
+	}
+
+	if k.file != "" {
+		if _, err := k.reload(); err != nil {
+			return nil, err
+		}
+	}
+
+	return k, nil
+}
+
+func newKeyEntries(keys []Key) ([]keyEntry, error) {
+	entries := make([]keyEntry, len(keys))
+
+	for i, key := range keys {
+		if key.Key == "" {
+			return nil, fmt.Errorf("auth: key %d (%s) has no secret", i, key.Label)
+		}
+
+		if key.Label == "" {
+			key.Label = fmt.Sprintf("key-%d", i)
+		}
+
+		entries[i] = keyEntry{key: key, hash: sha256.Sum256([]byte(key.Key))}
+	}
+
+	return entries, nil
+}
+
+// Enabled returns true if requests must authenticate using a key. If
+// a keys file is configured, requests are authenticated even if the
+// file holds no keys.
+func (k *Keyring) Enabled() bool {
+	return k != nil && (len(k.static) > 0 || k.file != "")
+}
+
+// Authenticate returns the key matching the secret. All keys are
+// compared in constant time, regardless of which key matches.
+func (k *Keyring) Authenticate(secret string) (Key, bool) {
+	if k == nil {
+		return Key{}, false
+	}
+
+	hash := sha256.Sum256([]byte(secret))
+
+	var match *Key
+	compare := func(entries []keyEntry) {
+		for i := range entries {
+			if subtle.ConstantTimeCompare(hash[:], entries[i].hash[:]) == 1 && match == nil {
+				match = &entries[i].key
+			}
+		}
+	}
+
+	compare(k.static)
+	if fileKeys := k.fileKeys.Load(); fileKeys != nil {
+		compare(*fileKeys)
+	}
+
+	if match == nil {
+		return Key{}, false
+	}
+
+	return *match, true
+}
+
+// reload reads the keys file, if it changed since it was last read. If
+// reading fails, the previously read keys are kept.
+func (k *Keyring) reload() (bool, error) {
+	info, err := os.Stat(k.file)
+	if err != nil {
+		return false, fmt.Errorf("auth: %w", err)
+	}
+
+	stamp := fileStamp{modTime: info.ModTime(), size: info.Size()}
+	if stamp == k.stamp {
+		return false, nil
+	}
+
+	data, err := os.ReadFile(k.file)
+	if err != nil {
+		return false, fmt.Errorf("auth: failed to read keys file: %w", err)
+	}
+
+	var keys []Key
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return false, fmt.Errorf("auth: failed to parse keys file: %w", err)
+	}
+
+	entries, err := newKeyEntries(keys)
+	if err != nil {
+		return false, err
+	}
+
+	k.fileKeys.Store(&entries)
+	k.stamp = stamp
+
+	return true, nil
+}
+
+// Watch re-reads the keys file periodically, until ctx is done.
+func (k *Keyring) Watch(ctx context.Context) {
+	if k == nil || k.file == "" {
+		return
+	}
+
+	ticker := time.NewTicker(k.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		reloaded, err := k.reload()
+		if err != nil {
+			k.log.Error("failed to reload keys, keeping previous", zap.Error(err))
+			continue
+		}
+
+		if reloaded {
+			k.log.Info("reloaded keys", zap.Int("count", len(*k.fileKeys.Load())))
+		}
+	}
+}
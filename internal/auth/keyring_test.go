@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// writeKeysFile writes the file, and moves its modification time
+// forward, so the change is detected regardless of the file system.
+func writeKeysFile(t *testing.T, path, data string, modTime time.Time) {
+	require.NoError(t, os.WriteFile(path, []byte(data), 0600))
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+func TestKeyring_Authenticate(t *testing.T) {
+	k, err := NewKeyring(Config{
+		Key: "legacy",
+		Keys: []Key{
+			{Label: "current", Key: "new-secret"},
+			{Key: "old-secret"},
+		},
+	}, zap.NewNop())
+	require.NoError(t, err)
+	assert.True(t, k.Enabled())
+
+	for secret, label := range map[string]string{
+		"legacy":     "default",
+		"new-secret": "current",
+		"old-secret": "key-2",
+	} {
+		key, ok := k.Authenticate(secret)
+		require.True(t, ok, secret)
+		assert.Equal(t, label, key.Label)
+	}
+
+	for _, secret := range []string{"", "new", "new-secret-", "LEGACY"} {
+		_, ok := k.Authenticate(secret)
+		assert.False(t, ok, secret)
+	}
+}
+
+func TestKeyring_Disabled(t *testing.T) {
+	k, err := NewKeyring(Config{}, zap.NewNop())
+	require.NoError(t, err)
+	assert.False(t, k.Enabled())
+
+	var nilKeyring *Keyring
+	assert.False(t, nilKeyring.Enabled())
+}
+
+func TestKeyring_RequiresSecret(t *testing.T) {
+	_, err := NewKeyring(Config{Keys: []Key{{Label: "empty"}}}, zap.NewNop())
+	assert.ErrorContains(t, err, "key 0 (empty) has no secret")
+}
+
+func TestKey_Allows(t *testing.T) {
+	assert.True(t, Key{}.Allows("eval"))
+	assert.True(t, Key{Commands: []string{"preview"}}.Allows("preview"))
+	assert.False(t, Key{Commands: []string{"preview"}}.Allows("eval"))
+}
+
+func TestKeyring_ReloadsKeysFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "keys.json")
+	writeKeysFile(t, file, `[{"label": "frontend", "key": "one", "commands": ["preview"]}]`, time.Now().Add(-time.Minute))
+
+	k, err := NewKeyring(Config{KeysFile: file}, zap.NewNop())
+	require.NoError(t, err)
+
+	key, ok := k.Authenticate("one")
+	require.True(t, ok)
+	assert.Equal(t, Key{Label: "frontend", Key: "one", Commands: []string{"preview"}}, key)
+
+	// rotate the key
+	writeKeysFile(t, file, `[{"label": "frontend", "key": "two"}]`, time.Now())
+
+	reloaded, err := k.reload()
+	require.NoError(t, err)
+	assert.True(t, reloaded)
+
+	_, ok = k.Authenticate("one")
+	assert.False(t, ok)
+	_, ok = k.Authenticate("two")
+	assert.True(t, ok)
+
+	// invalid files are not applied
+	writeKeysFile(t, file, `[{"label": "frontend"`, time.Now().Add(time.Minute))
+
+	_, err = k.reload()
+	assert.ErrorContains(t, err, "failed to parse keys file")
+	_, ok = k.Authenticate("two")
+	assert.True(t, ok)
+}
+
+func TestKeyring_EnabledWithEmptyKeysFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "keys.json")
+	writeKeysFile(t, file, `[]`, time.Now())
+
+	k, err := NewKeyring(Config{KeysFile: file}, zap.NewNop())
+	require.NoError(t, err)
+
+	assert.True(t, k.Enabled())
+	_, ok := k.Authenticate("")
+	assert.False(t, ok)
+}
+
+func TestKeyring_MissingKeysFile(t *testing.T) {
+	_, err := NewKeyring(Config{KeysFile: filepath.Join(t.TempDir(), "missing.json")}, zap.NewNop())
+	assert.Error(t, err)
+}
@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"context"
+
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// Module provides the keyring, token verifier and request signer of
+// the application.
+// The keys files are re-read while the application is running.
+func Module(config Config) fx.Option {
+	return fx.Module(
+		"auth",
+
+		// provide auth config
+		fx.Supply(config),
+
+		// provide keyring
+		fx.Provide(NewLifecycleKeyring),
+
+		// provide token verifier
+		fx.Provide(NewLifecycleVerifier),
+
+		// provide request signer
+		fx.Provide(NewSigner),
+	)
+}
+
+func NewLifecycleKeyring(config Config, lc fx.Lifecycle, log *zap.Logger) (*Keyring, error) {
+	keyring, err := NewKeyring(config, log)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			go keyring.Watch(ctx)
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			cancel()
+			return nil
+		},
+	})
+
+	return keyring, nil
+}
+
+func NewLifecycleVerifier(config Config, lc fx.Lifecycle, log *zap.Logger) (*Verifier, error) {
+	verifier, err := NewVerifier(config, log)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			go verifier.Watch(ctx)
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			cancel()
+			return nil
+		},
+	})
+
+	return verifier, nil
+}
@@ -2,6 +2,7 @@ package execution
 
 import (
 	"context"
+	"time"
 
 	"go.uber.org/zap"
 
@@ -11,11 +12,90 @@ import (
 
 type Dispatcher dispatcher.Dispatcher
 
+// MessageEncoding describes the encoding of messages exchanged with workers.
+type MessageEncoding = supervisor.MessageEncoding
+
+const (
+	JSONEncoding    = supervisor.JSONEncoding
+	MsgPackEncoding = supervisor.MsgPackEncoding
+	CBOREncoding    = supervisor.CBOREncoding
+)
+
+// QueueConfig describes the limits of the queue of waiting messages.
+type QueueConfig = dispatcher.QueueConfig
+
+// OverloadedError describes a message rejected by admission control.
+type OverloadedError = dispatcher.OverloadedError
+
+// Stats is a snapshot of the state and history of a dispatcher.
+type Stats = dispatcher.Stats
+
+// ErrOverloaded is returned if a message is rejected by admission control.
+var ErrOverloaded = dispatcher.ErrOverloaded
+
+// AutoscaleConfig describes the adaptive sizing of the worker pool.
+type AutoscaleConfig = dispatcher.AutoscaleConfig
+
+// BreakerConfig describes the circuit breaker around failing workers.
+type BreakerConfig = dispatcher.BreakerConfig
+
+// CircuitOpenError describes a message rejected by the circuit breaker.
+type CircuitOpenError = dispatcher.CircuitOpenError
+
+// ErrCircuitOpen is returned if a message is rejected by the circuit breaker.
+var ErrCircuitOpen = dispatcher.ErrCircuitOpen
+
+// ErrDraining is returned if a message is rejected while draining.
+var ErrDraining = dispatcher.ErrDraining
+
+// ContextWithTenant returns a context carrying the tenant of a message.
+var ContextWithTenant = dispatcher.ContextWithTenant
+
+// TenantFromContext returns the tenant in a context.
+var TenantFromContext = dispatcher.TenantFromContext
+
+// Capabilities describes the capabilities reported by a worker.
+type Capabilities = supervisor.Capabilities
+
+// Progress describes the progress of a message handled by a worker.
+type Progress = supervisor.Progress
+
+// ProgressFunc is called for every progress notification of a message.
+type ProgressFunc = supervisor.ProgressFunc
+
+// ContextWithProgressListener returns a context carrying a progress listener.
+var ContextWithProgressListener = supervisor.ContextWithProgressListener
+
+// ProgressListenerFromContext returns the progress listener in a context.
+var ProgressListenerFromContext = supervisor.ProgressListenerFromContext
+
 type Config struct {
 	// MaxWorkers is the maximum number of concurrent workers
 	// when employing a pooled dispatcher.
 	MaxWorkers int `conf:"max_workers"`
 
+	// MinIdle is the number of idle workers to keep started
+	// when employing a pooled dispatcher.
+	MinIdle int `conf:"min_idle"`
+
+	// PrewarmOnStart starts the idle workers on startup
+	// when employing a pooled dispatcher.
+	PrewarmOnStart bool `conf:"prewarm_on_start"`
+
+	// Autoscale adjusts the number of workers up to MaxWorkers
+	// when employing a pooled dispatcher.
+	Autoscale AutoscaleConfig `conf:"autoscale"`
+
+	// Queue limits the messages waiting for a worker.
+	Queue QueueConfig `conf:"queue"`
+
+	// Breaker rejects messages if the worker fails repeatedly.
+	Breaker BreakerConfig `conf:"breaker"`
+
+	// DrainTimeout is the time in-flight messages are given
+	// to finish on shutdown, before they are aborted.
+	DrainTimeout time.Duration `conf:"drain_timeout"`
+
 	// SupervisorConfig is the configuration to use for the supervisor
 	Supervisor supervisor.Config `conf:",squash"`
 }
@@ -32,26 +112,52 @@ type Params struct {
 }
 
 func NewDispatcher(params Params) (dispatcher.Dispatcher, error) {
-	if params.Config.Supervisor.IO.Interface == supervisor.RpcIO {
+	config := params.Config.Supervisor
+
+	// a single supervisor is used if there is only a single worker, as
+	// it is able to multiplex concurrent messages over one connection.
+	// in attach mode, the supervisor balances across all endpoints.
+	if config.IO.Interface == supervisor.RpcIO &&
+		(params.Config.MaxWorkers == 1 || len(config.IO.Rpc.Attach.Endpoints) > 0) {
 		return dispatcher.NewDedicatedDispatcher(
 			dispatcher.DedicatedDispatcherParams{
 				Config: dispatcher.DedicatedDispatcherConfig{
-					Supervisor: params.Config.Supervisor,
+					Queue:        params.Config.Queue,
+					Breaker:      params.Config.Breaker,
+					DrainTimeout: params.Config.DrainTimeout,
+					Supervisor:   config,
 				},
 				Context: params.Context,
 				Log:     params.Log,
 			},
 		)
-	} else {
-		return dispatcher.NewPooledDispatcher(
-			dispatcher.PooledDispatcherParams{
-				Config: dispatcher.PooledDispatcherConfig{
-					Supervisor: params.Config.Supervisor,
-					MaxWorkers: params.Config.MaxWorkers,
-				},
-				Context: params.Context,
-				Log:     params.Log,
-			},
+	}
+
+	// multiple persistent workers can't share a fixed endpoint
+	if config.IO.Interface == supervisor.RpcIO &&
+		config.IO.Rpc.Transport != supervisor.StdioTransport &&
+		!config.IO.Rpc.AllocateEndpoint {
+		params.Log.Info("allocating unique endpoints for pooled workers",
+			zap.String("transport", string(config.IO.Rpc.Transport)),
 		)
+
+		config.IO.Rpc.AllocateEndpoint = true
 	}
+
+	return dispatcher.NewPooledDispatcher(
+		dispatcher.PooledDispatcherParams{
+			Config: dispatcher.PooledDispatcherConfig{
+				Supervisor:     config,
+				MaxWorkers:     params.Config.MaxWorkers,
+				MinIdle:        params.Config.MinIdle,
+				PrewarmOnStart: params.Config.PrewarmOnStart,
+				Autoscale:      params.Config.Autoscale,
+				Queue:          params.Config.Queue,
+				Breaker:        params.Config.Breaker,
+				DrainTimeout:   params.Config.DrainTimeout,
+			},
+			Context: params.Context,
+			Log:     params.Log,
+		},
+	)
 }
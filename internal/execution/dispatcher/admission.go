@@ -0,0 +1,310 @@
+package dispatcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/lambda-feedback/shimmy/internal/tracing"
+)
+
+// ErrOverloaded is returned if a message is rejected, as the dispatcher
+// is not able to handle it in time.
+var ErrOverloaded = errors.New("dispatcher overloaded")
+
+// ErrDraining is returned if a message is rejected, as the dispatcher
+// is draining in-flight messages before shutting down.
+var ErrDraining = errors.New("dispatcher draining")
+
+// OverloadedError describes a message rejected by admission control.
+type OverloadedError struct {
+	// Reason describes why the message was rejected.
+	Reason string
+
+	// RetryAfter is the estimated time until the message could be
+	// handled, based on the observed service time.
+	RetryAfter time.Duration
+}
+
+func (e *OverloadedError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrOverloaded, e.Reason)
+}
+
+func (e *OverloadedError) Unwrap() error {
+	return ErrOverloaded
+}
+
+// QueueConfig describes the queue of messages waiting for a worker.
+// Messages exceeding the limits are rejected.
+type QueueConfig struct {
+	// MaxLength is the maximum number of messages waiting for a
+	// worker. Default is unlimited.
+	MaxLength int `conf:"max_length"`
+
+	// MaxWait is the maximum time a message waits for a worker.
+	// Default is unlimited.
+	MaxWait time.Duration `conf:"max_wait"`
+
+	// Priorities are the weights of commands, as `command=weight`. If
+	// all workers are busy, waiting messages are served in proportion
+	// to the weight of their command. Default weight is 1.
+	Priorities []string `conf:"priorities"`
+
+	// TenantHeader is the request header identifying the tenant of a
+	// message. Messages of different tenants are served fairly, in
+	// proportion to the weight of the tenant. Default is disabled.
+	TenantHeader string `conf:"tenant_header"`
+
+	// TenantWeights are the weights of tenants, as `tenant=weight`.
+	// Default weight is 1.
+	TenantWeights []string `conf:"tenant_weights"`
+}
+
+// serviceTimeWeight is the weight of a new sample in the moving
+// average of the service time.
+const serviceTimeWeight = 0.2
+
+// minRetryAfter is the minimum retry delay reported to clients.
+const minRetryAfter = time.Second
+
+// admission limits the number of messages handled concurrently, and
+// rejects messages if the queue of waiting messages exceeds the limits.
+// Waiting messages are admitted using weighted fair queuing.
+type admission struct {
+	config QueueConfig
+
+	// capacity is the number of messages handled concurrently
+	capacity int
+
+	mu sync.Mutex
+
+	// inflight is the number of messages being handled
+	inflight int
+
+	// queue holds the messages waiting for a slot
+	queue *fairQueue
+
+	// serviceTime is the moving average of the time slots are held
+	serviceTime time.Duration
+
+	// rejected is the number of rejected messages
+	rejected int64
+
+	// draining is set once the dispatcher started draining
+	draining bool
+
+	// drained is closed once no message is queued or in flight,
+	// after the dispatcher started draining
+	drained chan struct{}
+
+	// aborted is cancelled if in-flight messages are aborted
+	aborted context.Context
+	abort   context.CancelFunc
+}
+
+// admissionTicket is a message waiting for a slot.
+type admissionTicket struct {
+	// ready is closed once the message is admitted
+	ready chan struct{}
+
+	// admitted is set once the message is admitted
+	admitted bool
+}
+
+func newAdmission(config QueueConfig, capacity int) (*admission, error) {
+	priorities, err := parseWeights(config.Priorities)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing priorities: %w", err)
+	}
+
+	tenantWeights, err := parseWeights(config.TenantWeights)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing tenant weights: %w", err)
+	}
+
+	aborted, abort := context.WithCancel(context.Background())
+
+	return &admission{
+		config:   config,
+		capacity: max(capacity, 1),
+		queue:    newFairQueue(priorities, tenantWeights),
+		drained:  make(chan struct{}),
+		aborted:  aborted,
+		abort:    abort,
+	}, nil
+}
+
+// admit waits for a free slot, and returns a function that must be
+// called to release the slot once the message was handled.
+func (a *admission) admit(ctx context.Context, command string) (func(), error) {
+	a.mu.Lock()
+
+	if a.draining {
+		a.mu.Unlock()
+		return nil, ErrDraining
+	}
+
+	// take a free slot right away, if no message is waiting
+	if a.inflight < a.capacity && a.queue.len == 0 {
+		a.inflight++
+		a.mu.Unlock()
+		return a.hold(), nil
+	}
+
+	if a.config.MaxLength > 0 && a.queue.len >= a.config.MaxLength {
+		a.mu.Unlock()
+		return nil, a.reject("queue full")
+	}
+
+	ticket := &admissionTicket{ready: make(chan struct{})}
+	entry := a.queue.push(command, TenantFromContext(ctx), ticket)
+
+	a.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if a.config.MaxWait > 0 {
+		timer := time.NewTimer(a.config.MaxWait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	// only waiting messages are traced, as admission is immediate otherwise
+	_, span := tracing.Start(ctx, "shimmy.queue")
+
+	var err error
+
+	select {
+	case <-ticket.ready:
+		span.End()
+		return a.hold(), nil
+	case <-timeout:
+		err = a.reject("queue wait exceeded")
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	tracing.End(span, err)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	// the message may have been admitted concurrently, in
+	// which case the slot is handed to the next message
+	if ticket.admitted {
+		a.inflight--
+		a.admitNext()
+	} else {
+		a.queue.remove(entry)
+		a.checkDrained()
+	}
+
+	return nil, err
+}
+
+// admitNext admits waiting messages while slots are free.
+// The caller must hold the lock.
+func (a *admission) admitNext() {
+	for a.inflight < a.capacity {
+		next, ok := a.queue.pop().(*admissionTicket)
+		if !ok {
+			return
+		}
+
+		a.inflight++
+		next.admitted = true
+		close(next.ready)
+	}
+}
+
+// setCapacity changes the number of messages handled concurrently. If
+// the capacity grows, waiting messages are admitted right away.
+func (a *admission) setCapacity(capacity int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.capacity = max(capacity, 1)
+	a.admitNext()
+}
+
+// depth returns the number of messages waiting for a slot.
+func (a *admission) depth() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.queue.len
+}
+
+// stats returns the state of the queue.
+func (a *admission) stats() QueueStats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return QueueStats{
+		Depth:    a.queue.len,
+		Inflight: a.inflight,
+		Capacity: a.capacity,
+		Rejected: a.rejected,
+		Draining: a.draining,
+	}
+}
+
+// hold returns a function that releases the slot, and records the
+// time the slot was held.
+func (a *admission) hold() func() {
+	start := time.Now()
+
+	var once sync.Once
+
+	return func() {
+		once.Do(func() {
+			a.mu.Lock()
+			defer a.mu.Unlock()
+
+			a.observe(time.Since(start))
+			a.inflight--
+			a.admitNext()
+			a.checkDrained()
+		})
+	}
+}
+
+// observe adds a sample to the moving average of the service time.
+// The caller must hold the lock.
+func (a *admission) observe(d time.Duration) {
+	if a.serviceTime == 0 {
+		a.serviceTime = d
+		return
+	}
+
+	a.serviceTime += time.Duration(serviceTimeWeight * float64(d-a.serviceTime))
+}
+
+// reject counts a rejected message, and returns an error for it.
+func (a *admission) reject(reason string) error {
+	a.mu.Lock()
+	a.rejected++
+	a.mu.Unlock()
+
+	return &OverloadedError{
+		Reason:     reason,
+		RetryAfter: a.retryAfter(),
+	}
+}
+
+// retryAfter estimates the time until all queued messages are handled,
+// based on the observed service time and the number of slots.
+func (a *admission) retryAfter() time.Duration {
+	a.mu.Lock()
+	serviceTime := a.serviceTime
+	queued := a.queue.len
+	capacity := a.capacity
+	a.mu.Unlock()
+
+	// the queue is drained by all slots in parallel
+	rounds := math.Ceil(float64(queued) / float64(capacity))
+
+	return max(time.Duration(max(rounds, 1)*float64(serviceTime)), minRetryAfter)
+}
@@ -0,0 +1,134 @@
+package dispatcher
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdmission_Admit_RejectsIfQueueFull(t *testing.T) {
+	a := createAdmission(t, QueueConfig{MaxLength: 1}, 1)
+
+	release, err := a.admit(context.Background(), "eval")
+	require.NoError(t, err)
+
+	// the second message waits for the slot
+	queued := make(chan error)
+	go func() {
+		release, err := a.admit(context.Background(), "eval")
+		if err == nil {
+			release()
+		}
+		queued <- err
+	}()
+
+	assert.Eventually(t, func() bool { return a.depth() == 1 }, time.Second, time.Millisecond)
+
+	// the third message exceeds the queue length
+	_, err = a.admit(context.Background(), "eval")
+
+	var overloaded *OverloadedError
+	require.ErrorAs(t, err, &overloaded)
+	assert.ErrorIs(t, err, ErrOverloaded)
+	assert.Equal(t, "queue full", overloaded.Reason)
+
+	release()
+
+	assert.NoError(t, <-queued)
+	assert.Equal(t, 0, a.depth())
+}
+
+func TestAdmission_Admit_RejectsIfWaitExceeded(t *testing.T) {
+	a := createAdmission(t, QueueConfig{MaxWait: 10 * time.Millisecond}, 1)
+
+	release, err := a.admit(context.Background(), "eval")
+	require.NoError(t, err)
+	defer release()
+
+	_, err = a.admit(context.Background(), "eval")
+
+	var overloaded *OverloadedError
+	require.ErrorAs(t, err, &overloaded)
+	assert.Equal(t, "queue wait exceeded", overloaded.Reason)
+	assert.Equal(t, minRetryAfter, overloaded.RetryAfter)
+}
+
+func TestAdmission_Admit_ReturnsIfContextCancelled(t *testing.T) {
+	a := createAdmission(t, QueueConfig{}, 1)
+
+	release, err := a.admit(context.Background(), "eval")
+	require.NoError(t, err)
+	defer release()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = a.admit(ctx, "eval")
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestAdmission_RetryAfter_UsesServiceTime(t *testing.T) {
+	a := createAdmission(t, QueueConfig{}, 2)
+
+	a.observe(4 * time.Second)
+
+	for range 3 {
+		a.queue.push("eval", "", &admissionTicket{})
+	}
+
+	// three queued messages take two rounds on two slots
+	assert.Equal(t, 8*time.Second, a.retryAfter())
+}
+
+func TestAdmission_Admit_ServesWaitingMessagesByPriority(t *testing.T) {
+	a := createAdmission(t, QueueConfig{
+		Priorities: []string{"eval=2"},
+	}, 1)
+
+	release, err := a.admit(context.Background(), "eval")
+	require.NoError(t, err)
+
+	// queue three messages of each command, while the slot is held
+	admitted := make(chan string, 6)
+	for _, command := range []string{"preview", "preview", "preview", "eval", "eval", "eval"} {
+		go func() {
+			release, err := a.admit(context.Background(), command)
+			if assert.NoError(t, err) {
+				admitted <- command
+				release()
+			}
+		}()
+	}
+
+	assert.Eventually(t, func() bool { return a.depth() == 6 }, time.Second, time.Millisecond)
+
+	// release the slot, so the waiting messages are served one by one
+	release()
+
+	var order []string
+	for range 6 {
+		order = append(order, <-admitted)
+	}
+
+	assert.Equal(t, []string{"eval", "preview", "eval", "eval", "preview", "preview"}, order)
+}
+
+func TestAdmission_New_FailsForInvalidPriorities(t *testing.T) {
+	_, err := newAdmission(QueueConfig{Priorities: []string{"eval"}}, 1)
+	assert.Error(t, err)
+
+	_, err = newAdmission(QueueConfig{TenantWeights: []string{"a=-1"}}, 1)
+	assert.Error(t, err)
+}
+
+// MARK: - helpers
+
+func createAdmission(t *testing.T, config QueueConfig, capacity int) *admission {
+	a, err := newAdmission(config, capacity)
+	require.NoError(t, err)
+
+	return a
+}
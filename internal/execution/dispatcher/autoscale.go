@@ -0,0 +1,227 @@
+package dispatcher
+
+import (
+	"cmp"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/puddle/v2"
+	"go.uber.org/zap"
+
+	"github.com/lambda-feedback/shimmy/internal/execution/supervisor"
+)
+
+// Defaults for the adaptive sizing of the worker pool.
+const (
+	defaultAutoscaleTargetWait  = 50 * time.Millisecond
+	defaultAutoscaleIdleTimeout = time.Minute
+	defaultAutoscaleInterval    = 5 * time.Second
+)
+
+// mebibyte is the unit of the memory budget.
+const mebibyte = 1 << 20
+
+// AutoscaleConfig describes the adaptive sizing of the worker pool.
+type AutoscaleConfig struct {
+	// Enabled scales the pool between MinWorkers and the max workers
+	// of the pool, based on the time messages wait for a worker.
+	Enabled bool `conf:"enabled"`
+
+	// MinWorkers is the minimum size of the pool. Default is 1.
+	MinWorkers int `conf:"min_workers"`
+
+	// TargetWait is the time messages may wait for a worker. The pool
+	// grows while the 90th percentile of the wait exceeds the target.
+	// Default is 50ms.
+	TargetWait time.Duration `conf:"target_wait"`
+
+	// IdleTimeout is the time after which idle workers are stopped,
+	// shrinking the pool. Default is 1m.
+	IdleTimeout time.Duration `conf:"idle_timeout"`
+
+	// Interval is the interval between two scaling decisions.
+	// Default is 5s.
+	Interval time.Duration `conf:"interval"`
+
+	// MemoryBudget is the resident memory all workers may use, in MiB.
+	// The pool does not grow beyond the number of workers fitting into
+	// the budget, based on the observed memory per worker. Default is
+	// unlimited.
+	MemoryBudget int `conf:"memory_budget"`
+}
+
+// autoscaler holds the state of the adaptive sizing of the pool.
+type autoscaler struct {
+	minSize     int
+	maxSize     int
+	targetWait  time.Duration
+	idleTimeout time.Duration
+	interval    time.Duration
+	budget      uint64
+
+	// size is the number of supervisors the pool is scaled to
+	size atomic.Int64
+
+	// window records the time messages waited for a worker,
+	// since the last scaling decision
+	window atomic.Pointer[latencyRecorder]
+}
+
+func newAutoscaler(config AutoscaleConfig, maxSize int) *autoscaler {
+	a := &autoscaler{
+		minSize:     min(max(config.MinWorkers, 1), maxSize),
+		maxSize:     maxSize,
+		targetWait:  config.TargetWait,
+		idleTimeout: config.IdleTimeout,
+		interval:    config.Interval,
+		budget:      uint64(max(config.MemoryBudget, 0)) * mebibyte,
+	}
+
+	if a.targetWait <= 0 {
+		a.targetWait = defaultAutoscaleTargetWait
+	}
+
+	if a.idleTimeout <= 0 {
+		a.idleTimeout = defaultAutoscaleIdleTimeout
+	}
+
+	if a.interval <= 0 {
+		a.interval = defaultAutoscaleInterval
+	}
+
+	a.size.Store(int64(a.minSize))
+	a.window.Store(newLatencyRecorder())
+
+	return a
+}
+
+// observe records the time a message waited for a worker.
+func (a *autoscaler) observe(d time.Duration) {
+	a.window.Load().observe(d)
+}
+
+// MARK: - Pooled Dispatcher
+
+// poolLimit returns the number of supervisors the pool may hold.
+func (m *PooledDispatcher) poolLimit() int {
+	if m.autoscaler != nil {
+		return int(m.autoscaler.size.Load())
+	}
+
+	return int(m.pool.Stat().MaxResources())
+}
+
+// autoscale adjusts the size of the pool periodically, until the
+// dispatcher is shut down.
+func (m *PooledDispatcher) autoscale() {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(m.autoscaler.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-m.ctx.Done():
+			return
+		case <-ticker.C:
+			m.scale()
+		}
+	}
+}
+
+// scale grows the pool if messages waited too long for a worker, and
+// shrinks it if workers stayed idle. The size is bounded by the
+// configured limits, and the number of workers fitting into the
+// memory budget.
+func (m *PooledDispatcher) scale() {
+	a := m.autoscaler
+
+	wait := a.window.Swap(newLatencyRecorder()).stats()
+	queued := m.admission.depth()
+
+	// messages waiting for the whole interval are not yet recorded
+	pressure := time.Duration(wait.P90*float64(time.Millisecond)) > a.targetWait ||
+		(queued > 0 && wait.Count == 0)
+
+	current := int(a.size.Load())
+	size := current
+	reason := "idle workers"
+
+	if pressure {
+		size = min(size+max(current/2, 1), a.maxSize)
+		reason = "acquire wait exceeds target"
+	}
+
+	// the memory budget takes precedence over the minimum size
+	if limit := m.memoryLimit(); size > limit {
+		size = max(limit, 1)
+		reason = "memory budget"
+	}
+
+	// stop idle supervisors exceeding the size of the pool, and those
+	// idle for too long, starting with the longest idle supervisor
+	idle := m.pool.AcquireAllIdle()
+	slices.SortFunc(idle, func(a, b *puddle.Resource[supervisor.Supervisor]) int {
+		return cmp.Compare(b.IdleDuration(), a.IdleDuration())
+	})
+
+	total := int(m.pool.Stat().TotalResources())
+
+	for _, res := range idle {
+		switch {
+		case total > size:
+			res.Destroy()
+			total--
+		case !pressure && res.IdleDuration() > a.idleTimeout && total > a.minSize:
+			res.Destroy()
+			total--
+			size = max(size-1, a.minSize)
+		default:
+			res.ReleaseUnused()
+		}
+	}
+
+	if size == current {
+		return
+	}
+
+	m.log.Info("scaling worker pool",
+		zap.Int("from", current),
+		zap.Int("to", size),
+		zap.String("reason", reason),
+		zap.Float64("acquire_wait_p90_ms", wait.P90),
+		zap.Int("queued", queued),
+	)
+
+	a.size.Store(int64(size))
+	m.admission.setCapacity(size * m.mux.concurrency)
+}
+
+// memoryLimit returns the number of workers fitting into the memory
+// budget, based on the mean memory of the running workers.
+func (m *PooledDispatcher) memoryLimit() int {
+	a := m.autoscaler
+	if a.budget == 0 {
+		return a.maxSize
+	}
+
+	var total uint64
+	var count uint64
+
+	m.supervisors.Range(func(key, _ any) bool {
+		if usage := key.(supervisor.Supervisor).MemoryUsage(); usage > 0 {
+			total += usage
+			count++
+		}
+		return true
+	})
+
+	if count == 0 {
+		return a.maxSize
+	}
+
+	return int(a.budget / (total / count))
+}
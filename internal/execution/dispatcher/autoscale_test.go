@@ -0,0 +1,117 @@
+package dispatcher
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/lambda-feedback/shimmy/internal/execution/supervisor"
+)
+
+func TestAutoscale_Scale_GrowsIfWaitExceedsTarget(t *testing.T) {
+	m, _ := createAutoscaledDispatcher(t, AutoscaleConfig{
+		MinWorkers: 2,
+		TargetWait: 10 * time.Millisecond,
+	})
+
+	m.autoscaler.observe(time.Second)
+	m.scale()
+
+	assert.Equal(t, 3, m.poolLimit())
+	assert.Equal(t, 3, m.admission.stats().Capacity)
+
+	// without pressure, the pool keeps its size
+	m.autoscaler.observe(time.Millisecond)
+	m.scale()
+
+	assert.Equal(t, 3, m.poolLimit())
+}
+
+func TestAutoscale_Scale_BoundedByMaxWorkers(t *testing.T) {
+	m, _ := createAutoscaledDispatcher(t, AutoscaleConfig{MinWorkers: 4})
+
+	m.autoscaler.observe(time.Second)
+	m.scale()
+
+	assert.Equal(t, 4, m.poolLimit())
+}
+
+func TestAutoscale_Scale_ShrinksIfWorkersIdle(t *testing.T) {
+	m, sv := createAutoscaledDispatcher(t, AutoscaleConfig{
+		MinWorkers:  1,
+		IdleTimeout: time.Nanosecond,
+	})
+
+	sv.EXPECT().Start(mock.Anything).Return(nil)
+	sv.EXPECT().Capabilities().Return(nil)
+	sv.EXPECT().Shutdown(mock.Anything).Return(nil, nil)
+
+	m.autoscaler.observe(time.Second)
+	m.scale()
+	require.Equal(t, 2, m.poolLimit())
+
+	for range 2 {
+		require.NoError(t, m.pool.CreateResource(context.Background()))
+	}
+
+	<-time.After(time.Millisecond)
+
+	m.scale()
+
+	assert.Equal(t, 1, m.poolLimit())
+	assert.Equal(t, 1, m.admission.stats().Capacity)
+	assert.Equal(t, 1, int(m.pool.Stat().IdleResources()))
+}
+
+func TestAutoscale_Scale_BoundedByMemoryBudget(t *testing.T) {
+	m, sv := createAutoscaledDispatcher(t, AutoscaleConfig{
+		MinWorkers:   3,
+		MemoryBudget: 100,
+	})
+
+	sv.EXPECT().Start(mock.Anything).Return(nil)
+	sv.EXPECT().Capabilities().Return(nil)
+	sv.EXPECT().Shutdown(mock.Anything).Return(nil, nil)
+	sv.EXPECT().MemoryUsage().Return(40 * mebibyte)
+
+	require.NoError(t, m.pool.CreateResource(context.Background()))
+
+	m.autoscaler.observe(time.Second)
+	m.scale()
+
+	assert.Equal(t, 2, m.poolLimit())
+}
+
+// MARK: - helpers
+
+func createAutoscaledDispatcher(
+	t *testing.T,
+	config AutoscaleConfig,
+) (*PooledDispatcher, *supervisor.MockSupervisor) {
+	sv := supervisor.NewMockSupervisor(t)
+
+	config.Enabled = true
+
+	d, err := NewPooledDispatcher(PooledDispatcherParams{
+		Config: PooledDispatcherConfig{
+			MaxWorkers: 4,
+			Autoscale:  config,
+		},
+		Context: context.Background(),
+		SupervisorFactory: func(supervisor.Params) (supervisor.Supervisor, error) {
+			return sv, nil
+		},
+		Log: zap.NewNop(),
+	})
+	require.NoError(t, err)
+
+	m := d.(*PooledDispatcher)
+	t.Cleanup(func() { m.pool.Close() })
+
+	return m, sv
+}
@@ -0,0 +1,226 @@
+package dispatcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/lambda-feedback/shimmy/internal/execution/supervisor"
+)
+
+// ErrCircuitOpen is returned if a message is rejected, as the worker
+// failed repeatedly and the circuit breaker is open.
+var ErrCircuitOpen = errors.New("circuit open")
+
+// defaultBreakerCooldown is the default time the circuit stays open.
+const defaultBreakerCooldown = 30 * time.Second
+
+// CircuitOpenError describes a message rejected by the circuit breaker.
+type CircuitOpenError struct {
+	// Reason is the last failure that caused the circuit to open.
+	Reason string
+
+	// RetryAfter is the time until the circuit is probed again.
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrCircuitOpen, e.Reason)
+}
+
+func (e *CircuitOpenError) Unwrap() error {
+	return ErrCircuitOpen
+}
+
+// BreakerConfig describes the circuit breaker, which rejects messages
+// right away if the worker failed repeatedly.
+type BreakerConfig struct {
+	// Threshold is the number of consecutive worker failures after
+	// which the circuit opens. Default is 0, which disables the breaker.
+	Threshold int `conf:"threshold"`
+
+	// Cooldown is the time the circuit stays open, before a single
+	// message is let through to probe the worker. Default is 30s.
+	Cooldown time.Duration `conf:"cooldown"`
+}
+
+// breakerState is the state of a circuit breaker.
+type breakerState int
+
+const (
+	// breakerClosed lets all messages through.
+	breakerClosed breakerState = iota
+
+	// breakerOpen rejects all messages, until the cooldown elapsed.
+	breakerOpen
+
+	// breakerHalfOpen lets a single probe through, and rejects all
+	// other messages until the probe finished.
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// BreakerStats describes the state of the circuit breaker.
+type BreakerStats struct {
+	// State is either `closed`, `open` or `half-open`.
+	State string `json:"state"`
+
+	// Failures is the number of consecutive worker failures.
+	Failures int `json:"failures"`
+
+	// LastFailure is the last worker failure, if any.
+	LastFailure string `json:"last_failure,omitempty"`
+}
+
+// breaker is a circuit breaker, which opens after a number of
+// consecutive worker failures. Errors reported by the worker itself
+// are not considered failures, as the worker is able to respond.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+	log       *zap.Logger
+
+	mu sync.Mutex
+
+	state breakerState
+
+	// failures is the number of consecutive failures
+	failures int
+
+	// lastFailure is the most recent failure
+	lastFailure error
+
+	// openedAt is the time the circuit opened
+	openedAt time.Time
+
+	// now returns the current time
+	now func() time.Time
+}
+
+func newBreaker(config BreakerConfig, log *zap.Logger) *breaker {
+	cooldown := config.Cooldown
+	if cooldown <= 0 {
+		cooldown = defaultBreakerCooldown
+	}
+
+	return &breaker{
+		threshold: config.Threshold,
+		cooldown:  cooldown,
+		log:       log,
+		now:       time.Now,
+	}
+}
+
+// allow returns an error if the circuit is open. Otherwise, it returns
+// a function that must be called with the outcome of the message.
+func (b *breaker) allow() (func(context.Context, error), error) {
+	if b.threshold <= 0 {
+		return func(context.Context, error) {}, nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		remaining := b.openedAt.Add(b.cooldown).Sub(b.now())
+		if remaining > 0 {
+			return nil, b.reject(remaining)
+		}
+
+		// let a single message through to probe the worker
+		b.log.Info("probing worker after cooldown")
+		b.state = breakerHalfOpen
+	case breakerHalfOpen:
+		return nil, b.reject(0)
+	}
+
+	return b.report, nil
+}
+
+// report records the outcome of a message.
+func (b *breaker) report(ctx context.Context, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch {
+	case err == nil || supervisor.IsWorkerError(err):
+		if b.state != breakerClosed {
+			b.log.Info("worker recovered, closing circuit")
+		}
+
+		b.state = breakerClosed
+		b.failures = 0
+		b.lastFailure = nil
+	case ctx.Err() != nil ||
+		errors.Is(err, context.Canceled) ||
+		errors.Is(err, ErrOverloaded) ||
+		errors.Is(err, ErrDraining):
+		// the message was not handled by the worker, so a probe
+		// is not conclusive and the next message probes again
+		if b.state == breakerHalfOpen {
+			b.state = breakerOpen
+		}
+	default:
+		b.failures++
+		b.lastFailure = err
+
+		if b.state == breakerHalfOpen || b.failures >= b.threshold {
+			if b.state != breakerOpen {
+				b.log.Warn("worker failing, opening circuit",
+					zap.Int("failures", b.failures),
+					zap.Duration("cooldown", b.cooldown),
+					zap.Error(err),
+				)
+			}
+
+			b.state = breakerOpen
+			b.openedAt = b.now()
+		}
+	}
+}
+
+// reject returns an error for a rejected message. The caller must
+// hold the lock.
+func (b *breaker) reject(retryAfter time.Duration) error {
+	reason := "worker failing"
+	if b.lastFailure != nil {
+		reason = b.lastFailure.Error()
+	}
+
+	return &CircuitOpenError{
+		Reason:     reason,
+		RetryAfter: max(retryAfter, minRetryAfter),
+	}
+}
+
+// stats returns the state of the circuit breaker.
+func (b *breaker) stats() BreakerStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	stats := BreakerStats{
+		State:    b.state.String(),
+		Failures: b.failures,
+	}
+
+	if b.lastFailure != nil {
+		stats.LastFailure = b.lastFailure.Error()
+	}
+
+	return stats
+}
@@ -0,0 +1,119 @@
+package dispatcher
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestBreaker_Allow_DisabledByDefault(t *testing.T) {
+	b := newBreaker(BreakerConfig{}, zap.NewNop())
+
+	for range 10 {
+		report, err := b.allow()
+		require.NoError(t, err)
+		report(context.Background(), errors.New("failed"))
+	}
+
+	assert.Equal(t, "closed", b.stats().State)
+}
+
+func TestBreaker_Allow_OpensAfterConsecutiveFailures(t *testing.T) {
+	b, _ := createBreaker(t, BreakerConfig{Threshold: 2, Cooldown: time.Minute})
+
+	fail(t, b, errors.New("first"))
+
+	// a success resets the consecutive failures
+	report, err := b.allow()
+	require.NoError(t, err)
+	report(context.Background(), nil)
+
+	fail(t, b, errors.New("second"))
+	assert.Equal(t, "closed", b.stats().State)
+
+	fail(t, b, errors.New("third"))
+	assert.Equal(t, "open", b.stats().State)
+
+	_, err = b.allow()
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.ErrorContains(t, err, "third")
+
+	var circuitOpen *CircuitOpenError
+	require.ErrorAs(t, err, &circuitOpen)
+	assert.Equal(t, time.Minute, circuitOpen.RetryAfter)
+}
+
+func TestBreaker_Allow_IgnoresWorkerErrors(t *testing.T) {
+	b, _ := createBreaker(t, BreakerConfig{Threshold: 1})
+
+	report, err := b.allow()
+	require.NoError(t, err)
+	report(context.Background(), evaluationError{})
+
+	report, err = b.allow()
+	require.NoError(t, err)
+	report(context.Background(), context.Canceled)
+
+	assert.Equal(t, "closed", b.stats().State)
+}
+
+func TestBreaker_Allow_ProbesAfterCooldown(t *testing.T) {
+	b, clock := createBreaker(t, BreakerConfig{Threshold: 1, Cooldown: time.Minute})
+
+	fail(t, b, errors.New("failed"))
+
+	*clock = clock.Add(time.Minute)
+
+	// a single probe is let through
+	probe, err := b.allow()
+	require.NoError(t, err)
+	assert.Equal(t, "half-open", b.stats().State)
+
+	_, err = b.allow()
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+
+	// a failed probe opens the circuit for another cooldown
+	probe(context.Background(), errors.New("failed again"))
+	assert.Equal(t, "open", b.stats().State)
+
+	_, err = b.allow()
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+
+	*clock = clock.Add(time.Minute)
+
+	// a successful probe closes the circuit
+	probe, err = b.allow()
+	require.NoError(t, err)
+	probe(context.Background(), nil)
+
+	assert.Equal(t, BreakerStats{State: "closed"}, b.stats())
+}
+
+// MARK: - helpers
+
+func createBreaker(t *testing.T, config BreakerConfig) (*breaker, *time.Time) {
+	b := newBreaker(config, zap.NewNop())
+
+	clock := time.Now()
+	b.now = func() time.Time { return clock }
+
+	return b, &clock
+}
+
+func fail(t *testing.T, b *breaker, err error) {
+	report, allowErr := b.allow()
+	require.NoError(t, allowErr)
+	report(context.Background(), err)
+}
+
+// evaluationError is an error reported by the worker itself.
+type evaluationError struct{}
+
+func (evaluationError) Error() string { return "evaluation failed" }
+
+func (evaluationError) ErrorCode() int { return -32000 }
@@ -3,7 +3,11 @@ package dispatcher
 import (
 	"context"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
 	"github.com/lambda-feedback/shimmy/internal/execution/supervisor"
+	"github.com/lambda-feedback/shimmy/internal/tracing"
 )
 
 type Dispatcher interface {
@@ -13,8 +17,36 @@ type Dispatcher interface {
 	// Start starts the dispatcher and all workers
 	Start(context.Context) error
 
-	// Shutdown stops the dispatcher and waits for all workers to finish.
+	// Drain rejects new messages, and waits for in-flight messages to
+	// finish, or aborts them after the drain timeout.
+	Drain(context.Context) error
+
+	// Shutdown drains the dispatcher, stops all workers and waits
+	// for them to finish.
 	Shutdown(context.Context) error
+
+	// Ready returns true if the dispatcher is able to handle messages
+	// without waiting for workers to boot, as far as configured.
+	Ready() bool
+
+	// QueueDepth returns the number of messages waiting for a worker.
+	QueueDepth() int
+
+	// Stats returns the state of the workers and queue, and the
+	// history of the dispatcher.
+	Stats() Stats
+
+	// Capabilities returns the capabilities reported by the workers,
+	// or nil if no worker reported any.
+	Capabilities() *supervisor.Capabilities
+}
+
+// startDispatchSpan starts the span covering the dispatch of a message,
+// from admission until the worker responded.
+func startDispatchSpan(ctx context.Context, method string) (context.Context, trace.Span) {
+	return tracing.Start(ctx, "shimmy.dispatch",
+		trace.WithAttributes(attribute.String("shimmy.command", method)),
+	)
 }
 
 type SupervisorFactory func(supervisor.Params) (supervisor.Supervisor, error)
@@ -3,20 +3,48 @@ package dispatcher
 import (
 	"context"
 	"fmt"
+	"sync/atomic"
+	"time"
 
 	"go.uber.org/zap"
 
 	"github.com/lambda-feedback/shimmy/internal/execution/supervisor"
+	"github.com/lambda-feedback/shimmy/internal/tracing"
 )
 
 type DedicatedDispatcher struct {
 	supervisor supervisor.Supervisor
 	log        *zap.Logger
+
+	// admission limits the queue of messages waiting for the worker
+	admission *admission
+
+	// drainTimeout is the time in-flight messages are given to finish
+	drainTimeout time.Duration
+
+	// stats records the history of the dispatcher
+	stats *dispatcherStats
+
+	// breaker rejects messages if the worker fails repeatedly
+	breaker *breaker
+
+	// started is set once the supervisor is started
+	started atomic.Bool
 }
 
 var _ Dispatcher = (*DedicatedDispatcher)(nil)
 
 type DedicatedDispatcherConfig struct {
+	// DrainTimeout is the time in-flight messages are given to finish
+	// on shutdown, before they are aborted and the workers are stopped.
+	DrainTimeout time.Duration `conf:"drain_timeout"`
+
+	// Breaker rejects messages if the worker fails repeatedly
+	Breaker BreakerConfig `conf:"breaker"`
+
+	// Queue limits the messages waiting for the worker
+	Queue QueueConfig `conf:"queue"`
+
 	// SupervisorConfig is the configuration to use for the supervisor
 	Supervisor supervisor.Config `conf:"supervisor,squash"`
 }
@@ -42,14 +70,30 @@ func NewDedicatedDispatcher(
 		params.SupervisorFactory = defaultSupervisorFactory
 	}
 
-	supervisor, err := createSupervisor(params)
+	stats := newDispatcherStats()
+
+	supervisor, err := createSupervisor(params, stats.workers)
+	if err != nil {
+		return nil, err
+	}
+
+	// the supervisor handles up to max concurrency messages at once
+	capacity := params.Config.Supervisor.Concurrency()
+
+	admission, err := newAdmission(params.Config.Queue, capacity)
 	if err != nil {
 		return nil, err
 	}
 
+	log := params.Log.Named("dispatcher_dedicated")
+
 	return &DedicatedDispatcher{
-		supervisor: supervisor,
-		log:        params.Log.Named("dispatcher_dedicated"),
+		supervisor:   supervisor,
+		log:          log,
+		admission:    admission,
+		drainTimeout: params.Config.DrainTimeout,
+		stats:        stats,
+		breaker:      newBreaker(params.Config.Breaker, log),
 	}, nil
 }
 
@@ -59,17 +103,72 @@ func (m *DedicatedDispatcher) Start(ctx context.Context) error {
 		return err
 	}
 
+	m.started.Store(true)
+
 	return nil
 }
 
+// Ready returns true once the supervisor is started, until the
+// dispatcher starts draining.
+func (m *DedicatedDispatcher) Ready() bool {
+	return m.started.Load() && !m.admission.isDraining()
+}
+
 func (m *DedicatedDispatcher) Send(
 	ctx context.Context,
 	method string,
 	data map[string]any,
+) (_ map[string]any, err error) {
+	ctx, span := startDispatchSpan(ctx, method)
+	defer func() { tracing.End(span, err) }()
+
+	report, err := m.breaker.allow()
+	if err != nil {
+		m.log.Debug("message rejected by circuit breaker", zap.Error(err))
+		return nil, err
+	}
+
+	result, err := m.send(ctx, method, data)
+	report(ctx, err)
+
+	return result, err
+}
+
+func (m *DedicatedDispatcher) send(
+	ctx context.Context,
+	method string,
+	data map[string]any,
 ) (map[string]any, error) {
+	start := time.Now()
+
+	release, err := m.admission.admit(ctx, method)
+	if err != nil {
+		m.log.Debug("message not admitted", zap.Error(err))
+		return nil, err
+	}
+	defer release()
+
+	admitted := time.Now()
+	m.stats.acquireWait.observe(admitted.Sub(start))
+
+	defer func() {
+		m.stats.observeCommand(method, time.Since(admitted))
+	}()
+
+	// abort the message if it is still in flight after draining
+	ctx, cancel := m.admission.bind(ctx)
+	defer cancel()
+
 	res, err := m.supervisor.Send(ctx, method, data)
 	if err != nil {
 		m.log.Error("error sending message", zap.Error(err))
+
+		// errors reported by the worker itself do not affect its health,
+		// and aborted messages may have been handled by a healthy worker
+		if !supervisor.IsWorkerError(err) && ctx.Err() == nil {
+			m.restartWorker(ctx)
+		}
+
 		return nil, fmt.Errorf("error sending data: %w", err)
 	}
 
@@ -83,10 +182,81 @@ func (m *DedicatedDispatcher) Send(
 	return res.Data, nil
 }
 
-// Shutdown stops the dispatcher and waits for all workers to finish.
+// restartWorker stops the worker after a message failed due to the
+// worker or its connection, as the pooled dispatcher destroys failed
+// supervisors. The next message, e.g. the probe of the circuit breaker,
+// boots a new worker.
+func (m *DedicatedDispatcher) restartWorker(ctx context.Context) {
+	m.log.Debug("stopping worker due to error")
+
+	wait, err := m.supervisor.Shutdown(ctx)
+	if err != nil {
+		m.log.Error("error stopping worker", zap.Error(err))
+		return
+	}
+
+	if wait == nil {
+		return
+	}
+
+	if err := wait(); err != nil {
+		m.log.Debug("error waiting for worker to stop", zap.Error(err))
+	}
+}
+
+// QueueDepth returns the number of messages waiting for the worker.
+func (m *DedicatedDispatcher) QueueDepth() int {
+	return m.admission.depth()
+}
+
+// Stats returns the state of the supervisor and queue, and the
+// history of the dispatcher. The supervisor is reported as a pool
+// of a single supervisor.
+func (m *DedicatedDispatcher) Stats() Stats {
+	stats := Stats{
+		Pool:  PoolStats{Max: 1, Target: 1},
+		Queue: m.admission.stats(),
+	}
+
+	if m.started.Load() {
+		stats.Pool.Total = 1
+
+		if stats.Queue.Inflight > 0 {
+			stats.Pool.Acquired = 1
+		} else {
+			stats.Pool.Idle = 1
+		}
+	}
+
+	m.stats.fill(&stats)
+
+	stats.Breaker = m.breaker.stats()
+
+	stats.Pool.AcquireCount = stats.AcquireWait.Count
+
+	return stats
+}
+
+func (m *DedicatedDispatcher) Capabilities() *supervisor.Capabilities {
+	return m.supervisor.Capabilities()
+}
+
+// Drain rejects new messages, and waits for in-flight messages to
+// finish. Messages still in flight after the drain timeout are aborted.
+func (m *DedicatedDispatcher) Drain(ctx context.Context) error {
+	m.admission.drain(ctx, m.drainTimeout, m.log)
+	return nil
+}
+
+// Shutdown drains the dispatcher, stops the worker and waits for it
+// to finish.
 func (m *DedicatedDispatcher) Shutdown(ctx context.Context) error {
 	m.log.Debug("shutting down")
 
+	if err := m.Drain(ctx); err != nil {
+		return err
+	}
+
 	wait, err := m.supervisor.Shutdown(ctx)
 	if err != nil {
 		m.log.Error("error shutting down", zap.Error(err))
@@ -108,10 +278,12 @@ func (m *DedicatedDispatcher) Shutdown(ctx context.Context) error {
 
 func createSupervisor(
 	params DedicatedDispatcherParams,
+	counters *supervisor.Counters,
 ) (supervisor.Supervisor, error) {
 	return params.SupervisorFactory(supervisor.Params{
-		Context: params.Context,
-		Config:  params.Config.Supervisor,
-		Log:     params.Log,
+		Context:  params.Context,
+		Config:   params.Config.Supervisor,
+		Counters: counters,
+		Log:      params.Log,
 	})
 }
@@ -0,0 +1,85 @@
+package dispatcher_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/lambda-feedback/shimmy/internal/execution/dispatcher"
+	"github.com/lambda-feedback/shimmy/internal/execution/supervisor"
+)
+
+// crashingSupervisor is a persistent worker that fails every message
+// once crashed, until it is stopped and a new worker is booted.
+type crashingSupervisor struct {
+	supervisor.Supervisor
+
+	crashed atomic.Bool
+	stops   atomic.Int32
+}
+
+func (s *crashingSupervisor) Start(context.Context) error {
+	return nil
+}
+
+func (s *crashingSupervisor) Send(_ context.Context, _ string, data map[string]any) (*supervisor.Result, error) {
+	if s.crashed.Load() {
+		return nil, errors.New("connection reset by peer")
+	}
+
+	return &supervisor.Result{
+		Data:    data,
+		Release: func(context.Context) error { return nil },
+	}, nil
+}
+
+func (s *crashingSupervisor) Shutdown(context.Context) (supervisor.WaitFunc, error) {
+	s.stops.Add(1)
+	s.crashed.Store(false)
+
+	return func() error { return nil }, nil
+}
+
+func TestDedicatedDispatcher_Send_RecoversAfterCrash(t *testing.T) {
+	sv := &crashingSupervisor{}
+
+	m, err := dispatcher.NewDedicatedDispatcher(dispatcher.DedicatedDispatcherParams{
+		Config: dispatcher.DedicatedDispatcherConfig{
+			Breaker: dispatcher.BreakerConfig{Threshold: 1, Cooldown: 10 * time.Millisecond},
+		},
+		Context: context.Background(),
+		SupervisorFactory: func(supervisor.Params) (supervisor.Supervisor, error) {
+			return sv, nil
+		},
+		Log: zap.NewNop(),
+	})
+	require.NoError(t, err)
+	require.NoError(t, m.Start(context.Background()))
+
+	data := map[string]any{"data": "data"}
+
+	// the worker crashes, which opens the circuit and stops the worker
+	sv.crashed.Store(true)
+
+	_, err = m.Send(context.Background(), "eval", data)
+	require.Error(t, err)
+	assert.Equal(t, "open", m.Stats().Breaker.State)
+	assert.Equal(t, int32(1), sv.stops.Load())
+
+	_, err = m.Send(context.Background(), "eval", data)
+	assert.ErrorIs(t, err, dispatcher.ErrCircuitOpen)
+
+	// after the cooldown, the probe is sent to a new worker
+	time.Sleep(20 * time.Millisecond)
+
+	res, err := m.Send(context.Background(), "eval", data)
+	require.NoError(t, err)
+	assert.Equal(t, data, res)
+	assert.Equal(t, "closed", m.Stats().Breaker.State)
+}
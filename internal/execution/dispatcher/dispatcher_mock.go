@@ -6,6 +6,8 @@ import (
 	context "context"
 
 	mock "github.com/stretchr/testify/mock"
+
+	supervisor "github.com/lambda-feedback/shimmy/internal/execution/supervisor"
 )
 
 // MockDispatcher is an autogenerated mock type for the Dispatcher type
@@ -21,6 +23,189 @@ func (_m *MockDispatcher) EXPECT() *MockDispatcher_Expecter {
 	return &MockDispatcher_Expecter{mock: &_m.Mock}
 }
 
+// Capabilities provides a mock function with no fields
+func (_m *MockDispatcher) Capabilities() *supervisor.Capabilities {
+	ret := _m.Called()
+
+	if len(ret) == 0 {
+		panic("no return value specified for Capabilities")
+	}
+
+	var r0 *supervisor.Capabilities
+	if rf, ok := ret.Get(0).(func() *supervisor.Capabilities); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*supervisor.Capabilities)
+		}
+	}
+
+	return r0
+}
+
+// MockDispatcher_Capabilities_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Capabilities'
+type MockDispatcher_Capabilities_Call struct {
+	*mock.Call
+}
+
+// Capabilities is a helper method to define mock.On call
+func (_e *MockDispatcher_Expecter) Capabilities() *MockDispatcher_Capabilities_Call {
+	return &MockDispatcher_Capabilities_Call{Call: _e.mock.On("Capabilities")}
+}
+
+func (_c *MockDispatcher_Capabilities_Call) Run(run func()) *MockDispatcher_Capabilities_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run()
+	})
+	return _c
+}
+
+func (_c *MockDispatcher_Capabilities_Call) Return(_a0 *supervisor.Capabilities) *MockDispatcher_Capabilities_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *MockDispatcher_Capabilities_Call) RunAndReturn(run func() *supervisor.Capabilities) *MockDispatcher_Capabilities_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// Drain provides a mock function with given fields: _a0
+func (_m *MockDispatcher) Drain(_a0 context.Context) error {
+	ret := _m.Called(_a0)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Drain")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context) error); ok {
+		r0 = rf(_a0)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// MockDispatcher_Drain_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Drain'
+type MockDispatcher_Drain_Call struct {
+	*mock.Call
+}
+
+// Drain is a helper method to define mock.On call
+//   - _a0 context.Context
+func (_e *MockDispatcher_Expecter) Drain(_a0 interface{}) *MockDispatcher_Drain_Call {
+	return &MockDispatcher_Drain_Call{Call: _e.mock.On("Drain", _a0)}
+}
+
+func (_c *MockDispatcher_Drain_Call) Run(run func(_a0 context.Context)) *MockDispatcher_Drain_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context))
+	})
+	return _c
+}
+
+func (_c *MockDispatcher_Drain_Call) Return(_a0 error) *MockDispatcher_Drain_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *MockDispatcher_Drain_Call) RunAndReturn(run func(context.Context) error) *MockDispatcher_Drain_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// QueueDepth provides a mock function with no fields
+func (_m *MockDispatcher) QueueDepth() int {
+	ret := _m.Called()
+
+	if len(ret) == 0 {
+		panic("no return value specified for QueueDepth")
+	}
+
+	var r0 int
+	if rf, ok := ret.Get(0).(func() int); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	return r0
+}
+
+// MockDispatcher_QueueDepth_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'QueueDepth'
+type MockDispatcher_QueueDepth_Call struct {
+	*mock.Call
+}
+
+// QueueDepth is a helper method to define mock.On call
+func (_e *MockDispatcher_Expecter) QueueDepth() *MockDispatcher_QueueDepth_Call {
+	return &MockDispatcher_QueueDepth_Call{Call: _e.mock.On("QueueDepth")}
+}
+
+func (_c *MockDispatcher_QueueDepth_Call) Run(run func()) *MockDispatcher_QueueDepth_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run()
+	})
+	return _c
+}
+
+func (_c *MockDispatcher_QueueDepth_Call) Return(_a0 int) *MockDispatcher_QueueDepth_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *MockDispatcher_QueueDepth_Call) RunAndReturn(run func() int) *MockDispatcher_QueueDepth_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// Ready provides a mock function with no fields
+func (_m *MockDispatcher) Ready() bool {
+	ret := _m.Called()
+
+	if len(ret) == 0 {
+		panic("no return value specified for Ready")
+	}
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func() bool); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	return r0
+}
+
+// MockDispatcher_Ready_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Ready'
+type MockDispatcher_Ready_Call struct {
+	*mock.Call
+}
+
+// Ready is a helper method to define mock.On call
+func (_e *MockDispatcher_Expecter) Ready() *MockDispatcher_Ready_Call {
+	return &MockDispatcher_Ready_Call{Call: _e.mock.On("Ready")}
+}
+
+func (_c *MockDispatcher_Ready_Call) Run(run func()) *MockDispatcher_Ready_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run()
+	})
+	return _c
+}
+
+func (_c *MockDispatcher_Ready_Call) Return(_a0 bool) *MockDispatcher_Ready_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *MockDispatcher_Ready_Call) RunAndReturn(run func() bool) *MockDispatcher_Ready_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // Send provides a mock function with given fields: _a0, _a1, _a2
 func (_m *MockDispatcher) Send(_a0 context.Context, _a1 string, _a2 map[string]interface{}) (map[string]interface{}, error) {
 	ret := _m.Called(_a0, _a1, _a2)
@@ -173,6 +358,51 @@ func (_c *MockDispatcher_Start_Call) RunAndReturn(run func(context.Context) erro
 	return _c
 }
 
+// Stats provides a mock function with no fields
+func (_m *MockDispatcher) Stats() Stats {
+	ret := _m.Called()
+
+	if len(ret) == 0 {
+		panic("no return value specified for Stats")
+	}
+
+	var r0 Stats
+	if rf, ok := ret.Get(0).(func() Stats); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(Stats)
+	}
+
+	return r0
+}
+
+// MockDispatcher_Stats_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Stats'
+type MockDispatcher_Stats_Call struct {
+	*mock.Call
+}
+
+// Stats is a helper method to define mock.On call
+func (_e *MockDispatcher_Expecter) Stats() *MockDispatcher_Stats_Call {
+	return &MockDispatcher_Stats_Call{Call: _e.mock.On("Stats")}
+}
+
+func (_c *MockDispatcher_Stats_Call) Run(run func()) *MockDispatcher_Stats_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run()
+	})
+	return _c
+}
+
+func (_c *MockDispatcher_Stats_Call) Return(_a0 Stats) *MockDispatcher_Stats_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *MockDispatcher_Stats_Call) RunAndReturn(run func() Stats) *MockDispatcher_Stats_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // NewMockDispatcher creates a new instance of MockDispatcher. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
 // The first argument is typically a *testing.T value.
 func NewMockDispatcher(t interface {
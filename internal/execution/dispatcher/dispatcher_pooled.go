@@ -2,19 +2,69 @@ package dispatcher
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/jackc/puddle/v2"
 	"go.uber.org/zap"
 
 	"github.com/lambda-feedback/shimmy/internal/execution/supervisor"
+	"github.com/lambda-feedback/shimmy/internal/tracing"
 )
 
 type PooledDispatcher struct {
 	ctx  context.Context
 	pool *puddle.Pool[supervisor.Supervisor]
 	log  *zap.Logger
+
+	// admission limits the queue of messages waiting for a worker
+	admission *admission
+
+	// drainTimeout is the time in-flight messages are given to finish
+	drainTimeout time.Duration
+
+	// stats records the history of the dispatcher
+	stats *dispatcherStats
+
+	// breaker rejects messages if the worker fails repeatedly
+	breaker *breaker
+
+	// capabilities are the capabilities reported by the most
+	// recently started worker. All workers run the same function.
+	capabilities atomic.Pointer[supervisor.Capabilities]
+
+	// supervisors holds the started supervisors of the pool
+	supervisors sync.Map
+
+	// autoscaler adjusts the size of the pool, if enabled
+	autoscaler *autoscaler
+
+	// mux shares acquired supervisors between concurrent messages
+	mux *multiplexer
+
+	// minIdle is the number of idle supervisors to keep warm
+	minIdle int
+
+	// prewarm starts the warm pool when the dispatcher is started
+	prewarm bool
+
+	// ready is set once the warm pool is available
+	ready atomic.Bool
+
+	// topUp signals the warm pool to replace used supervisors
+	topUp chan struct{}
+
+	// supervisorConfig is the config of the supervisors of the pool
+	supervisorConfig supervisor.Config
+
+	// done is closed when the dispatcher is shut down
+	done     chan struct{}
+	doneOnce sync.Once
+	wg       sync.WaitGroup
 }
 
 var _ Dispatcher = (*PooledDispatcher)(nil)
@@ -23,6 +73,31 @@ type PooledDispatcherConfig struct {
 	// MaxWorkers is the maximum number of concurrent workers
 	MaxWorkers int `conf:"max_workers"`
 
+	// MinIdle is the number of idle workers to keep started, so
+	// requests do not have to wait for workers to boot. The pool is
+	// topped up in the background after workers are acquired or
+	// destroyed, up to MaxWorkers.
+	MinIdle int `conf:"min_idle"`
+
+	// PrewarmOnStart starts the idle workers when the dispatcher is
+	// started. The dispatcher is ready once the workers are started.
+	// If MinIdle is not set, a single worker is started.
+	PrewarmOnStart bool `conf:"prewarm_on_start"`
+
+	// DrainTimeout is the time in-flight messages are given to finish
+	// on shutdown, before they are aborted and the workers are stopped.
+	DrainTimeout time.Duration `conf:"drain_timeout"`
+
+	// Breaker rejects messages if the worker fails repeatedly
+	Breaker BreakerConfig `conf:"breaker"`
+
+	// Autoscale adjusts the size of the pool between a minimum and
+	// MaxWorkers, based on the time messages wait for a worker
+	Autoscale AutoscaleConfig `conf:"autoscale"`
+
+	// Queue limits the messages waiting for a worker
+	Queue QueueConfig `conf:"queue"`
+
 	// SupervisorConfig is the configuration to use for the supervisor
 	Supervisor supervisor.Config `conf:"supervisor,squash"`
 }
@@ -48,35 +123,148 @@ func NewPooledDispatcher(
 		params.SupervisorFactory = defaultSupervisorFactory
 	}
 
-	pool, err := createPool(params)
+	minIdle := max(params.Config.MinIdle, 0)
+	if params.Config.PrewarmOnStart && minIdle == 0 {
+		minIdle = 1
+	}
+
+	size := poolSize(params.Config.MaxWorkers)
+
+	// the pool is scaled by limiting the messages handled concurrently,
+	// starting with the minimum size
+	var scaler *autoscaler
+	if params.Config.Autoscale.Enabled {
+		scaler = newAutoscaler(params.Config.Autoscale, size)
+		size = int(scaler.size.Load())
+	}
+
+	// each supervisor handles up to max concurrency messages at once
+	mux := newMultiplexer(params.Config.Supervisor.Concurrency())
+
+	admission, err := newAdmission(params.Config.Queue, size*mux.concurrency)
 	if err != nil {
 		return nil, err
 	}
 
-	return &PooledDispatcher{
-		pool: pool,
-		ctx:  params.Context,
-		log:  params.Log.Named("dispatcher_pooled"),
-	}, nil
+	log := params.Log.Named("dispatcher_pooled")
+
+	m := &PooledDispatcher{
+		ctx:          params.Context,
+		log:          log,
+		admission:    admission,
+		drainTimeout: params.Config.DrainTimeout,
+		stats:        newDispatcherStats(),
+		breaker:      newBreaker(params.Config.Breaker, log),
+		autoscaler:   scaler,
+		mux:          mux,
+		minIdle:      minIdle,
+		prewarm:      params.Config.PrewarmOnStart,
+		topUp:        make(chan struct{}, 1),
+		done:         make(chan struct{}),
+
+		supervisorConfig: params.Config.Supervisor,
+	}
+
+	pool, err := createPool(params, m.stats.workers, m.onStarted, m.onStopped)
+	if err != nil {
+		return nil, err
+	}
+
+	m.pool = pool
+
+	return m, nil
 }
 
 func (m *PooledDispatcher) Start(context.Context) error {
-	// starting the pool is a no-op
+	// without prewarming, workers are started on demand,
+	// so the dispatcher is ready to accept messages
+	if !m.prewarm {
+		m.ready.Store(true)
+	}
+
+	if m.autoscaler != nil {
+		m.wg.Add(1)
+		go m.autoscale()
+	}
+
+	// remove expired scratch dirs of failed requests, independently
+	// of incoming requests
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		supervisor.RunScratchJanitor(m.supervisorConfig, m.done, m.log)
+	}()
+
+	if m.minIdle == 0 {
+		return nil
+	}
+
+	// the warm pool is maintained in the background, so
+	// starting the dispatcher does not wait for workers
+	m.wg.Add(1)
+	go m.maintainWarmPool()
+
 	return nil
 }
 
+// Ready returns true once the warm pool is available, until the
+// dispatcher starts draining.
+func (m *PooledDispatcher) Ready() bool {
+	return m.ready.Load() && !m.admission.isDraining()
+}
+
 func (m *PooledDispatcher) Send(
 	ctx context.Context,
 	method string,
 	data map[string]any,
+) (_ map[string]any, err error) {
+	ctx, span := startDispatchSpan(ctx, method)
+	defer func() { tracing.End(span, err) }()
+
+	report, err := m.breaker.allow()
+	if err != nil {
+		m.log.Debug("message rejected by circuit breaker", zap.Error(err))
+		return nil, err
+	}
+
+	result, err := m.send(ctx, method, data)
+	report(ctx, err)
+
+	return result, err
+}
+
+func (m *PooledDispatcher) send(
+	ctx context.Context,
+	method string,
+	data map[string]any,
 ) (map[string]any, error) {
+	start := time.Now()
+
+	release, err := m.admission.admit(ctx, method)
+	if err != nil {
+		m.log.Debug("message not admitted", zap.Error(err))
+		return nil, err
+	}
+	defer release()
+
+	// abort the message if it is still in flight after draining
+	ctx, cancel := m.admission.bind(ctx)
+	defer cancel()
 
-	resource, err := m.pool.Acquire(ctx)
+	lease, err := m.acquireLease(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("error acquiring supervisor: %w", err)
 	}
 
-	result, err := m.sendToSupervisor(ctx, method, data, resource)
+	acquired := time.Now()
+	m.stats.acquireWait.observe(acquired.Sub(start))
+
+	if m.autoscaler != nil {
+		m.autoscaler.observe(acquired.Sub(start))
+	}
+
+	result, err := m.sendToSupervisor(ctx, method, data, lease)
+	m.stats.observeCommand(method, time.Since(acquired))
 	if err != nil {
 		return nil, fmt.Errorf("error sending data: %w", err)
 	}
@@ -84,23 +272,28 @@ func (m *PooledDispatcher) Send(
 	return result, nil
 }
 
+// acquire acquires a supervisor from the pool, starting a new one if
+// none is idle and the pool is not full.
+func (m *PooledDispatcher) acquire(ctx context.Context) (_ *puddle.Resource[supervisor.Supervisor], err error) {
+	ctx, span := tracing.Start(ctx, "shimmy.pool.acquire")
+	defer func() { tracing.End(span, err) }()
+
+	return m.pool.Acquire(ctx)
+}
+
 func (m *PooledDispatcher) sendToSupervisor(
 	ctx context.Context,
 	method string,
 	data map[string]any,
-	resource *puddle.Resource[supervisor.Supervisor],
+	lease *lease,
 ) (map[string]any, error) {
 	var err error
 	var res *supervisor.Result
 
 	destroyOrRelease := func() {
-		if err != nil {
-			m.log.Debug("destroying supervisor due to error")
-			resource.Destroy()
-		} else {
-			m.log.Debug("releasing supervisor back to pool")
-			resource.Release()
-		}
+		// errors reported by the worker itself do not affect its health,
+		// so persistent workers can be reused for subsequent messages
+		m.releaseLease(lease, err != nil && !supervisor.IsWorkerError(err))
 	}
 
 	dispose := func() {
@@ -114,7 +307,7 @@ func (m *PooledDispatcher) sendToSupervisor(
 		// log it and destroy the resource
 		if releaseErr := res.Release(m.ctx); releaseErr != nil {
 			m.log.Error("destroying supervisor due to error waiting", zap.Error(releaseErr))
-			resource.Destroy()
+			m.releaseLease(lease, true)
 			return
 		}
 
@@ -131,9 +324,9 @@ func (m *PooledDispatcher) sendToSupervisor(
 		go dispose()
 	}()
 
-	supervisor := resource.Value()
+	sv := lease.resource.Value()
 
-	res, err = supervisor.Send(ctx, method, data)
+	res, err = sv.Send(ctx, method, data)
 	if err != nil {
 		return nil, err
 	}
@@ -141,25 +334,220 @@ func (m *PooledDispatcher) sendToSupervisor(
 	return res.Data, nil
 }
 
-// Shutdown stops the dispatcher and waits for all workers to finish.
-func (m *PooledDispatcher) Shutdown(context.Context) error {
+// onStarted keeps track of a started supervisor.
+func (m *PooledDispatcher) onStarted(sv supervisor.Supervisor) {
+	if capabilities := sv.Capabilities(); capabilities != nil {
+		m.capabilities.Store(capabilities)
+	}
+
+	m.supervisors.Store(sv, struct{}{})
+}
+
+// onStopped forgets a stopped supervisor.
+func (m *PooledDispatcher) onStopped(sv supervisor.Supervisor) {
+	m.supervisors.Delete(sv)
+}
+
+// QueueDepth returns the number of messages waiting for a worker.
+func (m *PooledDispatcher) QueueDepth() int {
+	return m.admission.depth()
+}
+
+// Stats returns the state of the pool and queue, and the history
+// of the dispatcher.
+func (m *PooledDispatcher) Stats() Stats {
+	stat := m.pool.Stat()
+
+	stats := Stats{
+		Pool: PoolStats{
+			Max:                  int(stat.MaxResources()),
+			Target:               m.poolLimit(),
+			Total:                int(stat.TotalResources()),
+			Idle:                 int(stat.IdleResources()),
+			Constructing:         int(stat.ConstructingResources()),
+			Acquired:             int(stat.AcquiredResources()),
+			AcquireCount:         stat.AcquireCount(),
+			EmptyAcquireCount:    stat.EmptyAcquireCount(),
+			CanceledAcquireCount: stat.CanceledAcquireCount(),
+		},
+		Queue: m.admission.stats(),
+	}
+
+	m.stats.fill(&stats)
+
+	stats.Breaker = m.breaker.stats()
+
+	return stats
+}
+
+func (m *PooledDispatcher) Capabilities() *supervisor.Capabilities {
+	return m.capabilities.Load()
+}
+
+// Drain rejects new messages, and waits for in-flight messages to
+// finish. Messages still in flight after the drain timeout are aborted.
+func (m *PooledDispatcher) Drain(ctx context.Context) error {
+	m.admission.drain(ctx, m.drainTimeout, m.log)
+	return nil
+}
+
+// Shutdown drains the dispatcher, stops all workers and waits for them
+// to finish.
+func (m *PooledDispatcher) Shutdown(ctx context.Context) error {
 	m.log.Debug("shutting down")
+
+	// stop topping up the warm pool, before draining
+	m.doneOnce.Do(func() { close(m.done) })
+
+	if err := m.Drain(ctx); err != nil {
+		return err
+	}
+
 	m.pool.Close()
+	m.wg.Wait()
 	return nil
 }
 
+// MARK: - Warm Pool
+
+// minTopUpBackoff and maxTopUpBackoff bound the delay between attempts
+// to top up the warm pool, if starting workers fails.
+const (
+	minTopUpBackoff = 100 * time.Millisecond
+	maxTopUpBackoff = 30 * time.Second
+)
+
+// topUpPollInterval is the interval to check the warm pool, while it is
+// below the minimum as all workers are in use, or are being destroyed.
+const topUpPollInterval = 250 * time.Millisecond
+
+// requestTopUp signals the warm pool to start missing supervisors.
+func (m *PooledDispatcher) requestTopUp() {
+	if m.minIdle == 0 {
+		return
+	}
+
+	select {
+	case m.topUp <- struct{}{}:
+	default:
+		// a top up is already pending
+	}
+}
+
+// maintainWarmPool keeps the configured number of idle supervisors
+// started, until the dispatcher is shut down.
+func (m *PooledDispatcher) maintainWarmPool() {
+	defer m.wg.Done()
+
+	// the pool is filled right away if prewarming is enabled,
+	// otherwise it is filled once the first supervisor is used
+	pending := m.prewarm
+	backoff := minTopUpBackoff
+
+	for {
+		var retry <-chan time.Time
+
+		if pending {
+			filled, err := m.fillWarmPool()
+			if err != nil {
+				m.log.Warn("failed to fill warm pool",
+					zap.Duration("retry_in", backoff),
+					zap.Error(err),
+				)
+
+				retry = time.After(backoff)
+				backoff = min(backoff*2, maxTopUpBackoff)
+			} else {
+				if !m.ready.Swap(true) {
+					m.log.Info("warm pool ready", zap.Int("min_idle", m.minIdle))
+				}
+
+				pending = false
+				backoff = minTopUpBackoff
+
+				// destroyed supervisors are removed from the pool in the
+				// background, so check again until the pool is filled
+				if !filled {
+					retry = time.After(topUpPollInterval)
+				}
+			}
+		}
+
+		select {
+		case <-m.done:
+			return
+		case <-m.ctx.Done():
+			return
+		case <-m.topUp:
+			pending = true
+		case <-retry:
+			pending = true
+		}
+	}
+}
+
+// fillWarmPool starts supervisors concurrently, until the pool holds
+// the configured number of idle supervisors, or is full. It returns
+// false if the pool is still missing idle supervisors afterwards.
+func (m *PooledDispatcher) fillWarmPool() (bool, error) {
+	stat := m.pool.Stat()
+
+	idle := int(stat.IdleResources() + stat.ConstructingResources())
+	free := m.poolLimit() - int(stat.TotalResources())
+
+	filled := m.minIdle-idle <= free
+
+	missing := min(m.minIdle-idle, free)
+	if missing <= 0 {
+		return filled, nil
+	}
+
+	m.log.Debug("starting idle supervisors", zap.Int("count", missing))
+
+	var wg sync.WaitGroup
+	errs := make([]error, missing)
+
+	for i := range missing {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = m.pool.CreateResource(m.ctx)
+		}()
+	}
+
+	wg.Wait()
+
+	for i, err := range errs {
+		// the pool is full or closed, which is not a failure
+		if errors.Is(err, puddle.ErrNotAvailable) {
+			filled = false
+			errs[i] = nil
+		} else if errors.Is(err, puddle.ErrClosedPool) {
+			errs[i] = nil
+		}
+	}
+
+	return filled, errors.Join(errs...)
+}
+
 // MARK: - Pool
 
 func createPool(
 	params PooledDispatcherParams,
+	counters *supervisor.Counters,
+	onStarted func(supervisor.Supervisor),
+	onStopped func(supervisor.Supervisor),
 ) (*puddle.Pool[supervisor.Supervisor], error) {
 	log := params.Log.Named("dispatcher_pool")
 
 	constructor := func(ctx context.Context) (supervisor.Supervisor, error) {
+		// the context of the constructor has the values of the message
+		// acquiring the pool, which the supervisor outlives
 		sv, err := params.SupervisorFactory(supervisor.Params{
-			Context: ctx,
-			Config:  params.Config.Supervisor,
-			Log:     params.Log,
+			Context:  params.Context,
+			Config:   params.Config.Supervisor,
+			Counters: counters,
+			Log:      params.Log,
 		})
 		if err != nil {
 			return nil, err
@@ -169,10 +557,14 @@ func createPool(
 			return nil, err
 		}
 
+		onStarted(sv)
+
 		return sv, nil
 	}
 
 	destructor := func(s supervisor.Supervisor) {
+		defer onStopped(s)
+
 		wait, err := s.Shutdown(params.Context)
 		if err != nil {
 			log.Error("error shutting down supervisor", zap.Error(err))
@@ -189,16 +581,20 @@ func createPool(
 		}
 	}
 
+	return puddle.NewPool(&puddle.Config[supervisor.Supervisor]{
+		Constructor: constructor,
+		Destructor:  destructor,
+		MaxSize:     int32(poolSize(params.Config.MaxWorkers)),
+	})
+}
+
+// poolSize returns the size of the pool for the given max workers.
+func poolSize(maxWorkers int) int {
 	// if the max workers is less than or equal to 0,
 	// default to the number of logical CPUs
-	maxWorkers := params.Config.MaxWorkers
 	if maxWorkers <= 0 {
-		maxWorkers = runtime.NumCPU()
+		return runtime.NumCPU()
 	}
 
-	return puddle.NewPool(&puddle.Config[supervisor.Supervisor]{
-		Constructor: constructor,
-		Destructor:  destructor,
-		MaxSize:     int32(maxWorkers),
-	})
+	return maxWorkers
 }
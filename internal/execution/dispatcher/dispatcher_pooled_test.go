@@ -2,6 +2,7 @@ package dispatcher_test
 
 import (
 	"context"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -44,6 +45,34 @@ func TestPooledDispatcher_Send(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestPooledDispatcher_Send_CreatesSupervisorWithoutMessageValues(t *testing.T) {
+	type key struct{}
+
+	sv := supervisor.NewMockSupervisor(t)
+	sv.EXPECT().Capabilities().Return(nil).Maybe()
+
+	var svCtx context.Context
+	factory := func(params supervisor.Params) (supervisor.Supervisor, error) {
+		svCtx = params.Context
+		return sv, nil
+	}
+
+	m, _ := createPooledDispatcherWithFactory(factory)
+
+	data := map[string]any{"data": "data"}
+
+	sv.EXPECT().Start(mock.Anything).Return(nil)
+	sv.EXPECT().Send(mock.Anything, "test", data).Return(&supervisor.Result{Data: data}, nil)
+
+	// the message starting the supervisor does not pass on its values
+	ctx := context.WithValue(context.Background(), key{}, "message")
+
+	_, err := m.Send(ctx, "test", data)
+	assert.NoError(t, err)
+	assert.NotNil(t, svCtx)
+	assert.Nil(t, svCtx.Value(key{}))
+}
+
 func TestPooledDispatcher_Send_FailsToAcquireSupervisor(t *testing.T) {
 	factory := func(params supervisor.Params) (supervisor.Supervisor, error) {
 		return nil, assert.AnError
@@ -86,6 +115,29 @@ func TestPooledDispatcher_Send_Fails(t *testing.T) {
 	m.Shutdown(context.Background())
 }
 
+func TestPooledDispatcher_Send_WorkerErrorReusesSupervisor(t *testing.T) {
+	m, sv, _ := createPooledDispatcher(t)
+
+	data := map[string]any{"data": "data"}
+
+	sv.EXPECT().Start(mock.Anything).Return(nil).Once()
+	sv.EXPECT().Shutdown(mock.Anything).Return(nil, nil).Once()
+	sv.EXPECT().Send(mock.Anything, "test", data).Return(nil, workerError{})
+
+	for range 2 {
+		_, err := m.Send(context.Background(), "test", data)
+		assert.ErrorIs(t, err, workerError{})
+
+		// wait for the release to happen in the background goroutine
+		<-time.After(1 * time.Millisecond)
+	}
+
+	// the supervisor is only shut down when the pool is closed
+	m.Shutdown(context.Background())
+
+	sv.AssertNumberOfCalls(t, "Start", 1)
+}
+
 func TestPooledDispatcher_Send_ReleaseSupervisorWait(t *testing.T) {
 	m, sv, _ := createPooledDispatcher(t)
 
@@ -216,6 +268,144 @@ func TestPooledDispatcher_Send_ReleaseSupervisorWaitErrorShutdown(t *testing.T)
 	assert.Equal(t, 1, waited)
 }
 
+func TestPooledDispatcher_Start_ReadyWithoutPrewarm(t *testing.T) {
+	m, _, _ := createPooledDispatcher(t)
+
+	err := m.Start(context.Background())
+	assert.NoError(t, err)
+
+	assert.True(t, m.Ready())
+}
+
+func TestPooledDispatcher_Start_PrewarmsIdleSupervisors(t *testing.T) {
+	sv := supervisor.NewMockSupervisor(t)
+	sv.EXPECT().Capabilities().Return(nil).Maybe()
+	sv.EXPECT().Shutdown(mock.Anything).Return(nil, nil)
+
+	started := make(chan struct{})
+	sv.EXPECT().Start(mock.Anything).RunAndReturn(func(context.Context) error {
+		<-started
+		return nil
+	}).Times(2)
+
+	m, err := dispatcher.NewPooledDispatcher(dispatcher.PooledDispatcherParams{
+		Config: dispatcher.PooledDispatcherConfig{
+			MaxWorkers:     4,
+			MinIdle:        2,
+			PrewarmOnStart: true,
+		},
+		Context: context.Background(),
+		SupervisorFactory: func(supervisor.Params) (supervisor.Supervisor, error) {
+			return sv, nil
+		},
+		Log: zap.NewNop(),
+	})
+	assert.NoError(t, err)
+
+	err = m.Start(context.Background())
+	assert.NoError(t, err)
+
+	// the dispatcher is not ready until the idle supervisors are started
+	assert.False(t, m.Ready())
+
+	close(started)
+
+	assert.Eventually(t, m.Ready, time.Second, time.Millisecond)
+
+	m.Shutdown(context.Background())
+
+	sv.AssertNumberOfCalls(t, "Shutdown", 2)
+}
+
+func TestPooledDispatcher_Send_TopsUpWarmPool(t *testing.T) {
+	sv := supervisor.NewMockSupervisor(t)
+	sv.EXPECT().Capabilities().Return(nil).Maybe()
+	sv.EXPECT().Shutdown(mock.Anything).Return(nil, nil)
+
+	var starts atomic.Int32
+	sv.EXPECT().Start(mock.Anything).RunAndReturn(func(context.Context) error {
+		starts.Add(1)
+		return nil
+	})
+
+	data := map[string]any{"data": "data"}
+
+	sv.EXPECT().Send(mock.Anything, "test", data).Return(nil, assert.AnError)
+
+	m, err := dispatcher.NewPooledDispatcher(dispatcher.PooledDispatcherParams{
+		Config: dispatcher.PooledDispatcherConfig{
+			MaxWorkers:     1,
+			PrewarmOnStart: true,
+		},
+		Context: context.Background(),
+		SupervisorFactory: func(supervisor.Params) (supervisor.Supervisor, error) {
+			return sv, nil
+		},
+		Log: zap.NewNop(),
+	})
+	assert.NoError(t, err)
+
+	err = m.Start(context.Background())
+	assert.NoError(t, err)
+
+	assert.Eventually(t, m.Ready, time.Second, time.Millisecond)
+	assert.Equal(t, int32(1), starts.Load())
+
+	// the failed supervisor is destroyed and replaced in the background
+	_, err = m.Send(context.Background(), "test", data)
+	assert.ErrorIs(t, err, assert.AnError)
+
+	assert.Eventually(t, func() bool {
+		return starts.Load() == 2
+	}, time.Second, time.Millisecond)
+
+	m.Shutdown(context.Background())
+}
+
+func TestPooledDispatcher_Drain_RejectsMessages(t *testing.T) {
+	m, _, _ := createPooledDispatcher(t)
+
+	err := m.Start(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, m.Ready())
+
+	err = m.Drain(context.Background())
+	assert.NoError(t, err)
+	assert.False(t, m.Ready())
+
+	_, err = m.Send(context.Background(), "test", map[string]any{})
+	assert.ErrorIs(t, err, dispatcher.ErrDraining)
+}
+
+func TestPooledDispatcher_Stats_RecordsMessages(t *testing.T) {
+	m, sv, _ := createPooledDispatcher(t)
+
+	data := map[string]any{"data": "data"}
+
+	sv.EXPECT().Start(mock.Anything).Return(nil)
+	sv.EXPECT().Shutdown(mock.Anything).Return(nil, nil)
+	sv.EXPECT().Send(mock.Anything, "test", data).Return(&supervisor.Result{}, nil)
+
+	for range 2 {
+		_, err := m.Send(context.Background(), "test", data)
+		assert.NoError(t, err)
+
+		// wait for the release to happen in the background goroutine
+		<-time.After(1 * time.Millisecond)
+	}
+
+	stats := m.Stats()
+
+	assert.Equal(t, 1, stats.Pool.Max)
+	assert.Equal(t, 1, stats.Pool.Total)
+	assert.Equal(t, int64(2), stats.Pool.AcquireCount)
+	assert.Equal(t, int64(2), stats.AcquireWait.Count)
+	assert.Equal(t, int64(2), stats.Commands["test"].Count)
+	assert.Equal(t, 0, stats.Queue.Inflight)
+
+	m.Shutdown(context.Background())
+}
+
 func TestPooledDispatcher_Shutdown_DestroysSupervisor(t *testing.T) {
 	m, sv, _ := createPooledDispatcher(t)
 
@@ -235,11 +425,82 @@ func TestPooledDispatcher_Shutdown_DestroysSupervisor(t *testing.T) {
 	m.Shutdown(context.Background())
 }
 
+func TestPooledDispatcher_Send_SharesSupervisorUpToMaxConcurrency(t *testing.T) {
+	var created atomic.Int32
+
+	entered := make(chan struct{}, 4)
+	unblock := make(chan struct{})
+
+	factory := func(params supervisor.Params) (supervisor.Supervisor, error) {
+		created.Add(1)
+
+		sv := supervisor.NewMockSupervisor(t)
+		sv.EXPECT().Start(mock.Anything).Return(nil)
+		sv.EXPECT().Capabilities().Return(nil).Maybe()
+		sv.EXPECT().Shutdown(mock.Anything).Return(nil, nil).Maybe()
+		sv.EXPECT().Send(mock.Anything, "test", mock.Anything).RunAndReturn(
+			func(context.Context, string, map[string]any) (*supervisor.Result, error) {
+				entered <- struct{}{}
+				<-unblock
+				return &supervisor.Result{}, nil
+			},
+		)
+
+		return sv, nil
+	}
+
+	m, err := dispatcher.NewPooledDispatcher(dispatcher.PooledDispatcherParams{
+		Config: dispatcher.PooledDispatcherConfig{
+			MaxWorkers: 2,
+			Supervisor: supervisor.Config{
+				IO:             supervisor.IOConfig{Interface: supervisor.RpcIO},
+				MaxConcurrency: 2,
+			},
+		},
+		Context:           context.Background(),
+		SupervisorFactory: factory,
+		Log:               zap.NewNop(),
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, 4, m.Stats().Queue.Capacity)
+
+	done := make(chan error, 4)
+	for range 4 {
+		go func() {
+			_, err := m.Send(context.Background(), "test", nil)
+			done <- err
+		}()
+	}
+
+	// all messages are in flight at once, on two supervisors
+	for range 4 {
+		select {
+		case <-entered:
+		case <-time.After(time.Second):
+			t.Fatal("messages are not sent concurrently")
+		}
+	}
+
+	assert.Equal(t, int32(2), created.Load())
+
+	close(unblock)
+
+	for range 4 {
+		assert.NoError(t, <-done)
+	}
+
+	m.Shutdown(context.Background())
+}
+
 // MARK: - helpers
 
 func createPooledDispatcher(t *testing.T) (dispatcher.Dispatcher, *supervisor.MockSupervisor, error) {
 	sv := supervisor.NewMockSupervisor(t)
 
+	// capabilities are queried after starting a supervisor
+	sv.EXPECT().Capabilities().Return(nil).Maybe()
+
 	factory := func(params supervisor.Params) (supervisor.Supervisor, error) {
 		return sv, nil
 	}
@@ -264,3 +525,10 @@ func createPooledDispatcherWithFactory(
 		Log:               zap.NewNop(),
 	})
 }
+
+// workerError is an error reported by the worker itself.
+type workerError struct{}
+
+func (workerError) Error() string { return "worker error" }
+
+func (workerError) ErrorCode() int { return -32000 }
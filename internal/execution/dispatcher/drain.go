@@ -0,0 +1,85 @@
+package dispatcher
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// drain rejects new messages, and waits for the queued and in-flight
+// messages to finish. Messages still in flight after the timeout, or
+// once ctx is done, are aborted. Drain may be called multiple times.
+func (a *admission) drain(ctx context.Context, timeout time.Duration, log *zap.Logger) {
+	a.mu.Lock()
+	if !a.draining {
+		a.draining = true
+		log.Info("draining messages",
+			zap.Int("inflight", a.inflight),
+			zap.Int("queued", a.queue.len),
+			zap.Duration("timeout", timeout),
+		)
+	}
+	a.checkDrained()
+	a.mu.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-a.drained:
+		return
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+
+	a.mu.Lock()
+	log.Warn("aborting messages after drain period",
+		zap.Int("inflight", a.inflight),
+		zap.Int("queued", a.queue.len),
+	)
+	a.mu.Unlock()
+
+	a.abort()
+
+	// aborted messages return right away
+	select {
+	case <-a.drained:
+	case <-ctx.Done():
+	}
+}
+
+// isDraining returns true once the dispatcher started draining.
+func (a *admission) isDraining() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.draining
+}
+
+// bind returns a context for handling an admitted message, which is
+// cancelled if in-flight messages are aborted at the end of a drain.
+func (a *admission) bind(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(a.aborted, cancel)
+
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// checkDrained closes the drained channel once no message is queued or
+// in flight while draining. The caller must hold the lock.
+func (a *admission) checkDrained() {
+	if !a.draining || a.inflight > 0 || a.queue.len > 0 {
+		return
+	}
+
+	select {
+	case <-a.drained:
+		// already closed
+	default:
+		close(a.drained)
+	}
+}
@@ -0,0 +1,71 @@
+package dispatcher
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestAdmission_Drain_WaitsForInflightMessages(t *testing.T) {
+	a := createAdmission(t, QueueConfig{}, 1)
+
+	release, err := a.admit(context.Background(), "eval")
+	require.NoError(t, err)
+
+	ctx, cancel := a.bind(context.Background())
+	defer cancel()
+
+	drained := make(chan struct{})
+	go func() {
+		a.drain(context.Background(), time.Second, zap.NewNop())
+		close(drained)
+	}()
+
+	assert.Eventually(t, a.isDraining, time.Second, time.Millisecond)
+
+	// new messages are rejected while draining
+	_, err = a.admit(context.Background(), "eval")
+	assert.ErrorIs(t, err, ErrDraining)
+
+	release()
+
+	<-drained
+
+	// the message finished in time, so it was not aborted
+	assert.NoError(t, ctx.Err())
+}
+
+func TestAdmission_Drain_AbortsMessagesAfterTimeout(t *testing.T) {
+	a := createAdmission(t, QueueConfig{}, 1)
+
+	release, err := a.admit(context.Background(), "eval")
+	require.NoError(t, err)
+
+	ctx, cancel := a.bind(context.Background())
+	defer cancel()
+
+	// release the slot once the message is aborted
+	go func() {
+		<-ctx.Done()
+		release()
+	}()
+
+	a.drain(context.Background(), 10*time.Millisecond, zap.NewNop())
+
+	assert.ErrorIs(t, ctx.Err(), context.Canceled)
+}
+
+func TestAdmission_Drain_ReturnsIfIdle(t *testing.T) {
+	a := createAdmission(t, QueueConfig{}, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	a.drain(ctx, time.Minute, zap.NewNop())
+
+	assert.NoError(t, ctx.Err())
+}
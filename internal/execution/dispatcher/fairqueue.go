@@ -0,0 +1,256 @@
+package dispatcher
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// defaultWeight is the weight of commands and tenants without a
+// configured weight.
+const defaultWeight = 1
+
+type tenantKey struct{}
+
+// ContextWithTenant returns a context that carries the given tenant.
+// Messages sent with the context are queued fairly with the messages of
+// other tenants, if all workers are busy.
+func ContextWithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFromContext returns the tenant in ctx, or an empty string.
+func TenantFromContext(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
+
+// parseWeights parses a list of `key=weight` entries.
+func parseWeights(entries []string) (map[string]float64, error) {
+	weights := make(map[string]float64, len(entries))
+
+	for _, entry := range entries {
+		key, value, ok := strings.Cut(entry, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid weight '%s', expected key=weight", entry)
+		}
+
+		weight, err := strconv.ParseFloat(value, 64)
+		if err != nil || weight <= 0 {
+			return nil, fmt.Errorf("invalid weight '%s', expected a positive number", entry)
+		}
+
+		weights[key] = weight
+	}
+
+	return weights, nil
+}
+
+// fairQueue queues waiters in flows, and picks the next waiter using
+// weighted fair queuing. Each flow is served in proportion to its
+// weight while it has waiters, so flows with a low weight get a bounded
+// share of the capacity, instead of being starved.
+//
+// Waiters are queued in two levels: by command, and by tenant within
+// each command. Waiters of the same tenant and command are served in
+// the order they arrived.
+type fairQueue struct {
+	commands *flowSet
+
+	commandWeights map[string]float64
+	tenantWeights  map[string]float64
+
+	// len is the number of waiters in the queue
+	len int
+}
+
+func newFairQueue(commandWeights, tenantWeights map[string]float64) *fairQueue {
+	return &fairQueue{
+		commands:       newFlowSet(),
+		commandWeights: commandWeights,
+		tenantWeights:  tenantWeights,
+	}
+}
+
+// queueEntry is the position of a waiter in the queue.
+type queueEntry struct {
+	command *flow
+	tenant  *flow
+	elem    *list.Element
+}
+
+// push queues a waiter for the given command and tenant.
+func (q *fairQueue) push(command, tenant string, waiter any) *queueEntry {
+	c := q.commands.get(command, weightOf(q.commandWeights, command))
+	if c.tenants == nil {
+		c.tenants = newFlowSet()
+	}
+
+	t := c.tenants.get(tenant, weightOf(q.tenantWeights, tenant))
+
+	q.commands.add(c)
+	c.tenants.add(t)
+	q.len++
+
+	return &queueEntry{
+		command: c,
+		tenant:  t,
+		elem:    t.waiters.PushBack(waiter),
+	}
+}
+
+// pop removes and returns the next waiter, or nil if the queue is empty.
+func (q *fairQueue) pop() any {
+	c := q.commands.pick()
+	if c == nil {
+		return nil
+	}
+
+	t := c.tenants.pick()
+
+	entry := &queueEntry{command: c, tenant: t, elem: t.waiters.Front()}
+	q.remove(entry)
+
+	return entry.elem.Value
+}
+
+// remove removes a waiter from the queue.
+func (q *fairQueue) remove(entry *queueEntry) {
+	entry.tenant.waiters.Remove(entry.elem)
+
+	entry.command.tenants.done(entry.tenant)
+	q.commands.done(entry.command)
+	q.len--
+}
+
+// flowSet is a set of flows sharing the capacity of their parent.
+type flowSet struct {
+	flows map[string]*flow
+
+	// vtime is the virtual time, i.e. the start tag of the waiter
+	// served last. It advances slower the more flows are waiting.
+	vtime float64
+
+	// pending is the number of waiters of all flows in the set
+	pending int
+
+	// served counts the waiters served from the set
+	served uint64
+}
+
+func newFlowSet() *flowSet {
+	return &flowSet{flows: map[string]*flow{}}
+}
+
+// flow is a command or tenant with waiters in the queue.
+type flow struct {
+	key    string
+	weight float64
+
+	// tag is the virtual finish tag of the next waiter of the flow
+	tag float64
+
+	// finish is the virtual finish tag of the last waiter served
+	finish float64
+
+	// lastServed is the sequence number of the last waiter served
+	lastServed uint64
+
+	// pending is the number of waiters of the flow
+	pending int
+
+	// tenants are the tenant flows of a command flow
+	tenants *flowSet
+
+	// waiters are the waiters of a tenant flow
+	waiters list.List
+}
+
+// get returns the flow for the given key, creating it if needed.
+func (s *flowSet) get(key string, weight float64) *flow {
+	f, ok := s.flows[key]
+	if !ok {
+		f = &flow{key: key, weight: weight}
+		s.flows[key] = f
+	}
+
+	return f
+}
+
+// add adds a waiter to the flow. If the flow was not waiting before,
+// its next waiter starts at the current virtual time, so flows do not
+// accumulate credit while not waiting.
+func (s *flowSet) add(f *flow) {
+	if f.pending == 0 {
+		f.tag = max(s.vtime, f.finish) + 1/f.weight
+	}
+
+	f.pending++
+	s.pending++
+}
+
+// done removes a waiter from the flow. Once no flow in the set is
+// waiting, the flows are reset, as there is no contention to account for.
+func (s *flowSet) done(f *flow) {
+	f.pending--
+	s.pending--
+
+	if s.pending == 0 {
+		clear(s.flows)
+	}
+}
+
+// pick returns the waiting flow with the smallest virtual finish tag,
+// and advances the virtual time, or returns nil if no flow is waiting.
+func (s *flowSet) pick() *flow {
+	var next *flow
+
+	for _, f := range s.flows {
+		if f.pending == 0 {
+			// drop flows that no longer affect the fairness of the set
+			if f.finish <= s.vtime {
+				delete(s.flows, f.key)
+			}
+			continue
+		}
+
+		if next == nil || f.tag < next.tag || (f.tag == next.tag && servedBefore(f, next)) {
+			next = f
+		}
+	}
+
+	if next == nil {
+		return nil
+	}
+
+	s.served++
+	s.vtime = next.tag - 1/next.weight
+
+	next.finish = next.tag
+	next.lastServed = s.served
+
+	// the next waiter of the flow starts once this one finished
+	next.tag = next.finish + 1/next.weight
+
+	return next
+}
+
+// servedBefore breaks ties between flows with the same finish tag, in
+// favor of the flow served least recently.
+func servedBefore(a, b *flow) bool {
+	if a.lastServed != b.lastServed {
+		return a.lastServed < b.lastServed
+	}
+
+	return a.key < b.key
+}
+
+func weightOf(weights map[string]float64, key string) float64 {
+	if weight, ok := weights[key]; ok {
+		return weight
+	}
+
+	return defaultWeight
+}
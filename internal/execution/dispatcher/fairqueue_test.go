@@ -0,0 +1,81 @@
+package dispatcher
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFairQueue_Pop_ServesCommandsByWeight(t *testing.T) {
+	q := newFairQueue(map[string]float64{"eval": 3}, nil)
+
+	for i := range 8 {
+		q.push("eval", "", i)
+		q.push("preview", "", i)
+	}
+
+	counts := map[string]int{}
+	for range 8 {
+		c := q.commands.pick()
+		counts[c.key]++
+
+		// pop the waiter of the picked command without picking again
+		t := c.tenants.pick()
+		q.remove(&queueEntry{command: c, tenant: t, elem: t.waiters.Front()})
+	}
+
+	assert.Equal(t, map[string]int{"eval": 6, "preview": 2}, counts)
+}
+
+func TestFairQueue_Pop_ServesTenantsFairly(t *testing.T) {
+	q := newFairQueue(nil, nil)
+
+	q.push("eval", "a", "a1")
+	q.push("eval", "a", "a2")
+	q.push("eval", "a", "a3")
+	q.push("eval", "b", "b1")
+
+	assert.Equal(t, "a1", q.pop())
+	assert.Equal(t, "b1", q.pop())
+	assert.Equal(t, "a2", q.pop())
+	assert.Equal(t, "a3", q.pop())
+	assert.Nil(t, q.pop())
+}
+
+func TestFairQueue_Pop_DoesNotAccumulateCredit(t *testing.T) {
+	q := newFairQueue(nil, nil)
+
+	for i := range 3 {
+		q.push("preview", "", i)
+	}
+
+	assert.Equal(t, 0, q.pop())
+	assert.Equal(t, 1, q.pop())
+
+	// a command that was not waiting is not served exclusively
+	q.push("eval", "", "e1")
+	q.push("eval", "", "e2")
+
+	assert.Equal(t, "e1", q.pop())
+	assert.Equal(t, 2, q.pop())
+	assert.Equal(t, "e2", q.pop())
+}
+
+func TestFairQueue_Remove_PrunesFlows(t *testing.T) {
+	q := newFairQueue(nil, nil)
+
+	entry := q.push("eval", "a", "a1")
+	q.remove(entry)
+
+	assert.Equal(t, 0, q.len)
+	assert.Empty(t, q.commands.flows)
+	assert.Nil(t, q.pop())
+}
+
+func TestTenantFromContext(t *testing.T) {
+	assert.Equal(t, "", TenantFromContext(context.Background()))
+
+	ctx := ContextWithTenant(context.Background(), "a")
+	assert.Equal(t, "a", TenantFromContext(ctx))
+}
@@ -0,0 +1,198 @@
+package dispatcher
+
+import (
+	"context"
+	"sync"
+
+	"github.com/jackc/puddle/v2"
+
+	"github.com/lambda-feedback/shimmy/internal/execution/supervisor"
+)
+
+// lease is a supervisor acquired from the pool, that is shared by up to
+// the configured number of concurrent messages.
+type lease struct {
+	resource *puddle.Resource[supervisor.Supervisor]
+
+	// inflight is the number of messages sent to the supervisor
+	inflight int
+
+	// failed is set if a message failed due to the supervisor. No more
+	// messages are sent to it, and it is destroyed once it is idle.
+	failed bool
+}
+
+// multiplexer shares the supervisors acquired from the pool between
+// concurrent messages, as persistent workers may handle multiple
+// messages over the same connection at once.
+type multiplexer struct {
+	mu sync.Mutex
+
+	// concurrency is the number of messages a supervisor may handle
+	concurrency int
+
+	// leases holds the supervisors acquired from the pool
+	leases []*lease
+
+	// waiters holds the cancel functions of messages waiting for the
+	// pool. They are woken up if a shared supervisor has a free slot.
+	waiters map[*context.CancelFunc]struct{}
+}
+
+func newMultiplexer(concurrency int) *multiplexer {
+	return &multiplexer{
+		concurrency: max(concurrency, 1),
+		waiters:     make(map[*context.CancelFunc]struct{}),
+	}
+}
+
+// join adds a message to the acquired supervisor with the fewest
+// messages in flight. If no supervisor has a free slot, the message
+// waits for the pool. The returned context is canceled once a shared
+// supervisor has a free slot, and must be released using done.
+func (x *multiplexer) join(ctx context.Context) (_ *lease, _ context.Context, done func()) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	var best *lease
+
+	for _, l := range x.leases {
+		if l.failed || l.inflight >= x.concurrency {
+			continue
+		}
+
+		if best == nil || l.inflight < best.inflight {
+			best = l
+		}
+	}
+
+	if best != nil {
+		best.inflight++
+		return best, nil, nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	// concurrency of 1 never frees a slot of a shared supervisor
+	if x.concurrency == 1 {
+		return nil, ctx, cancel
+	}
+
+	x.waiters[&cancel] = struct{}{}
+
+	return nil, ctx, func() {
+		x.mu.Lock()
+		delete(x.waiters, &cancel)
+		x.mu.Unlock()
+
+		cancel()
+	}
+}
+
+// add shares a supervisor acquired from the pool, holding one message.
+func (x *multiplexer) add(resource *puddle.Resource[supervisor.Supervisor]) *lease {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	l := &lease{resource: resource, inflight: 1}
+	x.leases = append(x.leases, l)
+
+	// let waiting messages join the free slots of the supervisor
+	if x.concurrency > 1 {
+		x.wake()
+	}
+
+	return l
+}
+
+// leave removes a message from the supervisor. It returns true if the
+// supervisor is idle, and must be returned to the pool by the caller.
+func (x *multiplexer) leave(l *lease, failed bool) bool {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	l.inflight--
+	l.failed = l.failed || failed
+
+	if l.inflight > 0 {
+		// a slot became available, let a waiting message join
+		if !l.failed {
+			x.wake()
+		}
+		return false
+	}
+
+	for i, other := range x.leases {
+		if other == l {
+			x.leases = append(x.leases[:i], x.leases[i+1:]...)
+			break
+		}
+	}
+
+	return true
+}
+
+// wake wakes up all waiting messages, so they try to join a shared
+// supervisor again. The number of waiting messages is bounded by the
+// admission control. x.mu must be held.
+func (x *multiplexer) wake() {
+	for cancel := range x.waiters {
+		delete(x.waiters, cancel)
+		(*cancel)()
+	}
+}
+
+// MARK: - Pooled Dispatcher
+
+// acquireLease acquires a supervisor for a message. Idle supervisors are
+// used first. Otherwise, supervisors that are already in use are shared,
+// up to the configured concurrency. Only if none has a free slot, a new
+// supervisor is started, or the message waits for the pool.
+func (m *PooledDispatcher) acquireLease(ctx context.Context) (*lease, error) {
+	// spread messages across the started workers, before sharing them
+	if m.mux.concurrency > 1 && m.pool.Stat().IdleResources() > 0 {
+		if resource, err := m.pool.TryAcquire(ctx); err == nil {
+			m.requestTopUp()
+			return m.mux.add(resource), nil
+		}
+	}
+
+	for {
+		l, waitCtx, done := m.mux.join(ctx)
+		if l != nil {
+			return l, nil
+		}
+
+		resource, err := m.acquire(waitCtx)
+		woken := err != nil && waitCtx.Err() != nil && ctx.Err() == nil
+		done()
+
+		if err == nil {
+			m.requestTopUp()
+			return m.mux.add(resource), nil
+		}
+
+		// retry joining, if woken up due to a free slot
+		if !woken {
+			return nil, err
+		}
+	}
+}
+
+// releaseLease removes a message from its supervisor. The supervisor is
+// returned to the pool once idle, or destroyed if a message failed.
+func (m *PooledDispatcher) releaseLease(l *lease, failed bool) {
+	if !m.mux.leave(l, failed) {
+		return
+	}
+
+	if l.failed {
+		m.log.Debug("destroying supervisor due to error")
+		l.resource.Destroy()
+		m.requestTopUp()
+		return
+	}
+
+	m.log.Debug("releasing supervisor back to pool")
+	l.resource.Release()
+}
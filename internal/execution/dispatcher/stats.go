@@ -0,0 +1,264 @@
+package dispatcher
+
+import (
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/lambda-feedback/shimmy/internal/execution/supervisor"
+)
+
+// latencySamples is the number of recent samples percentiles are
+// computed from, per recorder.
+const latencySamples = 1024
+
+// histogramBounds are the upper bounds of the buckets latencies are
+// counted in, over the lifetime of a recorder.
+var histogramBounds = []time.Duration{
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+	30 * time.Second,
+	60 * time.Second,
+}
+
+// Stats is a snapshot of the state and history of a dispatcher.
+type Stats struct {
+	// Pool describes the supervisors managed by the dispatcher.
+	Pool PoolStats `json:"pool"`
+
+	// Queue describes the messages waiting for a worker.
+	Queue QueueStats `json:"queue"`
+
+	// Breaker describes the state of the circuit breaker.
+	Breaker BreakerStats `json:"breaker"`
+
+	// Workers counts the lifecycle events of the workers.
+	Workers supervisor.WorkerStats `json:"workers"`
+
+	// AcquireWait is the time messages waited for a worker.
+	AcquireWait LatencyStats `json:"acquire_wait"`
+
+	// Commands is the time to handle messages, by command.
+	Commands map[string]LatencyStats `json:"commands"`
+}
+
+// PoolStats describes the supervisors managed by a dispatcher.
+type PoolStats struct {
+	// Max is the maximum number of supervisors.
+	Max int `json:"max"`
+
+	// Target is the number of supervisors the pool is scaled to. It
+	// equals Max, unless the pool is scaled adaptively.
+	Target int `json:"target"`
+
+	// Total is the number of supervisors, including those starting.
+	Total int `json:"total"`
+
+	// Idle is the number of started supervisors not handling a message.
+	Idle int `json:"idle"`
+
+	// Constructing is the number of supervisors being started.
+	Constructing int `json:"constructing"`
+
+	// Acquired is the number of supervisors handling a message.
+	Acquired int `json:"acquired"`
+
+	// AcquireCount is the number of supervisors acquired.
+	AcquireCount int64 `json:"acquire_count"`
+
+	// EmptyAcquireCount is the number of acquires that had to wait
+	// for a supervisor to be started or released.
+	EmptyAcquireCount int64 `json:"empty_acquire_count"`
+
+	// CanceledAcquireCount is the number of acquires that were
+	// canceled before a supervisor was available.
+	CanceledAcquireCount int64 `json:"canceled_acquire_count"`
+}
+
+// QueueStats describes the messages waiting for a worker.
+type QueueStats struct {
+	// Depth is the number of messages waiting for a worker.
+	Depth int `json:"depth"`
+
+	// Inflight is the number of messages being handled.
+	Inflight int `json:"inflight"`
+
+	// Capacity is the number of messages handled concurrently.
+	Capacity int `json:"capacity"`
+
+	// Rejected is the number of messages rejected by admission control.
+	Rejected int64 `json:"rejected"`
+
+	// Draining is set once the dispatcher started draining.
+	Draining bool `json:"draining"`
+}
+
+// LatencyStats summarizes the recent samples of a latency. Durations
+// are in milliseconds.
+type LatencyStats struct {
+	// Count is the total number of samples.
+	Count int64 `json:"count"`
+
+	// Mean is the mean of the recent samples.
+	Mean float64 `json:"mean_ms"`
+
+	// P50, P90 and P99 are percentiles of the recent samples.
+	P50 float64 `json:"p50_ms"`
+	P90 float64 `json:"p90_ms"`
+	P99 float64 `json:"p99_ms"`
+
+	// Max is the maximum of the recent samples.
+	Max float64 `json:"max_ms"`
+
+	// Histogram counts all samples, e.g. to be exported as metrics.
+	Histogram Histogram `json:"-"`
+}
+
+// Histogram counts samples in cumulative buckets.
+type Histogram struct {
+	// Bounds are the upper bounds of the buckets.
+	Bounds []time.Duration
+
+	// Counts are the number of samples less than or equal to each bound.
+	Counts []uint64
+
+	// Sum is the sum of all samples.
+	Sum time.Duration
+}
+
+// latencyRecorder keeps the most recent samples of a latency.
+type latencyRecorder struct {
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+	count   int64
+
+	// buckets and sum count all samples, by histogram bound
+	buckets []uint64
+	sum     time.Duration
+}
+
+func newLatencyRecorder() *latencyRecorder {
+	return &latencyRecorder{
+		samples: make([]time.Duration, 0, latencySamples),
+		buckets: make([]uint64, len(histogramBounds)),
+	}
+}
+
+// observe adds a sample, replacing the oldest sample once full.
+func (r *latencyRecorder) observe(d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.count++
+	r.sum += d
+
+	for i, bound := range histogramBounds {
+		if d <= bound {
+			r.buckets[i]++
+		}
+	}
+
+	if len(r.samples) < cap(r.samples) {
+		r.samples = append(r.samples, d)
+		return
+	}
+
+	r.samples[r.next] = d
+	r.next = (r.next + 1) % len(r.samples)
+}
+
+// stats summarizes the recent samples.
+func (r *latencyRecorder) stats() LatencyStats {
+	r.mu.Lock()
+	samples := slices.Clone(r.samples)
+	count := r.count
+	histogram := Histogram{
+		Bounds: histogramBounds,
+		Counts: slices.Clone(r.buckets),
+		Sum:    r.sum,
+	}
+	r.mu.Unlock()
+
+	stats := LatencyStats{Count: count, Histogram: histogram}
+	if len(samples) == 0 {
+		return stats
+	}
+
+	slices.Sort(samples)
+
+	var sum time.Duration
+	for _, sample := range samples {
+		sum += sample
+	}
+
+	stats.Mean = milliseconds(sum / time.Duration(len(samples)))
+	stats.P50 = milliseconds(percentile(samples, 0.50))
+	stats.P90 = milliseconds(percentile(samples, 0.90))
+	stats.P99 = milliseconds(percentile(samples, 0.99))
+	stats.Max = milliseconds(samples[len(samples)-1])
+
+	return stats
+}
+
+// percentile returns the nearest-rank percentile of the sorted samples.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p * float64(len(sorted))))
+	return sorted[max(rank, 1)-1]
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// dispatcherStats records the history of a dispatcher.
+type dispatcherStats struct {
+	// workers counts the lifecycle events of the workers, and is
+	// shared by all supervisors of the dispatcher
+	workers *supervisor.Counters
+
+	// acquireWait records the time messages waited for a worker
+	acquireWait *latencyRecorder
+
+	// commands records the time to handle messages, by command
+	commands sync.Map
+}
+
+func newDispatcherStats() *dispatcherStats {
+	return &dispatcherStats{
+		workers:     &supervisor.Counters{},
+		acquireWait: newLatencyRecorder(),
+	}
+}
+
+// observeCommand records the time to handle a message of the command.
+func (s *dispatcherStats) observeCommand(command string, d time.Duration) {
+	recorder, ok := s.commands.Load(command)
+	if !ok {
+		recorder, _ = s.commands.LoadOrStore(command, newLatencyRecorder())
+	}
+
+	recorder.(*latencyRecorder).observe(d)
+}
+
+// fill adds the recorded history to the stats.
+func (s *dispatcherStats) fill(stats *Stats) {
+	stats.Workers = s.workers.Snapshot()
+	stats.AcquireWait = s.acquireWait.stats()
+	stats.Commands = make(map[string]LatencyStats)
+
+	s.commands.Range(func(command, recorder any) bool {
+		stats.Commands[command.(string)] = recorder.(*latencyRecorder).stats()
+		return true
+	})
+}
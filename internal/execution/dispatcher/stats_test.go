@@ -0,0 +1,70 @@
+package dispatcher
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLatencyRecorder_Stats_Empty(t *testing.T) {
+	r := newLatencyRecorder()
+
+	stats := r.stats()
+	stats.Histogram = Histogram{}
+
+	assert.Equal(t, LatencyStats{}, stats)
+}
+
+func TestLatencyRecorder_Stats_Percentiles(t *testing.T) {
+	r := newLatencyRecorder()
+
+	for i := 100; i >= 1; i-- {
+		r.observe(time.Duration(i) * time.Millisecond)
+	}
+
+	stats := r.stats()
+	stats.Histogram = Histogram{}
+
+	assert.Equal(t, LatencyStats{
+		Count: 100,
+		Mean:  50.5,
+		P50:   50,
+		P90:   90,
+		P99:   99,
+		Max:   100,
+	}, stats)
+}
+
+func TestLatencyRecorder_Observe_KeepsRecentSamples(t *testing.T) {
+	r := newLatencyRecorder()
+
+	for range latencySamples {
+		r.observe(time.Second)
+	}
+
+	for range latencySamples {
+		r.observe(time.Millisecond)
+	}
+
+	stats := r.stats()
+
+	assert.Equal(t, int64(2*latencySamples), stats.Count)
+	assert.Equal(t, float64(1), stats.Max)
+}
+
+func TestLatencyRecorder_Stats_Histogram(t *testing.T) {
+	r := newLatencyRecorder()
+
+	r.observe(time.Millisecond)
+	r.observe(20 * time.Millisecond)
+	r.observe(2 * time.Minute)
+
+	histogram := r.stats().Histogram
+
+	assert.Equal(t, histogramBounds, histogram.Bounds)
+	assert.Equal(t, uint64(1), histogram.Counts[0])
+	assert.Equal(t, uint64(2), histogram.Counts[2])
+	assert.Equal(t, uint64(2), histogram.Counts[len(histogram.Counts)-1])
+	assert.Equal(t, 2*time.Minute+21*time.Millisecond, histogram.Sum)
+}
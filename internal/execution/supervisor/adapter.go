@@ -38,6 +38,10 @@ type Adapter interface {
 
 	// Send sends the given data to the worker and returns the response.
 	Send(context.Context, string, map[string]any, time.Duration) (map[string]any, error)
+
+	// Capabilities returns the capabilities reported by the worker, or
+	// nil if the worker did not report any.
+	Capabilities() *Capabilities
 }
 
 // MARK: - factory
@@ -49,11 +53,18 @@ func defaultAdapterFactory(
 	config IOConfig,
 	log *zap.Logger,
 ) (Adapter, error) {
+	if _, err := getMessageCodec(config.Encoding); err != nil {
+		return nil, err
+	}
+
 	switch config.Interface {
 	case FileIO:
-		return newFileAdapter(workerFactory, log), nil
+		return newFileAdapter(workerFactory, config.File, config.Encoding, log), nil
 	case RpcIO:
-		return newRpcAdapter(workerFactory, config.Rpc, log), nil
+		if len(config.Rpc.Attach.Endpoints) > 0 {
+			return newAttachAdapter(config.Rpc, config.Encoding, log), nil
+		}
+		return newRpcAdapter(workerFactory, config.Rpc, config.Encoding, log), nil
 	default:
 		return nil, ErrUnsupportedIOInterface
 	}
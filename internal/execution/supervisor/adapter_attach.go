@@ -0,0 +1,468 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+
+	"github.com/lambda-feedback/shimmy/internal/execution/worker"
+	"github.com/lambda-feedback/shimmy/internal/tracing"
+)
+
+var ErrNoHealthyEndpoint = errors.New("no healthy endpoint available")
+
+// defaultHealthCheckInterval is the default interval between two
+// health checks of the endpoints in attach mode.
+const defaultHealthCheckInterval = 10 * time.Second
+
+// maxHealthCheckTimeout is the maximum time a single health check
+// call may take before the endpoint is considered unhealthy.
+const maxHealthCheckTimeout = 5 * time.Second
+
+// AttachConfig describes the configuration for attach mode. In attach
+// mode, the supervisor connects to externally managed workers, e.g. in
+// a sidecar container, instead of spawning a worker process.
+type AttachConfig struct {
+	// Endpoints is the list of endpoints to connect to. If set, attach
+	// mode is enabled. The format of the endpoints depends on the rpc
+	// transport, e.g. urls for http and ws, addresses for tcp, and the
+	// socket path or pipe name for ipc. The stdio transport is not
+	// supported in attach mode.
+	Endpoints []string `conf:"endpoints"`
+
+	// Balancing is the strategy used to distribute messages across
+	// the healthy endpoints. Default is "round_robin".
+	Balancing BalancingStrategy `conf:"balancing"`
+
+	// HealthCheckInterval is the interval between two health checks.
+	// Unhealthy endpoints are reconnected during health checks.
+	// Default is 10s.
+	HealthCheckInterval time.Duration `conf:"health_check_interval"`
+
+	// HealthCheckMethod is an optional rpc method that is called on
+	// healthy endpoints during health checks. If the call fails, the
+	// endpoint is marked unhealthy. If empty, endpoints are only marked
+	// unhealthy if sending a message fails due to a connection error.
+	HealthCheckMethod string `conf:"health_check_method"`
+}
+
+// healthCheckInterval returns the configured interval, or the default.
+func (c AttachConfig) healthCheckInterval() time.Duration {
+	if c.HealthCheckInterval > 0 {
+		return c.HealthCheckInterval
+	}
+
+	return defaultHealthCheckInterval
+}
+
+// attachEndpoint is a single endpoint of an attach adapter.
+type attachEndpoint struct {
+	address string
+
+	// mu guards client
+	mu     sync.Mutex
+	client *rpcConnection
+
+	// inflight is the number of messages currently sent to the endpoint.
+	inflight atomic.Int64
+}
+
+// getClient returns the client of the endpoint, or nil if the
+// endpoint is not connected.
+func (e *attachEndpoint) getClient() *rpcConnection {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.client
+}
+
+// setClient replaces the client of the endpoint, closing the previous one.
+func (e *attachEndpoint) setClient(client *rpcConnection) {
+	e.mu.Lock()
+	prev := e.client
+	e.client = client
+	e.mu.Unlock()
+
+	if prev != nil {
+		prev.Close()
+	}
+}
+
+// attachAdapter is an adapter that connects to externally managed
+// workers over rpc, without spawning any process. Messages are
+// balanced across all healthy endpoints.
+type attachAdapter struct {
+	endpoints []*attachEndpoint
+
+	// next is the index of the next endpoint for round robin balancing.
+	next atomic.Uint64
+
+	// notifications receives notifications sent by the workers. It is
+	// shared by all endpoints, and only set if notifications are enabled.
+	notifications *notificationService
+
+	// capabilities are the capabilities reported by the first
+	// endpoint that completed the handshake.
+	capabilities atomic.Pointer[Capabilities]
+
+	// cancel stops the health checks, done is closed once they stopped.
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	codec    messageCodec
+	encoding MessageEncoding
+	config   RpcConfig
+	log      *zap.Logger
+}
+
+var _ Adapter = (*attachAdapter)(nil)
+
+func newAttachAdapter(
+	config RpcConfig,
+	encoding MessageEncoding,
+	log *zap.Logger,
+) *attachAdapter {
+	endpoints := make([]*attachEndpoint, len(config.Attach.Endpoints))
+	for i, address := range config.Attach.Endpoints {
+		endpoints[i] = &attachEndpoint{address: address}
+	}
+
+	return &attachAdapter{
+		endpoints: endpoints,
+		encoding:  encoding,
+		config:    config,
+		log:       log.Named("adapter_attach"),
+	}
+}
+
+func (a *attachAdapter) Start(ctx context.Context, _ worker.StartConfig) error {
+	if len(a.endpoints) == 0 {
+		return errors.New("no endpoints to attach to")
+	}
+
+	if a.config.Transport == StdioTransport {
+		return fmt.Errorf("%w: stdio cannot be used in attach mode", ErrUnsupportedIOTransport)
+	}
+
+	switch a.config.Attach.Balancing {
+	case "", RoundRobinBalancing, LeastInflightBalancing:
+	default:
+		return fmt.Errorf("unsupported balancing strategy: %s", a.config.Attach.Balancing)
+	}
+
+	codec, err := getMessageCodec(a.encoding)
+	if err != nil {
+		return err
+	}
+
+	if codec.binary() && !supportsBinaryEncoding(a.config.Transport) {
+		return fmt.Errorf("%w: %s not supported by %s transport",
+			ErrUnsupportedEncoding, codec.encoding, a.config.Transport)
+	}
+
+	a.codec = codec
+
+	if a.config.Notifications {
+		a.notifications = newNotificationService(a.log.Named("function"))
+	}
+
+	// wait for at least one endpoint to become healthy
+	if err := a.connectWithRetry(
+		ctx,
+		100*time.Millisecond, // initial delay
+		10*time.Second,       // max delay
+	); err != nil {
+		return err
+	}
+
+	healthCtx, cancel := context.WithCancel(context.Background())
+
+	a.cancel = cancel
+	a.done = make(chan struct{})
+
+	go a.runHealthChecks(healthCtx)
+
+	return nil
+}
+
+func (a *attachAdapter) Send(
+	ctx context.Context,
+	method string,
+	data map[string]any,
+	timeout time.Duration,
+) (_ map[string]any, err error) {
+	endpoint, client := a.pickEndpoint()
+	if endpoint == nil {
+		return nil, ErrNoHealthyEndpoint
+	}
+
+	endpoint.inflight.Add(1)
+	defer endpoint.inflight.Add(-1)
+
+	ctx, span := startSendSpan(ctx, method,
+		attribute.String("server.address", endpoint.address),
+	)
+	defer func() { tracing.End(span, err) }()
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if a.notifications != nil {
+		var done func()
+		data, done = a.notifications.track(ctx, data)
+		defer done()
+	}
+
+	data = withTraceContext(ctx, data)
+
+	var result map[string]any
+
+	if err := client.CallContext(ctx, &result, method, data); err != nil {
+		// errors returned by the worker do not affect the connection
+		if !IsWorkerError(err) && ctx.Err() == nil {
+			a.markUnhealthy(endpoint, client, err)
+		}
+
+		return nil, fmt.Errorf("error sending rpc request to %s: %w", endpoint.address, err)
+	}
+
+	return map[string]any{"result": result, "command": method}, nil
+}
+
+func (a *attachAdapter) Capabilities() *Capabilities {
+	return a.capabilities.Load()
+}
+
+func (a *attachAdapter) Stop() (ReleaseFunc, error) {
+	if a.cancel != nil {
+		a.cancel()
+	}
+
+	for _, endpoint := range a.endpoints {
+		endpoint.setClient(nil)
+	}
+
+	done := a.done
+
+	// the workers are managed externally, so we only
+	// need to wait for the health checks to stop
+	return func(ctx context.Context) error {
+		if done == nil {
+			return nil
+		}
+
+		select {
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}, nil
+}
+
+// pickEndpoint returns a healthy endpoint and its client, according to
+// the configured balancing strategy. If no endpoint is healthy, nil is
+// returned.
+func (a *attachAdapter) pickEndpoint() (*attachEndpoint, *rpcConnection) {
+	n := len(a.endpoints)
+	start := int(a.next.Add(1) % uint64(n))
+
+	var (
+		picked       *attachEndpoint
+		pickedClient *rpcConnection
+	)
+
+	for i := 0; i < n; i++ {
+		endpoint := a.endpoints[(start+i)%n]
+
+		client := endpoint.getClient()
+		if client == nil {
+			continue
+		}
+
+		if a.config.Attach.Balancing != LeastInflightBalancing {
+			return endpoint, client
+		}
+
+		if picked == nil || endpoint.inflight.Load() < picked.inflight.Load() {
+			picked, pickedClient = endpoint, client
+		}
+	}
+
+	return picked, pickedClient
+}
+
+// markUnhealthy disconnects the endpoint, if the client is still the
+// current client of the endpoint. The endpoint is reconnected during
+// the next health check.
+func (a *attachAdapter) markUnhealthy(endpoint *attachEndpoint, client *rpcConnection, err error) {
+	endpoint.mu.Lock()
+	current := endpoint.client == client
+	if current {
+		endpoint.client = nil
+	}
+	endpoint.mu.Unlock()
+
+	if !current {
+		return
+	}
+
+	client.Close()
+
+	a.log.Warn("endpoint unhealthy",
+		zap.String("endpoint", endpoint.address),
+		zap.Error(err),
+	)
+}
+
+// connectWithRetry connects all endpoints, retrying with an exponential
+// backoff until at least one endpoint is healthy, or ctx is done.
+func (a *attachAdapter) connectWithRetry(
+	ctx context.Context,
+	baseDelay time.Duration,
+	maxDelay time.Duration,
+) error {
+	for i := 0; ; i++ {
+		if a.checkHealth(ctx) > 0 {
+			return nil
+		}
+
+		// Calculate the backoff delay with a cap at maxDelay
+		backoffDelay := baseDelay * time.Duration(math.Pow(2, float64(i)))
+		if backoffDelay > maxDelay {
+			backoffDelay = maxDelay
+		}
+
+		a.log.Debug("no healthy endpoint",
+			zap.Int("retry", i),
+			zap.Duration("backoff", backoffDelay),
+		)
+
+		select {
+		case <-time.After(backoffDelay):
+			// Continue to the next retry
+		case <-ctx.Done():
+			return fmt.Errorf("error attaching to endpoints: %w", ErrNoHealthyEndpoint)
+		}
+	}
+}
+
+// runHealthChecks periodically checks the health of all endpoints,
+// until ctx is done.
+func (a *attachAdapter) runHealthChecks(ctx context.Context) {
+	defer close(a.done)
+
+	ticker := time.NewTicker(a.config.Attach.healthCheckInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			a.checkHealth(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// checkHealth checks all endpoints concurrently, reconnecting unhealthy
+// endpoints, and returns the number of healthy endpoints.
+func (a *attachAdapter) checkHealth(ctx context.Context) int {
+	var (
+		wg      sync.WaitGroup
+		healthy atomic.Int64
+	)
+
+	for _, endpoint := range a.endpoints {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if a.checkEndpoint(ctx, endpoint) {
+				healthy.Add(1)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	return int(healthy.Load())
+}
+
+// checkEndpoint checks the health of a single endpoint, connecting
+// it if necessary, and returns true if the endpoint is healthy.
+func (a *attachAdapter) checkEndpoint(ctx context.Context, endpoint *attachEndpoint) bool {
+	client := endpoint.getClient()
+	if client == nil {
+		return a.connectEndpoint(ctx, endpoint)
+	}
+
+	if a.config.Attach.HealthCheckMethod == "" {
+		return true
+	}
+
+	timeout := min(a.config.Attach.healthCheckInterval(), maxHealthCheckTimeout)
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var result any
+	if err := client.CallContext(ctx, &result, a.config.Attach.HealthCheckMethod); err != nil {
+		a.markUnhealthy(endpoint, client, err)
+		return false
+	}
+
+	return true
+}
+
+// connectEndpoint dials the endpoint and performs the handshake, if
+// enabled. It returns true if the endpoint was connected.
+func (a *attachAdapter) connectEndpoint(ctx context.Context, endpoint *attachEndpoint) bool {
+	log := a.log.With(zap.String("endpoint", endpoint.address))
+
+	client, err := dialEndpoint(ctx, a.config.Transport, endpoint.address, a.codec)
+	if err != nil {
+		log.Debug("error dialing", zap.Error(err))
+		return false
+	}
+
+	if a.notifications != nil {
+		if err := client.RegisterName(notificationNamespace, a.notifications); err != nil {
+			log.Warn("error registering notification service", zap.Error(err))
+			client.Close()
+			return false
+		}
+	}
+
+	if a.config.Initialize {
+		capabilities, err := initializeClient(ctx, client.Client, log)
+		if err != nil {
+			log.Warn("error initializing endpoint", zap.Error(err))
+			client.Close()
+			return false
+		}
+
+		if capabilities != nil {
+			a.capabilities.CompareAndSwap(nil, capabilities)
+		}
+	}
+
+	endpoint.setClient(client)
+
+	// the adapter may have been stopped while connecting
+	if ctx.Err() != nil {
+		endpoint.setClient(nil)
+		return false
+	}
+
+	log.Info("attached to endpoint")
+
+	return true
+}
@@ -0,0 +1,195 @@
+package supervisor
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/lambda-feedback/shimmy/internal/execution/worker"
+)
+
+func TestAttachAdapter_Send_RoundRobin(t *testing.T) {
+	a := createAttachAdapter(t, AttachConfig{
+		Endpoints: []string{
+			serveFakeEndpoint(t, "a"),
+			serveFakeEndpoint(t, "b"),
+		},
+	})
+
+	err := a.Start(context.Background(), worker.StartConfig{})
+	require.NoError(t, err)
+	defer a.Stop()
+
+	counts := map[any]int{}
+	for range 4 {
+		res, err := a.Send(context.Background(), "eval", map[string]any{}, time.Second)
+		require.NoError(t, err)
+		counts[res["result"].(map[string]any)["endpoint"]]++
+	}
+
+	assert.Equal(t, map[any]int{"a": 2, "b": 2}, counts)
+}
+
+func TestAttachAdapter_Send_SkipsUnreachableEndpoints(t *testing.T) {
+	a := createAttachAdapter(t, AttachConfig{
+		Endpoints: []string{
+			unreachableEndpoint(t),
+			serveFakeEndpoint(t, "a"),
+		},
+	})
+
+	err := a.Start(context.Background(), worker.StartConfig{})
+	require.NoError(t, err)
+	defer a.Stop()
+
+	for range 2 {
+		res, err := a.Send(context.Background(), "eval", map[string]any{}, time.Second)
+		require.NoError(t, err)
+		assert.Equal(t, "a", res["result"].(map[string]any)["endpoint"])
+	}
+}
+
+func TestAttachAdapter_Send_ReconnectsUnhealthyEndpoint(t *testing.T) {
+	a := createAttachAdapter(t, AttachConfig{
+		Endpoints: []string{serveFakeEndpoint(t, "a")},
+	})
+
+	err := a.Start(context.Background(), worker.StartConfig{})
+	require.NoError(t, err)
+	defer a.Stop()
+
+	// the fake endpoint closes the connection on this method
+	_, err = a.Send(context.Background(), "disconnect", map[string]any{}, time.Second)
+	assert.Error(t, err)
+
+	_, err = a.Send(context.Background(), "eval", map[string]any{}, time.Second)
+	assert.ErrorIs(t, err, ErrNoHealthyEndpoint)
+
+	assert.Equal(t, 1, a.checkHealth(context.Background()))
+
+	_, err = a.Send(context.Background(), "eval", map[string]any{}, time.Second)
+	assert.NoError(t, err)
+}
+
+func TestAttachAdapter_Start_FailsWithoutHealthyEndpoint(t *testing.T) {
+	a := createAttachAdapter(t, AttachConfig{
+		Endpoints: []string{unreachableEndpoint(t)},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	err := a.Start(ctx, worker.StartConfig{})
+	assert.ErrorIs(t, err, ErrNoHealthyEndpoint)
+}
+
+func TestAttachAdapter_Start_FailsForStdio(t *testing.T) {
+	a := newAttachAdapter(RpcConfig{
+		Transport: StdioTransport,
+		Attach:    AttachConfig{Endpoints: []string{"a"}},
+	}, JSONEncoding, zap.NewNop())
+
+	err := a.Start(context.Background(), worker.StartConfig{})
+	assert.ErrorIs(t, err, ErrUnsupportedIOTransport)
+}
+
+func TestAttachAdapter_PickEndpoint_LeastInflight(t *testing.T) {
+	a := newAttachAdapter(RpcConfig{
+		Transport: TcpTransport,
+		Attach: AttachConfig{
+			Endpoints: []string{"a", "b", "c"},
+			Balancing: LeastInflightBalancing,
+		},
+	}, JSONEncoding, zap.NewNop())
+
+	for i, endpoint := range a.endpoints {
+		client := rpc.DialInProc(rpc.NewServer())
+		defer client.Close()
+
+		endpoint.client = &rpcConnection{Client: client}
+		endpoint.inflight.Store(int64(3 - i))
+	}
+
+	// the endpoint with the fewest messages in flight is picked
+	for range 3 {
+		endpoint, _ := a.pickEndpoint()
+		assert.Equal(t, "c", endpoint.address)
+	}
+
+	// disconnected endpoints are never picked
+	a.endpoints[2].client = nil
+
+	endpoint, _ := a.pickEndpoint()
+	assert.Equal(t, "b", endpoint.address)
+}
+
+// MARK: - helpers
+
+func createAttachAdapter(t *testing.T, config AttachConfig) *attachAdapter {
+	return newAttachAdapter(RpcConfig{
+		Transport: TcpTransport,
+		Attach:    config,
+	}, JSONEncoding, zap.NewNop())
+}
+
+// serveFakeEndpoint serves a fake json-rpc endpoint over tcp, which
+// replies to every message with its name. The connection is closed if
+// the `disconnect` method is called.
+func serveFakeEndpoint(t *testing.T, name string) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+
+				enc := json.NewEncoder(conn)
+				dec := json.NewDecoder(conn)
+
+				for {
+					var msg fakeMessage
+					if err := dec.Decode(&msg); err != nil {
+						return
+					}
+
+					if msg.Method == "disconnect" {
+						return
+					}
+
+					_ = enc.Encode(fakeMessage{
+						Version: "2.0",
+						ID:      msg.ID,
+						Result:  map[string]any{"endpoint": name},
+					})
+				}
+			}()
+		}
+	}()
+
+	return l.Addr().String()
+}
+
+// unreachableEndpoint returns the address of a closed tcp listener.
+func unreachableEndpoint(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	addr := l.Addr().String()
+	l.Close()
+
+	return addr
+}
@@ -3,18 +3,17 @@ package supervisor
 import (
 	"bytes"
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"os"
-	"path"
 	"sync"
 	"time"
 
 	"go.uber.org/zap"
 
 	"github.com/lambda-feedback/shimmy/internal/execution/worker"
+	"github.com/lambda-feedback/shimmy/internal/tracing"
 )
 
 // fileAdapter is an adapter that allows supervisors to use files to
@@ -32,17 +31,23 @@ type fileAdapter struct {
 	// worker is the worker that is managed by the adapter.
 	worker worker.Worker
 
-	log *zap.Logger
+	encoding MessageEncoding
+	config   FileConfig
+	log      *zap.Logger
 }
 
 var _ Adapter = (*fileAdapter)(nil)
 
 func newFileAdapter(
 	workerFactory AdapterWorkerFactoryFn,
+	config FileConfig,
+	encoding MessageEncoding,
 	log *zap.Logger,
 ) *fileAdapter {
 	return &fileAdapter{
 		workerFactory: workerFactory,
+		encoding:      encoding,
+		config:        config,
 		log:           log.Named("adapter_file"),
 	}
 }
@@ -65,42 +70,43 @@ func (a *fileAdapter) Send(
 	method string,
 	data map[string]any,
 	timeout time.Duration,
-) (map[string]any, error) {
+) (_ map[string]any, err error) {
 	if a.workerFactory == nil {
 		return nil, errors.New("no worker factory provided")
 	}
 
-	ctx, cancel := context.WithTimeout(ctx, timeout)
-	defer cancel()
+	codec, err := getMessageCodec(a.encoding)
+	if err != nil {
+		return nil, err
+	}
 
-	// temp dir path
-	workingDir := path.Join(os.TempDir(), "shimmy")
+	ctx, span := startSendSpan(ctx, method)
+	defer func() { tracing.End(span, err) }()
 
-	// create temp dir if it doesn't exist
-	err := os.Mkdir(workingDir, 0755)
-	if err != nil && !errors.Is(err, os.ErrExist) {
-		return nil, fmt.Errorf("error creating working dir: %w", err)
-	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
 
-	// create temp dir for request and response files
-	tmpPath, err := os.MkdirTemp(workingDir, "*")
+	// create the scratch dir for request and response files
+	scratchDir, err := a.createScratchDir()
 	if err != nil {
-		return nil, fmt.Errorf("error creating temp dir: %w", err)
+		return nil, err
 	}
 
+	// remove the scratch dir after the request. the deferred function
+	// is registered first, so it runs after all files have been closed.
+	defer func() {
+		a.removeScratchDir(scratchDir, err)
+	}()
+
 	// create temp files for request and response data
-	reqFile, err := os.CreateTemp(tmpPath, "request-data-*")
+	reqFile, err := os.CreateTemp(scratchDir, "request-data-*")
 	if err != nil {
 		return nil, fmt.Errorf("error creating temp file: %w", err)
 	}
-	defer func() {
-		if err := os.Remove(reqFile.Name()); err != nil {
-			a.log.Error("failed to remove request file", zap.Error(err))
-		}
-	}()
 
-	resFile, err := os.CreateTemp(tmpPath, "response-data-*")
+	resFile, err := os.CreateTemp(scratchDir, "response-data-*")
 	if err != nil {
+		reqFile.Close()
 		return nil, fmt.Errorf("error creating temp file: %w", err)
 	}
 
@@ -110,19 +116,14 @@ func (a *fileAdapter) Send(
 		}
 	}()
 
-	defer func() {
-		if err := os.Remove(resFile.Name()); err != nil {
-			a.log.Error("failed to remove response file", zap.Error(err))
-		}
-	}()
-
 	message := map[string]any{
 		"method": method,
 		"params": data,
 	}
 
 	// write message to request file
-	if err := json.NewEncoder(reqFile).Encode(message); err != nil {
+	if err := codec.encode(reqFile, message); err != nil {
+		reqFile.Close()
 		return nil, fmt.Errorf("error writing request data: %w", err)
 	}
 
@@ -138,16 +139,21 @@ func (a *fileAdapter) Send(
 
 	// ensure env is not nil
 	if startParams.Env == nil {
-		startParams.Env = make([]string, 0, 3)
+		startParams.Env = make([]string, 0, 5)
 	}
 
-	// append req and res file names to worker env
+	// append req and res file names and scratch dir to worker env
 	startParams.Env = append(startParams.Env,
 		"EVAL_IO=FILE",
+		"EVAL_ENCODING="+string(codec.encoding),
 		"EVAL_FILE_NAME_REQUEST="+reqFile.Name(),
 		"EVAL_FILE_NAME_RESPONSE="+resFile.Name(),
+		"EVAL_SCRATCH_DIR="+scratchDir,
 	)
 
+	// pass the trace context of the message
+	startParams.Env = append(startParams.Env, tracing.Environ(ctx)...)
+
 	// create the worker with modified args and env
 	worker, err := a.workerFactory(startParams)
 	if err != nil {
@@ -196,16 +202,70 @@ func (a *fileAdapter) Send(
 		return nil, fmt.Errorf("process exited with non-zero code: %s", exitEvent.String())
 	}
 
-	var response map[string]any
+	var decoded any
 
 	// read and decode response data from res file
-	if err := json.NewDecoder(resFile).Decode(&response); err != nil {
+	if err := codec.newDecoder(resFile).Decode(&decoded); err != nil {
 		return nil, fmt.Errorf("error decoding response data: %w", err)
 	}
 
+	// convert the response to the json model used for validation
+	if codec.binary() {
+		if decoded, err = toJSONModel(decoded); err != nil {
+			return nil, fmt.Errorf("error decoding response data: %w", err)
+		}
+	}
+
+	if decoded == nil {
+		return nil, nil
+	}
+
+	response, ok := decoded.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("error decoding response data: unexpected type %T", decoded)
+	}
+
 	return response, nil
 }
 
+// createScratchDir creates a new scratch dir for a single request
+// inside the configured base dir, creating the base dir if necessary.
+func (a *fileAdapter) createScratchDir() (string, error) {
+	baseDir := a.config.scratchBaseDir()
+
+	if err := os.MkdirAll(baseDir, 0755); err != nil {
+		return "", fmt.Errorf("error creating scratch base dir: %w", err)
+	}
+
+	scratchDir, err := os.MkdirTemp(baseDir, scratchDirPrefix+"*")
+	if err != nil {
+		return "", fmt.Errorf("error creating scratch dir: %w", err)
+	}
+
+	return scratchDir, nil
+}
+
+// removeScratchDir removes the scratch dir of a request. If the request
+// failed and failed requests are kept, the dir is left to the janitor.
+func (a *fileAdapter) removeScratchDir(scratchDir string, reqErr error) {
+	if reqErr != nil && a.config.KeepFailed {
+		a.log.Warn("keeping scratch dir of failed request",
+			zap.String("dir", scratchDir),
+			zap.Duration("ttl", a.config.keepFailedTTL()),
+		)
+		return
+	}
+
+	if err := os.RemoveAll(scratchDir); err != nil {
+		a.log.Error("failed to remove scratch dir", zap.String("dir", scratchDir), zap.Error(err))
+	}
+}
+
+func (a *fileAdapter) Capabilities() *Capabilities {
+	// transient workers do not support the capability handshake
+	return nil
+}
+
 func (a *fileAdapter) Stop() (ReleaseFunc, error) {
 	// for fileio, we already stopped the worker, as we do need to wait
 	// for the process to finish in order to read the response data.
@@ -0,0 +1,143 @@
+package supervisor
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// scratchDirPrefix is the prefix of the per-request scratch directories.
+// The janitor only ever removes directories carrying this prefix.
+const scratchDirPrefix = "request-"
+
+// defaultKeepFailedTTL is the default time to keep the scratch directory
+// of a failed request, if keeping failed requests is enabled.
+const defaultKeepFailedTTL = time.Hour
+
+// maxSweepInterval is the maximum interval between two janitor sweeps.
+const maxSweepInterval = time.Minute
+
+// FileConfig describes the configuration for the file interface.
+type FileConfig struct {
+	// ScratchDir is the base directory for per-request scratch
+	// directories, e.g. a tmpfs mount. Default is `$TMPDIR/shimmy`.
+	ScratchDir string `conf:"scratch_dir"`
+
+	// KeepFailed keeps the scratch directory of failed requests for
+	// debugging, instead of removing it after the request.
+	KeepFailed bool `conf:"keep_failed"`
+
+	// KeepFailedTTL is the time after which the scratch directories of
+	// failed requests are removed by the janitor. Default is 1h.
+	KeepFailedTTL time.Duration `conf:"keep_failed_ttl"`
+}
+
+// scratchBaseDir returns the configured base dir, or the default.
+func (c FileConfig) scratchBaseDir() string {
+	if c.ScratchDir != "" {
+		return c.ScratchDir
+	}
+
+	return filepath.Join(os.TempDir(), "shimmy")
+}
+
+// keepFailedTTL returns the configured ttl, or the default.
+func (c FileConfig) keepFailedTTL() time.Duration {
+	if c.KeepFailedTTL > 0 {
+		return c.KeepFailedTTL
+	}
+
+	return defaultKeepFailedTTL
+}
+
+// scratchJanitors holds a janitor per scratch base dir. Janitors are
+// shared, so dispatchers using the same base dir don't sweep concurrently.
+var scratchJanitors sync.Map
+
+// scratchJanitor removes expired scratch directories of failed requests.
+type scratchJanitor struct {
+	mu sync.Mutex
+
+	dir string
+	ttl time.Duration
+}
+
+// getScratchJanitor returns the janitor for the given base dir.
+func getScratchJanitor(dir string, ttl time.Duration) *scratchJanitor {
+	j, _ := scratchJanitors.LoadOrStore(dir, &scratchJanitor{dir: dir, ttl: ttl})
+	return j.(*scratchJanitor)
+}
+
+// RunScratchJanitor periodically removes the expired scratch directories
+// of failed requests, until done is closed. It returns immediately if the
+// file interface is not used, or failed requests are not kept.
+func RunScratchJanitor(config Config, done <-chan struct{}, log *zap.Logger) {
+	if config.IO.Interface != FileIO || !config.IO.File.KeepFailed {
+		return
+	}
+
+	ttl := config.IO.File.keepFailedTTL()
+	j := getScratchJanitor(config.IO.File.scratchBaseDir(), ttl)
+
+	log = log.Named("scratch_janitor")
+
+	ticker := time.NewTicker(min(ttl, maxSweepInterval))
+	defer ticker.Stop()
+
+	// remove dirs left behind by previous runs right away
+	j.sweep(log)
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			j.sweep(log)
+		}
+	}
+}
+
+// sweep removes all scratch directories in the base dir that are older
+// than the ttl.
+func (j *scratchJanitor) sweep(log *zap.Logger) {
+	if !j.mu.TryLock() {
+		// another sweep is in progress
+		return
+	}
+	defer j.mu.Unlock()
+
+	now := time.Now()
+
+	entries, err := os.ReadDir(j.dir)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Warn("failed to read scratch dir", zap.String("dir", j.dir), zap.Error(err))
+		}
+		return
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), scratchDirPrefix) {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil || now.Sub(info.ModTime()) < j.ttl {
+			continue
+		}
+
+		path := filepath.Join(j.dir, entry.Name())
+
+		if err := os.RemoveAll(path); err != nil {
+			log.Warn("failed to remove expired scratch dir", zap.String("dir", path), zap.Error(err))
+			continue
+		}
+
+		log.Debug("removed expired scratch dir", zap.String("dir", path))
+	}
+}
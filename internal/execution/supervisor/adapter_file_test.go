@@ -4,11 +4,15 @@ import (
 	"context"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/fxamacker/cbor/v2"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 
 	"github.com/lambda-feedback/shimmy/internal/execution/worker"
@@ -132,7 +136,191 @@ func TestFileAdapter_Send_ReturnsInvalidDataError(t *testing.T) {
 	w.AssertNotCalled(t, "Start")
 }
 
+func TestFileAdapter_Send_RemovesScratchDir(t *testing.T) {
+	baseDir := t.TempDir()
+
+	a, w := createFileAdapterWithConfig(t, FileConfig{ScratchDir: baseDir})
+
+	var sp worker.StartConfig
+	a.workerFactory = func(params worker.StartConfig) (worker.Worker, error) {
+		sp = params
+		return w, nil
+	}
+
+	var scratchDir string
+
+	w.EXPECT().Start(mock.Anything).RunAndReturn(func(ctx context.Context) error {
+		for _, env := range sp.Env {
+			if dir, ok := strings.CutPrefix(env, "EVAL_SCRATCH_DIR="); ok {
+				scratchDir = dir
+			}
+		}
+		// leave an additional file in the scratch dir
+		_ = os.WriteFile(filepath.Join(scratchDir, "output.log"), nil, 0644)
+		return os.WriteFile(sp.Args[len(sp.Args)-1], []byte("{}"), 0644)
+	})
+	w.EXPECT().ReadPipe().Return(io.NopCloser(strings.NewReader("")), nil)
+	var cell int
+	w.EXPECT().Wait(mock.Anything).Return(worker.ExitEvent{Code: &cell}, nil)
+
+	_, err := a.Send(context.Background(), "test", map[string]any{}, time.Second)
+	assert.NoError(t, err)
+
+	assert.Equal(t, baseDir, filepath.Dir(scratchDir))
+
+	entries, err := os.ReadDir(baseDir)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestFileAdapter_Send_RemovesScratchDirOnError(t *testing.T) {
+	baseDir := t.TempDir()
+
+	a, w := createFileAdapterWithConfig(t, FileConfig{ScratchDir: baseDir})
+
+	w.EXPECT().ReadPipe().Return(io.NopCloser(strings.NewReader("")), nil)
+	w.EXPECT().Start(mock.Anything).Return(assert.AnError)
+
+	_, err := a.Send(context.Background(), "test", map[string]any{}, time.Second)
+	assert.ErrorIs(t, err, assert.AnError)
+
+	entries, err := os.ReadDir(baseDir)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestFileAdapter_Send_KeepsFailedScratchDir(t *testing.T) {
+	baseDir := t.TempDir()
+
+	a, w := createFileAdapterWithConfig(t, FileConfig{
+		ScratchDir: baseDir,
+		KeepFailed: true,
+	})
+
+	w.EXPECT().ReadPipe().Return(io.NopCloser(strings.NewReader("")), nil)
+	w.EXPECT().Start(mock.Anything).Return(assert.AnError)
+
+	_, err := a.Send(context.Background(), "test", map[string]any{}, time.Second)
+	assert.ErrorIs(t, err, assert.AnError)
+
+	entries, err := os.ReadDir(baseDir)
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 1) {
+		files, err := os.ReadDir(filepath.Join(baseDir, entries[0].Name()))
+		assert.NoError(t, err)
+		assert.Len(t, files, 2)
+	}
+}
+
+func TestFileAdapter_Send_CBOR(t *testing.T) {
+	a, w := createFileAdapter(t)
+	a.encoding = CBOREncoding
+
+	var sp worker.StartConfig
+	a.workerFactory = func(params worker.StartConfig) (worker.Worker, error) {
+		sp = params
+		return w, nil
+	}
+
+	w.EXPECT().Start(mock.Anything).RunAndReturn(func(ctx context.Context) error {
+		data, err := os.ReadFile(sp.Args[len(sp.Args)-2])
+		if err != nil {
+			return err
+		}
+
+		var req map[string]any
+		if err := cbor.Unmarshal(data, &req); err != nil {
+			return err
+		}
+
+		res, _ := cbor.Marshal(map[string]any{
+			"command": req["method"],
+			"result":  req["params"],
+		})
+		return os.WriteFile(sp.Args[len(sp.Args)-1], res, 0644)
+	})
+	w.EXPECT().ReadPipe().Return(io.NopCloser(strings.NewReader("")), nil)
+	var cell int
+	w.EXPECT().Wait(mock.Anything).Return(worker.ExitEvent{Code: &cell}, nil)
+
+	res, err := a.Send(context.Background(), "eval", map[string]any{"response": float64(2)}, time.Second)
+	assert.NoError(t, err)
+	assert.Contains(t, sp.Env, "EVAL_ENCODING=cbor")
+	assert.Equal(t, map[string]any{
+		"command": "eval",
+		"result":  map[string]any{"response": float64(2)},
+	}, res)
+}
+
+func TestScratchJanitor_Sweep_RemovesExpiredDirs(t *testing.T) {
+	baseDir := t.TempDir()
+
+	expired := time.Now().Add(-2 * time.Hour)
+
+	for _, name := range []string{"request-expired", "request-recent", "other-expired"} {
+		assert.NoError(t, os.Mkdir(filepath.Join(baseDir, name), 0755))
+	}
+	assert.NoError(t, os.Chtimes(filepath.Join(baseDir, "request-expired"), expired, expired))
+	assert.NoError(t, os.Chtimes(filepath.Join(baseDir, "other-expired"), expired, expired))
+
+	j := &scratchJanitor{dir: baseDir, ttl: time.Hour}
+	j.sweep(zap.NewNop())
+
+	_, err := os.Stat(filepath.Join(baseDir, "request-expired"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	_, err = os.Stat(filepath.Join(baseDir, "request-recent"))
+	assert.NoError(t, err)
+	_, err = os.Stat(filepath.Join(baseDir, "other-expired"))
+	assert.NoError(t, err)
+}
+
+func TestRunScratchJanitor_SweepsWithoutRequests(t *testing.T) {
+	baseDir := t.TempDir()
+
+	expired := time.Now().Add(-2 * time.Hour)
+	dir := filepath.Join(baseDir, "request-expired")
+	assert.NoError(t, os.Mkdir(dir, 0755))
+	assert.NoError(t, os.Chtimes(dir, expired, expired))
+
+	config := Config{IO: IOConfig{
+		Interface: FileIO,
+		File:      FileConfig{ScratchDir: baseDir, KeepFailed: true},
+	}}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+		RunScratchJanitor(config, done, zap.NewNop())
+	}()
+
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(dir)
+		return os.IsNotExist(err)
+	}, time.Second, 10*time.Millisecond)
+
+	close(done)
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("janitor did not stop")
+	}
+}
+
+func TestRunScratchJanitor_DisabledWithoutKeepFailed(t *testing.T) {
+	config := Config{IO: IOConfig{Interface: FileIO}}
+
+	// returns immediately, without waiting for done
+	RunScratchJanitor(config, nil, zap.NewNop())
+}
+
 func createFileAdapter(t *testing.T) (*fileAdapter, *worker.MockWorker) {
+	return createFileAdapterWithConfig(t, FileConfig{})
+}
+
+func createFileAdapterWithConfig(t *testing.T, config FileConfig) (*fileAdapter, *worker.MockWorker) {
 	w := worker.NewMockWorker(t)
 
 	workerFactory := func(params worker.StartConfig) (worker.Worker, error) {
@@ -141,8 +329,33 @@ func createFileAdapter(t *testing.T) (*fileAdapter, *worker.MockWorker) {
 
 	adapter := &fileAdapter{
 		workerFactory: workerFactory,
+		config:        config,
 		log:           zap.NewNop(),
 	}
 
 	return adapter, w
 }
+
+func TestFileAdapter_Send_PassesTraceContext(t *testing.T) {
+	a, w := createFileAdapter(t)
+
+	var sp worker.StartConfig
+	a.workerFactory = func(params worker.StartConfig) (worker.Worker, error) {
+		sp = params
+		return w, nil
+	}
+
+	w.EXPECT().Start(mock.Anything).RunAndReturn(func(ctx context.Context) error {
+		data, _ := os.ReadFile(sp.Args[len(sp.Args)-2])
+		return os.WriteFile(sp.Args[len(sp.Args)-1], data, 0644)
+	})
+	w.EXPECT().ReadPipe().Return(io.NopCloser(strings.NewReader("")), nil)
+	var cell int
+	w.EXPECT().Wait(mock.Anything).Return(worker.ExitEvent{Code: &cell}, nil)
+
+	ctx := trace.ContextWithRemoteSpanContext(context.Background(), testSpanContext(t))
+
+	_, err := a.Send(ctx, "eval", map[string]any{}, time.Second)
+	assert.NoError(t, err)
+	assert.Contains(t, sp.Env, "TRACEPARENT=00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+}
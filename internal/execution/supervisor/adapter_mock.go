@@ -24,6 +24,53 @@ func (_m *MockAdapter) EXPECT() *MockAdapter_Expecter {
 	return &MockAdapter_Expecter{mock: &_m.Mock}
 }
 
+// Capabilities provides a mock function with no fields
+func (_m *MockAdapter) Capabilities() *Capabilities {
+	ret := _m.Called()
+
+	if len(ret) == 0 {
+		panic("no return value specified for Capabilities")
+	}
+
+	var r0 *Capabilities
+	if rf, ok := ret.Get(0).(func() *Capabilities); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*Capabilities)
+		}
+	}
+
+	return r0
+}
+
+// MockAdapter_Capabilities_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Capabilities'
+type MockAdapter_Capabilities_Call struct {
+	*mock.Call
+}
+
+// Capabilities is a helper method to define mock.On call
+func (_e *MockAdapter_Expecter) Capabilities() *MockAdapter_Capabilities_Call {
+	return &MockAdapter_Capabilities_Call{Call: _e.mock.On("Capabilities")}
+}
+
+func (_c *MockAdapter_Capabilities_Call) Run(run func()) *MockAdapter_Capabilities_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run()
+	})
+	return _c
+}
+
+func (_c *MockAdapter_Capabilities_Call) Return(_a0 *Capabilities) *MockAdapter_Capabilities_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *MockAdapter_Capabilities_Call) RunAndReturn(run func() *Capabilities) *MockAdapter_Capabilities_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // Send provides a mock function with given fields: _a0, _a1, _a2, _a3
 func (_m *MockAdapter) Send(_a0 context.Context, _a1 string, _a2 map[string]interface{}, _a3 time.Duration) (map[string]interface{}, error) {
 	ret := _m.Called(_a0, _a1, _a2, _a3)
@@ -11,9 +11,11 @@ import (
 	"time"
 
 	"github.com/ethereum/go-ethereum/rpc"
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
 
 	"github.com/lambda-feedback/shimmy/internal/execution/worker"
+	"github.com/lambda-feedback/shimmy/internal/tracing"
 )
 
 // RpcConfig describes the configuration for the rpc interface.
@@ -50,6 +52,40 @@ type RpcConfig struct {
 
 	// TcpTransport is the configuration for the tcp transport.
 	Tcp TcpTransportConfig `config:"tcp"`
+
+	// StdioTransport is the configuration for the stdio transport.
+	Stdio StdioTransportConfig `conf:"stdio"`
+
+	// AllocateEndpoint allocates a unique endpoint for each worker,
+	// instead of using the configured endpoint. For tcp, http and ws, a
+	// free port on the configured host is used. For ipc, a unique socket
+	// path or pipe name is used. The allocated endpoint is passed to the
+	// worker via the `EVAL_RPC_*` environment variables.
+	AllocateEndpoint bool `conf:"allocate_endpoint"`
+
+	// Attach is the configuration for attach mode. If endpoints are
+	// configured, no worker process is spawned, and the supervisor
+	// connects to the configured endpoints instead.
+	Attach AttachConfig `conf:"attach"`
+
+	// Notifications enables notifications from the worker. If enabled,
+	// each message is tagged with a unique `$id`, and the worker may send
+	// `eval_progress` and `eval_log` notifications referencing that id.
+	// Notifications are not supported by the http transport.
+	Notifications bool `conf:"notifications"`
+
+	// Initialize enables the capability handshake. If enabled, the
+	// `initialize` method is called on the worker after connecting.
+	// The capabilities returned by the worker are used to reject
+	// unsupported commands and to validate request params.
+	Initialize bool `conf:"initialize"`
+}
+
+// StdioTransportConfig describes the configuration for stdio transport.
+type StdioTransportConfig struct {
+	// MaxMessageSize is the maximum size of a single message body in
+	// bytes. Frames exceeding this limit are rejected. Default is 64 MiB.
+	MaxMessageSize int64 `conf:"max_message_size"`
 }
 
 // HttpTransportConfig describes the configuration for http transport.
@@ -89,17 +125,31 @@ type rpcAdapter struct {
 	// rpcClient is the rpc client used to communicate with the worker.
 	rpcClient *rpc.Client
 
-	config RpcConfig
-	log    *zap.Logger
+	// notifications receives notifications sent by the worker. It is
+	// only set if notifications are enabled.
+	notifications *notificationService
+
+	// capabilities are the capabilities reported by the worker during
+	// the handshake. It is nil if the handshake is disabled or failed.
+	capabilities *Capabilities
+
+	// codec is the codec used to encode messages sent to the worker.
+	codec messageCodec
+
+	encoding MessageEncoding
+	config   RpcConfig
+	log      *zap.Logger
 }
 
 func newRpcAdapter(
 	workerFactory AdapterWorkerFactoryFn,
 	config RpcConfig,
+	encoding MessageEncoding,
 	log *zap.Logger,
 ) *rpcAdapter {
 	return &rpcAdapter{
 		workerFactory: workerFactory,
+		encoding:      encoding,
 		config:        config,
 		log:           log.Named("adapter_rpc"),
 	}
@@ -113,7 +163,33 @@ func (a *rpcAdapter) Start(
 		return errors.New("no worker factory provided")
 	}
 
-	params.Env = buildEnv(params.Env, a.config)
+	codec, err := getMessageCodec(a.encoding)
+	if err != nil {
+		return err
+	}
+
+	// binary encodings are only supported by stream-based transports
+	if codec.binary() && !supportsBinaryEncoding(a.config.Transport) {
+		return fmt.Errorf("%w: %s not supported by %s transport",
+			ErrUnsupportedEncoding, codec.encoding, a.config.Transport)
+	}
+
+	a.codec = codec
+
+	// allocate a unique endpoint for the worker, if enabled
+	if a.config.AllocateEndpoint && a.config.Transport != StdioTransport {
+		config, err := allocateEndpoint(a.config)
+		if err != nil {
+			return err
+		}
+
+		a.config = config
+	}
+
+	params.Env = buildEnv(params.Env, a.config, codec.encoding)
+
+	// pass the trace context the worker is started in
+	params.Env = append(params.Env, tracing.Environ(ctx)...)
 
 	// create the worker
 	worker, err := a.workerFactory(params)
@@ -131,7 +207,12 @@ func (a *rpcAdapter) Start(
 		}
 
 		// wrap the pipe in a header stream
-		a.stdioPipe = &headerPrefixPipe{stdio: stdio}
+		a.stdioPipe = newHeaderPrefixPipe(stdio, a.config.Stdio.MaxMessageSize)
+
+		// translate messages if a binary encoding is used
+		if codec.binary() {
+			a.stdioPipe = newTranscodingConn(a.stdioPipe, codec)
+		}
 
 		// TODO: close pipe?
 	}
@@ -143,11 +224,34 @@ func (a *rpcAdapter) Start(
 	}
 
 	// dial the rpc client
-	return a.dialRpcWithRetry(
+	if err := a.dialRpcWithRetry(
 		ctx,
 		100*time.Millisecond, // initial delay
 		10*time.Second,       // max delay
-	)
+	); err != nil {
+		return err
+	}
+
+	if a.config.Notifications {
+		notifications := newNotificationService(a.log.Named("function"))
+
+		if err := a.rpcClient.RegisterName(notificationNamespace, notifications); err != nil {
+			return fmt.Errorf("error registering notification service: %w", err)
+		}
+
+		a.notifications = notifications
+	}
+
+	if a.config.Initialize {
+		capabilities, err := initializeClient(ctx, a.rpcClient, a.log)
+		if err != nil {
+			return err
+		}
+
+		a.capabilities = capabilities
+	}
+
+	return nil
 }
 
 func (a *rpcAdapter) Send(
@@ -155,7 +259,7 @@ func (a *rpcAdapter) Send(
 	method string,
 	data map[string]any,
 	timeout time.Duration,
-) (map[string]any, error) {
+) (_ map[string]any, err error) {
 	if a.worker == nil {
 		return nil, errors.New("no worker provided")
 	}
@@ -166,9 +270,22 @@ func (a *rpcAdapter) Send(
 
 	var result map[string]any
 
+	ctx, span := startSendSpan(ctx, method,
+		attribute.String("shimmy.rpc.transport", string(a.config.Transport)),
+	)
+	defer func() { tracing.End(span, err) }()
+
 	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
+	if a.notifications != nil {
+		var done func()
+		data, done = a.notifications.track(ctx, data)
+		defer done()
+	}
+
+	data = withTraceContext(ctx, data)
+
 	if err := a.rpcClient.CallContext(ctx, &result, method, data); err != nil {
 		return nil, fmt.Errorf("error sending rpc request: %w", err)
 	}
@@ -176,12 +293,34 @@ func (a *rpcAdapter) Send(
 	return map[string]any{"result": result, "command": method}, nil
 }
 
+func (a *rpcAdapter) Capabilities() *Capabilities {
+	return a.capabilities
+}
+
 func (a *rpcAdapter) Stop() (ReleaseFunc, error) {
 	if a.worker == nil {
 		return nil, errors.New("no worker provided")
 	}
 
-	return stopWorker(a.worker)
+	release, err := stopWorker(a.worker)
+	if err != nil {
+		return nil, err
+	}
+
+	// remove the allocated socket, so it does not outlive the worker
+	if a.config.AllocateEndpoint && a.config.Transport == IpcTransport {
+		endpoint := a.config.Ipc.Endpoint
+
+		return func(ctx context.Context) error {
+			if err := release(ctx); err != nil {
+				return err
+			}
+
+			return removeIPCEndpoint(endpoint)
+		}, nil
+	}
+
+	return release, nil
 }
 
 func (a *rpcAdapter) dialRpcWithRetry(
@@ -232,8 +371,7 @@ func (a *rpcAdapter) dialRpc(
 		zap.String("transport", string(config.Transport)),
 	)
 
-	switch config.Transport {
-	case StdioTransport:
+	if config.Transport == StdioTransport {
 		if a.stdioPipe == nil {
 			return nil, errors.New("stdio pipe not available")
 		}
@@ -241,34 +379,105 @@ func (a *rpcAdapter) dialRpc(
 		log.Debug("dialing")
 
 		return rpc.DialIO(ctx, a.stdioPipe, a.stdioPipe)
+	}
 
-	case IpcTransport:
-		endpoint := getIPCEndpoint(config.Ipc)
+	endpoint := getEndpoint(config)
+
+	log.Debug("dialing", zap.String("endpoint", endpoint))
+
+	conn, err := dialEndpoint(ctx, config.Transport, endpoint, a.codec)
+	if err != nil {
+		return nil, err
+	}
 
-		log.Debug("dialing", zap.String("endpoint", endpoint))
+	return conn.Client, nil
+}
 
-		return rpc.DialIPC(ctx, endpoint)
+// IsWorkerError reports whether err was returned by the worker in
+// response to a message, e.g. if the evaluation function failed. Such
+// errors do not affect the health of the worker or its connection.
+func IsWorkerError(err error) bool {
+	var rpcErr rpc.Error
+	return errors.As(err, &rpcErr)
+}
 
-	case HttpTransport:
-		log.Debug("dialing", zap.String("url", config.Http.Url))
+// rpcConnection is an rpc client and the connection it was dialed on.
+// Clients created with rpc.DialIO never close their connection, which
+// prevents the client from shutting down. Therefore, the connection is
+// closed separately, if any.
+type rpcConnection struct {
+	*rpc.Client
+
+	conn io.Closer
+}
+
+// Close closes the connection and the client.
+func (c *rpcConnection) Close() {
+	if c.conn != nil {
+		c.conn.Close()
+	}
+
+	c.Client.Close()
+}
+
+// dialEndpoint dials the rpc client for the given endpoint, using the
+// given transport. The stdio transport is not supported.
+func dialEndpoint(
+	ctx context.Context,
+	transport IOTransport,
+	endpoint string,
+	codec messageCodec,
+) (*rpcConnection, error) {
+	var (
+		client *rpc.Client
+		err    error
+	)
 
+	switch transport {
+	case IpcTransport:
+		if codec.binary() {
+			return dialUnix(ctx, endpoint, codec)
+		}
+
+		client, err = rpc.DialIPC(ctx, endpoint)
+
+	case HttpTransport:
 		// TODO: use custom client
-		return rpc.DialHTTP(config.Http.Url)
+		client, err = rpc.DialHTTP(endpoint)
 
 	case WsTransport:
-		log.Debug("dialing", zap.String("url", config.Ws.Url))
-
 		// TODO: use custom dialer
 		// TODO: do we need to set custom origin?
-		return rpc.DialWebsocket(ctx, config.Ws.Url, "")
+		client, err = rpc.DialWebsocket(ctx, endpoint, "")
 
 	case TcpTransport:
-		log.Debug("dialing", zap.String("address", config.Tcp.Address))
+		return dialTCP(ctx, endpoint, codec)
+
+	default:
+		return nil, ErrUnsupportedIOTransport
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &rpcConnection{Client: client}, nil
+}
 
-		return dialTCP(ctx, config.Tcp.Address)
+// getEndpoint returns the endpoint of the configured transport.
+func getEndpoint(config RpcConfig) string {
+	switch config.Transport {
+	case IpcTransport:
+		return getIPCEndpoint(config.Ipc)
+	case HttpTransport:
+		return config.Http.Url
+	case WsTransport:
+		return config.Ws.Url
+	case TcpTransport:
+		return config.Tcp.Address
 	}
 
-	return nil, ErrUnsupportedIOTransport
+	return ""
 }
 
 func getIPCEndpoint(config IpcTransportConfig) string {
@@ -283,13 +492,14 @@ func getIPCEndpoint(config IpcTransportConfig) string {
 	}
 }
 
-func buildEnv(env []string, config RpcConfig) []string {
+func buildEnv(env []string, config RpcConfig, encoding MessageEncoding) []string {
 	if env == nil {
 		env = make([]string, 0)
 	}
 
 	env = append(env,
 		"EVAL_IO=rpc",
+		"EVAL_ENCODING="+string(encoding),
 		"EVAL_RPC_TRANSPORT="+string(config.Transport),
 	)
 
@@ -307,13 +517,57 @@ func buildEnv(env []string, config RpcConfig) []string {
 	return env
 }
 
-func dialTCP(ctx context.Context, address string) (*rpc.Client, error) {
+func dialTCP(ctx context.Context, address string, codec messageCodec) (*rpcConnection, error) {
 	conn, err := newTCPConnection(ctx, address)
 	if err != nil {
 		return nil, err
 	}
 
-	return rpc.DialIO(ctx, conn, conn)
+	return dialConn(ctx, conn, codec)
+}
+
+// dialUnix dials the unix socket at the given endpoint. It is only used
+// for binary encodings, as rpc.DialIPC always speaks json.
+func dialUnix(ctx context.Context, endpoint string, codec messageCodec) (*rpcConnection, error) {
+	if runtime.GOOS == "windows" {
+		return nil, fmt.Errorf("%w: %s not supported by named pipes",
+			ErrUnsupportedEncoding, codec.encoding)
+	}
+
+	conn, err := new(net.Dialer).DialContext(ctx, "unix", endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	return dialConn(ctx, conn, codec)
+}
+
+// dialConn creates an rpc client on top of the given connection,
+// translating messages if a binary encoding is used.
+func dialConn(ctx context.Context, conn net.Conn, codec messageCodec) (*rpcConnection, error) {
+	var rwc io.ReadWriteCloser = conn
+	if codec.binary() {
+		rwc = newTranscodingConn(conn, codec)
+	}
+
+	client, err := rpc.DialIO(ctx, rwc, rwc)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &rpcConnection{Client: client, conn: conn}, nil
+}
+
+// supportsBinaryEncoding returns true if binary message encodings
+// can be used with the given transport.
+func supportsBinaryEncoding(transport IOTransport) bool {
+	switch transport {
+	case StdioTransport, IpcTransport, TcpTransport:
+		return true
+	}
+
+	return false
 }
 
 func newTCPConnection(ctx context.Context, endpoint string) (net.Conn, error) {
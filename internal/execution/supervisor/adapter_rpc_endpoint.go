@@ -0,0 +1,113 @@
+package supervisor
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// allocateEndpoint returns a copy of the config, with the endpoint of
+// the configured transport replaced by a free port on the configured
+// host, or a unique socket path or pipe name. This allows multiple
+// workers to use socket-based transports on the same host.
+func allocateEndpoint(config RpcConfig) (RpcConfig, error) {
+	var err error
+
+	switch config.Transport {
+	case TcpTransport:
+		config.Tcp.Address, err = allocateAddress(config.Tcp.Address)
+	case HttpTransport:
+		config.Http.Url, err = allocateURL(config.Http.Url)
+	case WsTransport:
+		config.Ws.Url, err = allocateURL(config.Ws.Url)
+	case IpcTransport:
+		config.Ipc.Endpoint = allocateIPCEndpoint()
+	}
+
+	if err != nil {
+		return config, fmt.Errorf("error allocating endpoint: %w", err)
+	}
+
+	return config, nil
+}
+
+// allocateAddress returns the given address with a free port.
+func allocateAddress(address string) (string, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", err
+	}
+
+	port, err := freePort(host)
+	if err != nil {
+		return "", err
+	}
+
+	return net.JoinHostPort(host, port), nil
+}
+
+// allocateURL returns the given url with a free port.
+func allocateURL(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	port, err := freePort(u.Hostname())
+	if err != nil {
+		return "", err
+	}
+
+	u.Host = net.JoinHostPort(u.Hostname(), port)
+
+	return u.String(), nil
+}
+
+// freePort returns a port on the given host that is currently free.
+// The port is picked by the OS, and released before returning, so the
+// worker is able to listen on it.
+func freePort(host string) (string, error) {
+	l, err := net.Listen("tcp", net.JoinHostPort(host, "0"))
+	if err != nil {
+		return "", err
+	}
+	defer l.Close()
+
+	_, port, err := net.SplitHostPort(l.Addr().String())
+	if err != nil {
+		return "", err
+	}
+
+	return port, nil
+}
+
+// allocateIPCEndpoint returns a unique unix socket path or windows named
+// pipe name. The random suffix prevents collisions with stale sockets
+// left behind by crashed workers, even across process restarts.
+func allocateIPCEndpoint() string {
+	name := "shimmy-" + rand.Text()
+
+	if runtime.GOOS == "windows" {
+		return `\\.\pipe\` + name
+	}
+
+	return filepath.Join(os.TempDir(), name+".sock")
+}
+
+// removeIPCEndpoint removes the unix socket at the given endpoint, if
+// it still exists after the worker terminated.
+func removeIPCEndpoint(endpoint string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+
+	if err := os.Remove(endpoint); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,81 @@
+package supervisor
+
+import (
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAllocateEndpoint_Tcp(t *testing.T) {
+	config, err := allocateEndpoint(RpcConfig{
+		Transport: TcpTransport,
+		Tcp:       TcpTransportConfig{Address: "127.0.0.1:7321"},
+	})
+	require.NoError(t, err)
+
+	host, port, err := net.SplitHostPort(config.Tcp.Address)
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.1", host)
+	assert.NotEqual(t, "7321", port)
+
+	// the allocated port is free
+	l, err := net.Listen("tcp", config.Tcp.Address)
+	require.NoError(t, err)
+	l.Close()
+}
+
+func TestAllocateEndpoint_Http_KeepsSchemeAndPath(t *testing.T) {
+	config, err := allocateEndpoint(RpcConfig{
+		Transport: HttpTransport,
+		Http:      HttpTransportConfig{Url: "http://127.0.0.1:7321/rpc"},
+	})
+	require.NoError(t, err)
+
+	u, err := url.Parse(config.Http.Url)
+	require.NoError(t, err)
+	assert.Equal(t, "http", u.Scheme)
+	assert.Equal(t, "127.0.0.1", u.Hostname())
+	assert.NotEqual(t, "7321", u.Port())
+	assert.Equal(t, "/rpc", u.Path)
+}
+
+func TestAllocateEndpoint_Ipc_IsUnique(t *testing.T) {
+	config := RpcConfig{Transport: IpcTransport}
+
+	a, err := allocateEndpoint(config)
+	require.NoError(t, err)
+	b, err := allocateEndpoint(config)
+	require.NoError(t, err)
+
+	assert.NotEqual(t, a.Ipc.Endpoint, b.Ipc.Endpoint)
+	assert.Equal(t, os.TempDir(), filepath.Dir(a.Ipc.Endpoint))
+}
+
+func TestAllocateEndpoint_FailsForInvalidAddress(t *testing.T) {
+	_, err := allocateEndpoint(RpcConfig{
+		Transport: TcpTransport,
+		Tcp:       TcpTransportConfig{Address: "invalid"},
+	})
+	assert.Error(t, err)
+}
+
+func TestBuildEnv_UsesAllocatedEndpoint(t *testing.T) {
+	config, err := allocateEndpoint(RpcConfig{
+		Transport: TcpTransport,
+		Tcp:       TcpTransportConfig{Address: "127.0.0.1:7321"},
+	})
+	require.NoError(t, err)
+
+	env := buildEnv(nil, config, JSONEncoding)
+	assert.Contains(t, env, "EVAL_RPC_TCP_ADDRESS="+config.Tcp.Address)
+}
+
+func TestRemoveIPCEndpoint_IgnoresMissingSocket(t *testing.T) {
+	endpoint := filepath.Join(t.TempDir(), "missing.sock")
+	assert.NoError(t, removeIPCEndpoint(endpoint))
+}
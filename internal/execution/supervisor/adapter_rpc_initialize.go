@@ -0,0 +1,82 @@
+package supervisor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/ethereum/go-ethereum/rpc"
+	"go.uber.org/zap"
+)
+
+// ProtocolVersion is the version of the protocol spoken by the shim.
+// It is sent to the worker as part of the `initialize` handshake.
+const ProtocolVersion = "1"
+
+// initializeMethod is the rpc method used for the capability handshake.
+const initializeMethod = "initialize"
+
+// rpcMethodNotFound is the json-rpc error code for unknown methods.
+const rpcMethodNotFound = -32601
+
+// Capabilities describes the evaluation function, as reported by the
+// worker during the `initialize` handshake.
+type Capabilities struct {
+	// Name is the name of the evaluation function.
+	Name string `json:"name"`
+
+	// Version is the version of the evaluation function.
+	Version string `json:"version"`
+
+	// ProtocolVersion is the protocol version spoken by the worker.
+	ProtocolVersion string `json:"protocol_version"`
+
+	// Commands is the list of commands supported by the worker. If
+	// empty, the worker is assumed to support all commands.
+	Commands []string `json:"commands,omitempty"`
+
+	// ParamsSchema is an optional json schema that the `params`
+	// of incoming requests are validated against.
+	ParamsSchema json.RawMessage `json:"params_schema,omitempty"`
+}
+
+// SupportsCommand returns true if the worker supports the given command.
+func (c *Capabilities) SupportsCommand(command string) bool {
+	return len(c.Commands) == 0 || slices.Contains(c.Commands, command)
+}
+
+// initializeParams are the params sent to the worker on `initialize`.
+type initializeParams struct {
+	ProtocolVersion string `json:"protocol_version"`
+}
+
+// initializeClient performs the capability handshake with the worker. If
+// the worker does not implement the `initialize` method, nil is returned.
+func initializeClient(ctx context.Context, client *rpc.Client, log *zap.Logger) (*Capabilities, error) {
+	var caps Capabilities
+
+	params := initializeParams{ProtocolVersion: ProtocolVersion}
+
+	err := client.CallContext(ctx, &caps, initializeMethod, params)
+
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) && rpcErr.ErrorCode() == rpcMethodNotFound {
+		log.Warn("function does not support initialize, skipping handshake")
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error initializing worker: %w", err)
+	}
+
+	log.Info("function initialized",
+		zap.String("name", caps.Name),
+		zap.String("version", caps.Version),
+		zap.String("protocol_version", caps.ProtocolVersion),
+		zap.Strings("commands", caps.Commands),
+		zap.Bool("params_schema", len(caps.ParamsSchema) > 0),
+	)
+
+	return &caps, nil
+}
@@ -0,0 +1,210 @@
+package supervisor
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// notificationNamespace is the rpc namespace the worker sends its
+// notifications to, e.g. `eval_progress` and `eval_log`.
+const notificationNamespace = "eval"
+
+// requestIDKey is the key of the request id that is injected into the
+// message data, if notifications are enabled. The worker is expected to
+// pass the id along with any notification related to the message.
+const requestIDKey = "$id"
+
+// Progress describes the progress of a message handled by the worker.
+type Progress struct {
+	// Progress is the fraction of work done, between 0 and 1. It
+	// is nil if the worker did not report a fraction.
+	Progress *float64 `json:"progress,omitempty"`
+
+	// Message is a human-readable description of the current step.
+	Message string `json:"message,omitempty"`
+}
+
+// ProgressFunc is a function that is called for every progress
+// notification the worker sends for a message.
+type ProgressFunc func(Progress)
+
+type progressListenerKey struct{}
+
+// ContextWithProgressListener returns a context that carries the given
+// progress listener. Progress notifications sent by the worker for any
+// message sent with the context are passed to the listener.
+func ContextWithProgressListener(ctx context.Context, fn ProgressFunc) context.Context {
+	return context.WithValue(ctx, progressListenerKey{}, fn)
+}
+
+// ProgressListenerFromContext returns the progress listener in ctx, if any.
+func ProgressListenerFromContext(ctx context.Context) (ProgressFunc, bool) {
+	fn, ok := ctx.Value(progressListenerKey{}).(ProgressFunc)
+	return fn, ok && fn != nil
+}
+
+// ProgressParams are the params of an `eval_progress` notification.
+type ProgressParams struct {
+	// ID is the id of the message the progress belongs to.
+	ID uint64 `json:"id"`
+
+	// Seq numbers the progress notifications of a message, starting
+	// at 1. Notifications are handled concurrently, so progress with a
+	// sequence number below the last one delivered is dropped. It is
+	// zero if the worker does not number its notifications.
+	Seq uint64 `json:"seq,omitempty"`
+
+	Progress
+}
+
+// LogParams are the params of an `eval_log` notification.
+type LogParams struct {
+	// ID is the id of the message the log belongs to. It is zero
+	// if the log entry does not belong to a specific message.
+	ID uint64 `json:"id"`
+
+	// Level is the log level, e.g. "debug", "info", "warn" or "error".
+	Level string `json:"level"`
+
+	// Message is the log message.
+	Message string `json:"message"`
+
+	// Fields are additional structured fields of the log entry.
+	Fields map[string]any `json:"fields,omitempty"`
+}
+
+// notificationService receives notifications from the worker. It is
+// registered with the rpc client, which dispatches incoming calls to
+// the exported methods of the service.
+type notificationService struct {
+	mu        sync.Mutex
+	listeners map[uint64]*progressListener
+
+	// nextID is the id of the last message sent to the worker.
+	nextID atomic.Uint64
+
+	log *zap.Logger
+}
+
+func newNotificationService(log *zap.Logger) *notificationService {
+	return &notificationService{
+		listeners: make(map[uint64]*progressListener),
+		log:       log,
+	}
+}
+
+// Progress handles `eval_progress` notifications.
+func (s *notificationService) Progress(params ProgressParams) {
+	s.mu.Lock()
+	l, ok := s.listeners[params.ID]
+	s.mu.Unlock()
+
+	if !ok || !l.deliver(params) {
+		s.log.Debug("dropping progress",
+			zap.Uint64("id", params.ID),
+			zap.Uint64("seq", params.Seq),
+		)
+	}
+}
+
+// Log handles `eval_log` notifications.
+func (s *notificationService) Log(params LogParams) {
+	level, err := zapcore.ParseLevel(params.Level)
+	if err != nil {
+		level = zapcore.InfoLevel
+	}
+
+	// the worker must not be able to panic or exit the shim
+	if level > zapcore.ErrorLevel {
+		level = zapcore.ErrorLevel
+	}
+
+	fields := make([]zap.Field, 0, len(params.Fields)+1)
+	if params.ID != 0 {
+		fields = append(fields, zap.Uint64("id", params.ID))
+	}
+	for k, v := range params.Fields {
+		fields = append(fields, zap.Any(k, v))
+	}
+
+	if ce := s.log.Check(level, params.Message); ce != nil {
+		ce.Write(fields...)
+	}
+}
+
+// track tags the message with a unique id, without modifying the
+// caller's data, and subscribes the progress listener in ctx, if any.
+// The returned function must be called once the message is handled.
+func (s *notificationService) track(ctx context.Context, data map[string]any) (map[string]any, func()) {
+	id := s.nextID.Add(1)
+
+	tagged := make(map[string]any, len(data)+1)
+	for k, v := range data {
+		tagged[k] = v
+	}
+	tagged[requestIDKey] = id
+
+	fn, ok := ProgressListenerFromContext(ctx)
+	if !ok {
+		return tagged, func() {}
+	}
+
+	return tagged, s.subscribe(id, fn)
+}
+
+// subscribe registers the listener for the message with the given id.
+// The returned function must be called to remove the listener again.
+func (s *notificationService) subscribe(id uint64, fn ProgressFunc) func() {
+	l := &progressListener{fn: fn}
+
+	s.mu.Lock()
+	s.listeners[id] = l
+	s.mu.Unlock()
+
+	return func() {
+		s.mu.Lock()
+		delete(s.listeners, id)
+		s.mu.Unlock()
+
+		l.close()
+	}
+}
+
+// progressListener delivers the progress of a single message. The
+// rpc client handles each notification on its own goroutine, so the
+// listener serialises delivery and drops stale or late progress.
+type progressListener struct {
+	mu     sync.Mutex
+	fn     ProgressFunc
+	seq    uint64
+	closed bool
+}
+
+// deliver passes the progress to the listener, unless the listener is
+// closed or a later progress of the message was delivered already.
+func (l *progressListener) deliver(params ProgressParams) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed || (params.Seq != 0 && params.Seq <= l.seq) {
+		return false
+	}
+
+	l.seq = max(l.seq, params.Seq)
+	l.fn(params.Progress)
+
+	return true
+}
+
+// close waits for any progress being delivered, and drops any progress
+// arriving afterwards.
+func (l *progressListener) close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.closed = true
+}
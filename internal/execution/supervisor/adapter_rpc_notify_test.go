@@ -0,0 +1,124 @@
+package supervisor
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestNotificationService_Progress_CallsListener(t *testing.T) {
+	s := newNotificationService(zap.NewNop())
+
+	var received []Progress
+	unsubscribe := s.subscribe(1, func(p Progress) {
+		received = append(received, p)
+	})
+
+	fraction := 0.5
+	s.Progress(ProgressParams{ID: 1, Progress: Progress{Progress: &fraction, Message: "half"}})
+	s.Progress(ProgressParams{ID: 2, Progress: Progress{Message: "other"}})
+
+	unsubscribe()
+
+	s.Progress(ProgressParams{ID: 1, Progress: Progress{Message: "late"}})
+
+	assert.Equal(t, []Progress{{Progress: &fraction, Message: "half"}}, received)
+}
+
+func TestNotificationService_Progress_DropsStaleProgress(t *testing.T) {
+	s := newNotificationService(zap.NewNop())
+
+	var received []string
+	unsubscribe := s.subscribe(1, func(p Progress) {
+		received = append(received, p.Message)
+	})
+	defer unsubscribe()
+
+	s.Progress(ProgressParams{ID: 1, Seq: 2, Progress: Progress{Message: "second"}})
+	s.Progress(ProgressParams{ID: 1, Seq: 1, Progress: Progress{Message: "first"}})
+	s.Progress(ProgressParams{ID: 1, Seq: 3, Progress: Progress{Message: "third"}})
+	s.Progress(ProgressParams{ID: 1, Progress: Progress{Message: "unnumbered"}})
+
+	assert.Equal(t, []string{"second", "third", "unnumbered"}, received)
+}
+
+func TestNotificationService_Progress_NotDeliveredAfterUnsubscribe(t *testing.T) {
+	s := newNotificationService(zap.NewNop())
+
+	delivering := make(chan struct{})
+	release := make(chan struct{})
+
+	var mu sync.Mutex
+	var received []string
+	unsubscribe := s.subscribe(1, func(p Progress) {
+		if p.Message == "first" {
+			close(delivering)
+			<-release
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, p.Message)
+	})
+
+	go s.Progress(ProgressParams{ID: 1, Progress: Progress{Message: "first"}})
+	<-delivering
+
+	// unsubscribing waits for the progress being delivered
+	unsubscribed := make(chan struct{})
+	go func() {
+		unsubscribe()
+		close(unsubscribed)
+	}()
+
+	select {
+	case <-unsubscribed:
+		t.Fatal("unsubscribed while delivering progress")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	close(release)
+	<-unsubscribed
+
+	s.Progress(ProgressParams{ID: 1, Progress: Progress{Message: "late"}})
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"first"}, received)
+}
+
+func TestNotificationService_Log_WritesToLogger(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	s := newNotificationService(zap.New(core))
+
+	s.Log(LogParams{ID: 1, Level: "warn", Message: "careful", Fields: map[string]any{"step": "parse"}})
+	s.Log(LogParams{Level: "fatal", Message: "not fatal"})
+	s.Log(LogParams{Level: "bogus", Message: "defaults to info"})
+
+	entries := logs.AllUntimed()
+	assert.Len(t, entries, 3)
+
+	assert.Equal(t, zapcore.WarnLevel, entries[0].Level)
+	assert.Equal(t, "careful", entries[0].Message)
+	assert.Equal(t, map[string]any{"id": uint64(1), "step": "parse"}, entries[0].ContextMap())
+
+	assert.Equal(t, zapcore.ErrorLevel, entries[1].Level)
+	assert.Equal(t, zapcore.InfoLevel, entries[2].Level)
+}
+
+func TestProgressListenerFromContext(t *testing.T) {
+	_, ok := ProgressListenerFromContext(context.Background())
+	assert.False(t, ok)
+
+	ctx := ContextWithProgressListener(context.Background(), func(Progress) {})
+
+	fn, ok := ProgressListenerFromContext(ctx)
+	assert.True(t, ok)
+	assert.NotNil(t, fn)
+}
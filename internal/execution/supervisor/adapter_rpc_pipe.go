@@ -2,6 +2,7 @@ package supervisor
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
 	"strconv"
@@ -9,97 +10,220 @@ import (
 	"sync"
 )
 
-// headerPrefixPipe wraps another io.ReadWriteCloser and adds LSP-style headers
+// defaultMaxMessageSize is the maximum size of a single message body
+// that is accepted from the worker, if no other limit is configured.
+const defaultMaxMessageSize int64 = 64 << 20 // 64 MiB
+
+var (
+	// ErrMalformedHeader is returned if a frame header can't be parsed.
+	ErrMalformedHeader = errors.New("malformed frame header")
+
+	// ErrMissingContentLength is returned if a frame header does not
+	// contain a Content-Length field.
+	ErrMissingContentLength = errors.New("missing Content-Length header")
+
+	// ErrFrameTooLarge is returned if the Content-Length of a frame
+	// exceeds the configured maximum message size. The body of the frame
+	// is discarded, so subsequent reads continue with the next frame.
+	ErrFrameTooLarge = errors.New("frame exceeds maximum message size")
+)
+
+// TruncatedFrameError is returned if the underlying stream ends in the
+// middle of a frame, either while reading the header or the body.
+type TruncatedFrameError struct {
+	// Header is true if the stream ended while reading the header.
+	Header bool
+
+	// ContentLength is the announced length of the frame body. It is
+	// zero if the stream ended while reading the header.
+	ContentLength int64
+
+	// Received is the number of body bytes read before the stream ended.
+	Received int64
+}
+
+func (e *TruncatedFrameError) Error() string {
+	if e.Header {
+		return "truncated frame: unexpected EOF in header"
+	}
+
+	return fmt.Sprintf(
+		"truncated frame: expected %d bytes, got %d bytes",
+		e.ContentLength,
+		e.Received,
+	)
+}
+
+// Unwrap allows to match truncated frames using io.ErrUnexpectedEOF.
+func (e *TruncatedFrameError) Unwrap() error {
+	return io.ErrUnexpectedEOF
+}
+
+// headerPrefixPipe wraps another io.ReadWriteCloser and frames messages
+// using LSP-style headers. Each frame consists of a header section, which
+// must at least contain a Content-Length field, followed by the body.
+//
+// Reads are streamed: message bodies of any size up to maxSize are passed
+// through to the caller, regardless of the size of the read buffer.
 type headerPrefixPipe struct {
 	stdio io.ReadWriteCloser
-	mu    sync.Mutex
+
+	// maxSize is the maximum size of a single message body. If it is
+	// zero or negative, defaultMaxMessageSize is used.
+	maxSize int64
+
+	rmu sync.Mutex
+	wmu sync.Mutex
+
+	// reader is the persistent buffered reader on top of stdio. It must
+	// not be recreated, as it may have buffered data past the current frame.
+	reader *bufio.Reader
+
+	// remaining is the number of body bytes left in the current frame.
+	remaining int64
+
+	// contentLength is the body length of the current frame.
+	contentLength int64
+}
+
+func newHeaderPrefixPipe(stdio io.ReadWriteCloser, maxSize int64) *headerPrefixPipe {
+	return &headerPrefixPipe{
+		stdio:   stdio,
+		maxSize: maxSize,
+	}
 }
 
 // Write writes data with an LSP-style header to the wrapped ReadWriteCloser
 func (h *headerPrefixPipe) Write(p []byte) (int, error) {
-	h.mu.Lock()
-	defer h.mu.Unlock()
+	h.wmu.Lock()
+	defer h.wmu.Unlock()
 
-	contentLength := len(p)
-	header := fmt.Sprintf("Content-Length: %d\r\n\r\n", contentLength)
+	header := fmt.Sprintf("Content-Length: %d\r\n\r\n", len(p))
 
-	if _, err := h.stdio.Write([]byte(header)); err != nil {
+	if _, err := io.WriteString(h.stdio, header); err != nil {
 		return 0, err
 	}
 
 	return h.stdio.Write(p)
 }
 
+// Read reads the body of the current frame into p. If the current frame
+// is exhausted, the header of the next frame is consumed first.
 func (h *headerPrefixPipe) Read(p []byte) (int, error) {
-	h.mu.Lock()
-	defer h.mu.Unlock()
+	h.rmu.Lock()
+	defer h.rmu.Unlock()
 
-	reader := bufio.NewReader(h.stdio)
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	if h.reader == nil {
+		h.reader = bufio.NewReader(h.stdio)
+	}
 
-	// read headers
-	headers := ""
-	for {
-		line, err := reader.ReadString('\n')
+	// skip empty frames until there is a body to read
+	for h.remaining == 0 {
+		length, err := h.readHeader()
 		if err != nil {
 			return 0, err
 		}
 
-		headers += line
+		h.contentLength = length
+		h.remaining = length
+	}
 
-		// Detect the end of headers with double CRLF
-		if strings.HasSuffix(headers, "\r\n\r\n") {
-			break
+	if int64(len(p)) > h.remaining {
+		p = p[:h.remaining]
+	}
+
+	// the remainder of the frame is guaranteed to follow, so we can
+	// block until p is filled. this surfaces truncated frames early.
+	n, err := io.ReadFull(h.reader, p)
+	h.remaining -= int64(n)
+
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return n, &TruncatedFrameError{
+			ContentLength: h.contentLength,
+			Received:      h.contentLength - h.remaining,
 		}
 	}
-	headers = strings.TrimSpace(headers)
-
-	// get content-length value
-	var contentLength int
-	lines := strings.Split(headers, "\r\n")
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-
-		if strings.HasPrefix(line, "Content-Length:") {
-			parts := strings.SplitN(line, ":", 2)
-			if len(parts) != 2 {
-				return 0, fmt.Errorf("malformed Content-Length header")
-			}
 
-			lengthStr := strings.TrimSpace(parts[1])
+	return n, err
+}
 
-			if lengthValue, err := strconv.Atoi(lengthStr); err != nil {
-				return 0, fmt.Errorf("invalid Content-Length value: %s", lengthStr)
-			} else {
-				contentLength = lengthValue
+// readHeader reads the header section of the next frame and returns
+// the announced content length. Unknown header fields are ignored.
+func (h *headerPrefixPipe) readHeader() (int64, error) {
+	contentLength := int64(-1)
+
+	for first := true; ; first = false {
+		line, err := h.reader.ReadString('\n')
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				// a clean EOF between frames ends the stream
+				if first && line == "" {
+					return 0, io.EOF
+				}
+				return 0, &TruncatedFrameError{Header: true}
 			}
+			return 0, err
+		}
+
+		line = strings.TrimRight(line, "\r\n")
 
-			// found the content-length
+		// an empty line terminates the header section
+		if line == "" {
 			break
+		}
 
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return 0, fmt.Errorf("%w: %q", ErrMalformedHeader, line)
+		}
+
+		if !strings.EqualFold(strings.TrimSpace(name), "Content-Length") {
+			continue
+		}
+
+		value = strings.TrimSpace(value)
+
+		length, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || length < 0 {
+			return 0, fmt.Errorf("%w: invalid Content-Length value: %s", ErrMalformedHeader, value)
 		}
-	}
 
-	if contentLength == 0 {
-		return 0, fmt.Errorf("Content-Length header not found or zero")
+		contentLength = length
 	}
 
-	if contentLength > len(p) {
-		return 0, fmt.Errorf("buffer too small for content length: %d", contentLength)
+	if contentLength < 0 {
+		return 0, ErrMissingContentLength
 	}
 
-	// read content
-	n, err := io.ReadFull(reader, p[:contentLength])
-	if err == io.ErrUnexpectedEOF {
-		return n, fmt.Errorf("unexpected EOF, expected %d bytes, got %d bytes", contentLength, n)
+	if maxSize := h.maxMessageSize(); contentLength > maxSize {
+		// discard the body, so the next read starts at a frame boundary
+		// instead of parsing the oversized body as a header section.
+		n, err := io.CopyN(io.Discard, h.reader, contentLength)
+		if errors.Is(err, io.EOF) {
+			return 0, &TruncatedFrameError{ContentLength: contentLength, Received: n}
+		} else if err != nil {
+			return 0, err
+		}
+
+		return 0, fmt.Errorf("%w: %d > %d bytes", ErrFrameTooLarge, contentLength, maxSize)
 	}
-	if err != nil {
-		return n, err
+
+	return contentLength, nil
+}
+
+func (h *headerPrefixPipe) maxMessageSize() int64 {
+	if h.maxSize > 0 {
+		return h.maxSize
 	}
 
-	return n, nil
+	return defaultMaxMessageSize
 }
 
 // Close closes the wrapped ReadWriteCloser
-func (p *headerPrefixPipe) Close() error {
-	return p.stdio.Close()
+func (h *headerPrefixPipe) Close() error {
+	return h.stdio.Close()
 }
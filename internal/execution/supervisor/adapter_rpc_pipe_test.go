@@ -1,6 +1,8 @@
 package supervisor
 
 import (
+	"bytes"
+	"io"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -51,3 +53,134 @@ func TestHeaderPrefixReadWriteCloser_Close(t *testing.T) {
 	err := rwc.Close()
 	assert.NoError(t, err)
 }
+
+func TestHeaderPrefixReadWriteCloser_ReadLargeMessageInChunks(t *testing.T) {
+	buf := newRwc()
+	rwc := newHeaderPrefixPipe(buf, 0)
+
+	data := bytes.Repeat([]byte("0123456789"), 1024)
+
+	_, err := rwc.Write(data)
+	require.NoError(t, err)
+
+	// read the message with a buffer smaller than the message
+	res, err := io.ReadAll(io.LimitReader(rwc, int64(len(data))))
+	require.NoError(t, err)
+	assert.Equal(t, data, res)
+}
+
+func TestHeaderPrefixReadWriteCloser_ReadConsecutiveFrames(t *testing.T) {
+	buf := newRwc()
+	rwc := newHeaderPrefixPipe(buf, 0)
+
+	// write both frames before reading, so they are buffered together
+	_, err := rwc.Write([]byte(`{"id":1}`))
+	require.NoError(t, err)
+	_, err = rwc.Write([]byte(`{"id":2}`))
+	require.NoError(t, err)
+
+	res, err := io.ReadAll(rwc)
+	require.NoError(t, err)
+	assert.Equal(t, `{"id":1}{"id":2}`, string(res))
+}
+
+func TestHeaderPrefixReadWriteCloser_ReadIgnoresExtraHeaders(t *testing.T) {
+	buf := newRwc()
+	rwc := newHeaderPrefixPipe(buf, 0)
+
+	buf.Write([]byte("Content-Type: application/vscode-jsonrpc; charset=utf-8\r\n" +
+		"content-length: 4\r\n\r\nTest"))
+
+	readBuffer := make([]byte, 4)
+	n, err := rwc.Read(readBuffer)
+	require.NoError(t, err)
+	assert.Equal(t, "Test", string(readBuffer[:n]))
+}
+
+func TestHeaderPrefixReadWriteCloser_ReadMissingContentLength(t *testing.T) {
+	buf := newRwc()
+	rwc := newHeaderPrefixPipe(buf, 0)
+
+	buf.Write([]byte("Content-Type: application/json\r\n\r\nTest"))
+
+	_, err := rwc.Read(make([]byte, 4))
+	assert.ErrorIs(t, err, ErrMissingContentLength)
+}
+
+func TestHeaderPrefixReadWriteCloser_ReadMalformedHeader(t *testing.T) {
+	buf := newRwc()
+	rwc := newHeaderPrefixPipe(buf, 0)
+
+	buf.Write([]byte("Content-Length: abc\r\n\r\nTest"))
+
+	_, err := rwc.Read(make([]byte, 4))
+	assert.ErrorIs(t, err, ErrMalformedHeader)
+}
+
+func TestHeaderPrefixReadWriteCloser_ReadFrameTooLarge(t *testing.T) {
+	buf := newRwc()
+	rwc := newHeaderPrefixPipe(buf, 3)
+
+	_, err := rwc.Write([]byte("Test"))
+	require.NoError(t, err)
+
+	_, err = rwc.Read(make([]byte, 4))
+	assert.ErrorIs(t, err, ErrFrameTooLarge)
+}
+
+func TestHeaderPrefixReadWriteCloser_ReadAfterFrameTooLarge(t *testing.T) {
+	buf := newRwc()
+	rwc := newHeaderPrefixPipe(buf, 4)
+
+	_, err := rwc.Write([]byte("TooLarge"))
+	require.NoError(t, err)
+	_, err = rwc.Write([]byte("Next"))
+	require.NoError(t, err)
+
+	_, err = rwc.Read(make([]byte, 8))
+	require.ErrorIs(t, err, ErrFrameTooLarge)
+
+	// the oversized body is discarded, so the stream stays in sync
+	readBuffer := make([]byte, 4)
+	n, err := rwc.Read(readBuffer)
+	require.NoError(t, err)
+	assert.Equal(t, "Next", string(readBuffer[:n]))
+}
+
+func TestHeaderPrefixReadWriteCloser_ReadTruncatedBody(t *testing.T) {
+	buf := newRwc()
+	rwc := newHeaderPrefixPipe(buf, 0)
+
+	buf.Write([]byte("Content-Length: 8\r\n\r\nTest"))
+
+	n, err := rwc.Read(make([]byte, 8))
+	assert.Equal(t, 4, n)
+
+	var truncated *TruncatedFrameError
+	require.ErrorAs(t, err, &truncated)
+	assert.False(t, truncated.Header)
+	assert.Equal(t, int64(8), truncated.ContentLength)
+	assert.Equal(t, int64(4), truncated.Received)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+func TestHeaderPrefixReadWriteCloser_ReadTruncatedHeader(t *testing.T) {
+	buf := newRwc()
+	rwc := newHeaderPrefixPipe(buf, 0)
+
+	buf.Write([]byte("Content-Length: 8\r\n"))
+
+	_, err := rwc.Read(make([]byte, 8))
+
+	var truncated *TruncatedFrameError
+	require.ErrorAs(t, err, &truncated)
+	assert.True(t, truncated.Header)
+}
+
+func TestHeaderPrefixReadWriteCloser_ReadEOFBetweenFrames(t *testing.T) {
+	buf := newRwc()
+	rwc := newHeaderPrefixPipe(buf, 0)
+
+	_, err := rwc.Read(make([]byte, 8))
+	assert.ErrorIs(t, err, io.EOF)
+}
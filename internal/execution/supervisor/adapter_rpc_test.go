@@ -3,11 +3,17 @@ package supervisor
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"io"
+	"net"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/vmihailenco/msgpack/v5"
 	"go.uber.org/zap"
 
 	"github.com/lambda-feedback/shimmy/internal/execution/worker"
@@ -142,6 +148,235 @@ func TestStdioAdapter_Stop_WaitForError(t *testing.T) {
 	assert.ErrorIs(t, err, assert.AnError)
 }
 
+func TestStdioAdapter_Start_Initialize(t *testing.T) {
+	a, w := createRpcAdapter(t)
+	a.config.Initialize = true
+
+	client, server := net.Pipe()
+	defer client.Close()
+
+	serveFakeWorker(server, func(msg fakeMessage, reply func(fakeMessage)) {
+		assert.Equal(t, "initialize", msg.Method)
+		reply(fakeMessage{ID: msg.ID, Result: map[string]any{
+			"name":             "test",
+			"version":          "1.0.0",
+			"protocol_version": "1",
+			"commands":         []string{"eval"},
+		}})
+	})
+
+	w.EXPECT().DuplexPipe().Return(client, nil)
+	w.EXPECT().Start(mock.Anything).Return(nil)
+
+	err := a.Start(context.Background(), worker.StartConfig{})
+	require.NoError(t, err)
+
+	assert.Equal(t, &Capabilities{
+		Name:            "test",
+		Version:         "1.0.0",
+		ProtocolVersion: "1",
+		Commands:        []string{"eval"},
+	}, a.Capabilities())
+}
+
+func TestStdioAdapter_Start_Initialize_NotSupported(t *testing.T) {
+	a, w := createRpcAdapter(t)
+	a.config.Initialize = true
+
+	client, server := net.Pipe()
+	defer client.Close()
+
+	serveFakeWorker(server, func(msg fakeMessage, reply func(fakeMessage)) {
+		reply(fakeMessage{ID: msg.ID, Error: map[string]any{
+			"code":    -32601,
+			"message": "method not found",
+		}})
+	})
+
+	w.EXPECT().DuplexPipe().Return(client, nil)
+	w.EXPECT().Start(mock.Anything).Return(nil)
+
+	err := a.Start(context.Background(), worker.StartConfig{})
+	require.NoError(t, err)
+
+	assert.Nil(t, a.Capabilities())
+}
+
+func TestStdioAdapter_Start_Initialize_Fails(t *testing.T) {
+	a, w := createRpcAdapter(t)
+	a.config.Initialize = true
+
+	client, server := net.Pipe()
+	defer client.Close()
+
+	serveFakeWorker(server, func(msg fakeMessage, reply func(fakeMessage)) {
+		reply(fakeMessage{ID: msg.ID, Error: map[string]any{
+			"code":    -32000,
+			"message": "boom",
+		}})
+	})
+
+	w.EXPECT().DuplexPipe().Return(client, nil)
+	w.EXPECT().Start(mock.Anything).Return(nil)
+
+	err := a.Start(context.Background(), worker.StartConfig{})
+	assert.Error(t, err)
+}
+
+func TestStdioAdapter_Send_ForwardsProgress(t *testing.T) {
+	a, w := createRpcAdapter(t)
+	a.config.Notifications = true
+
+	client, server := net.Pipe()
+	defer client.Close()
+
+	serveFakeWorker(server, func(msg fakeMessage, reply func(fakeMessage)) {
+		var params []map[string]any
+		require.NoError(t, json.Unmarshal(msg.Params, &params))
+
+		id := params[0]["$id"]
+
+		reply(fakeMessage{Method: "eval_progress", Params: mustMarshal(t, []any{
+			map[string]any{"id": id, "message": "working"},
+		})})
+		reply(fakeMessage{ID: msg.ID, Result: map[string]any{"is_correct": true}})
+	})
+
+	w.EXPECT().DuplexPipe().Return(client, nil)
+	w.EXPECT().Start(mock.Anything).Return(nil)
+
+	err := a.Start(context.Background(), worker.StartConfig{})
+	require.NoError(t, err)
+
+	progress := make(chan Progress, 1)
+	ctx := ContextWithProgressListener(context.Background(), func(p Progress) {
+		progress <- p
+	})
+
+	data := map[string]any{"response": 1}
+
+	res, err := a.Send(ctx, "eval", data, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"is_correct": true}, res["result"])
+
+	// the caller's data must not be modified
+	assert.NotContains(t, data, "$id")
+
+	select {
+	case p := <-progress:
+		assert.Equal(t, "working", p.Message)
+	case <-time.After(time.Second):
+		t.Fatal("no progress received")
+	}
+}
+
+func TestStdioAdapter_Send_MsgPack(t *testing.T) {
+	a, w := createRpcAdapter(t)
+	a.encoding = MsgPackEncoding
+
+	client, server := net.Pipe()
+	defer client.Close()
+
+	var sp worker.StartConfig
+	a.workerFactory = func(params worker.StartConfig) (worker.Worker, error) {
+		sp = params
+		return w, nil
+	}
+
+	go func() {
+		pipe := newHeaderPrefixPipe(server, 0)
+		dec := msgpack.NewDecoder(pipe)
+		for {
+			var msg map[string]any
+			if err := dec.Decode(&msg); err != nil {
+				return
+			}
+
+			params := msg["params"].([]any)[0].(map[string]any)
+
+			res, _ := msgpack.Marshal(map[string]any{
+				"jsonrpc": "2.0",
+				"id":      msg["id"],
+				"result":  map[string]any{"response": params["response"], "bytes": []byte("hi")},
+			})
+			_, _ = pipe.Write(res)
+		}
+	}()
+
+	w.EXPECT().DuplexPipe().Return(client, nil)
+	w.EXPECT().Start(mock.Anything).Return(nil)
+
+	err := a.Start(context.Background(), worker.StartConfig{})
+	require.NoError(t, err)
+
+	assert.Contains(t, sp.Env, "EVAL_ENCODING=msgpack")
+
+	res, err := a.Send(context.Background(), "eval", map[string]any{"response": 1}, time.Second)
+	require.NoError(t, err)
+
+	// the result is converted back to the json model
+	assert.Equal(t, map[string]any{
+		"response": float64(1),
+		"bytes":    "aGk=",
+	}, res["result"])
+}
+
+func TestHttpAdapter_Start_BinaryEncodingNotSupported(t *testing.T) {
+	a, w := createRpcAdapter(t)
+	a.encoding = CBOREncoding
+	a.config.Transport = HttpTransport
+
+	err := a.Start(context.Background(), worker.StartConfig{})
+	assert.ErrorIs(t, err, ErrUnsupportedEncoding)
+
+	w.AssertNotCalled(t, "Start")
+}
+
+// MARK: - fake worker
+
+type fakeMessage struct {
+	Version string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  any             `json:"result,omitempty"`
+	Error   any             `json:"error,omitempty"`
+}
+
+// serveFakeWorker reads framed json-rpc messages from conn, and passes
+// them to handle, which may reply with any number of messages.
+func serveFakeWorker(conn io.ReadWriteCloser, handle func(fakeMessage, func(fakeMessage))) {
+	pipe := newHeaderPrefixPipe(conn, 0)
+
+	var mu sync.Mutex
+	enc := json.NewEncoder(pipe)
+
+	reply := func(msg fakeMessage) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		msg.Version = "2.0"
+		_ = enc.Encode(msg)
+	}
+
+	go func() {
+		dec := json.NewDecoder(pipe)
+		for {
+			var msg fakeMessage
+			if err := dec.Decode(&msg); err != nil {
+				return
+			}
+			go handle(msg, reply)
+		}
+	}()
+}
+
+func mustMarshal(t *testing.T, v any) json.RawMessage {
+	data, err := json.Marshal(v)
+	require.NoError(t, err)
+	return data
+}
+
 // func TestStdioAdapter_Send(t *testing.T) {
 // 	a, w := createStdioAdapter(t)
 
@@ -0,0 +1,44 @@
+package supervisor
+
+import (
+	"context"
+	"maps"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/lambda-feedback/shimmy/internal/tracing"
+)
+
+// traceContextKeyPrefix is prepended to the fields of the W3C trace
+// context that are injected into the message data, e.g. `$traceparent`.
+const traceContextKeyPrefix = "$"
+
+// startSendSpan starts the span covering the round-trip of a message
+// sent to the worker.
+func startSendSpan(ctx context.Context, method string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracing.Start(ctx, "shimmy.worker.send",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("rpc.method", method)),
+		trace.WithAttributes(attrs...),
+	)
+}
+
+// withTraceContext tags the message with the W3C trace context of ctx,
+// without modifying the caller's data, so the worker is able to continue
+// the trace. The data is returned as is if ctx carries no trace context.
+func withTraceContext(ctx context.Context, data map[string]any) map[string]any {
+	metadata := tracing.Metadata(ctx)
+	if len(metadata) == 0 {
+		return data
+	}
+
+	tagged := make(map[string]any, len(data)+len(metadata))
+	maps.Copy(tagged, data)
+
+	for k, v := range metadata {
+		tagged[traceContextKeyPrefix+k] = v
+	}
+
+	return tagged
+}
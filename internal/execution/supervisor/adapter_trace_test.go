@@ -0,0 +1,46 @@
+package supervisor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func testSpanContext(t *testing.T) trace.SpanContext {
+	traceID, err := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	require.NoError(t, err)
+
+	spanID, err := trace.SpanIDFromHex("00f067aa0ba902b7")
+	require.NoError(t, err)
+
+	return trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+		Remote:     true,
+	})
+}
+
+func TestWithTraceContext_TagsMessage(t *testing.T) {
+	ctx := trace.ContextWithRemoteSpanContext(context.Background(), testSpanContext(t))
+
+	data := map[string]any{"response": "x"}
+	tagged := withTraceContext(ctx, data)
+
+	assert.Equal(t, map[string]any{
+		"response":     "x",
+		"$traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	}, tagged)
+
+	// the data of the caller is not modified
+	assert.Equal(t, map[string]any{"response": "x"}, data)
+}
+
+func TestWithTraceContext_NoTrace(t *testing.T) {
+	data := map[string]any{"response": "x"}
+
+	assert.Equal(t, data, withTraceContext(context.Background(), data))
+}
@@ -38,8 +38,20 @@ type IOConfig struct {
 	// Default is "rpc".
 	Interface IOInterface `conf:"interface"`
 
+	// Encoding is the encoding of messages exchanged with the worker.
+	// It can be either "json", "msgpack" or "cbor". Binary encodings
+	// are supported by the file interface, and by the stdio, ipc and
+	// tcp transports of the rpc interface. The encoding is passed to
+	// the worker in the `EVAL_ENCODING` environment variable.
+	//
+	// Default is "json".
+	Encoding MessageEncoding `conf:"encoding"`
+
 	// Rpc is the configuration for the rpc interface.
 	Rpc RpcConfig `conf:"rpc"`
+
+	// File is the configuration for the file interface.
+	File FileConfig `conf:"file"`
 }
 
 type Config struct {
@@ -57,4 +69,30 @@ type Config struct {
 	// SendParams are the parameters to pass to the worker when
 	// sending a message.
 	SendParams SendConfig `conf:"send"`
+
+	// MaxConcurrency is the maximum number of messages that can be
+	// in flight to a single persistent worker at the same time. The
+	// messages are multiplexed over the same connection, and matched
+	// to their responses using the rpc request id. Transient workers
+	// always handle a single message at a time. In attach mode, the
+	// limit applies to each endpoint. Default is 1.
+	MaxConcurrency int `conf:"max_concurrency"`
+}
+
+// Concurrency returns the number of messages that a supervisor sends
+// to its worker at the same time. In attach mode, up to MaxConcurrency
+// messages are sent to each endpoint, so all endpoints are used.
+func (c Config) Concurrency() int {
+	// transient workers are booted for a single message
+	if c.IO.Interface != RpcIO {
+		return 1
+	}
+
+	concurrency := max(c.MaxConcurrency, 1)
+
+	if endpoints := len(c.IO.Rpc.Attach.Endpoints); endpoints > 0 {
+		concurrency *= endpoints
+	}
+
+	return concurrency
 }
@@ -0,0 +1,280 @@
+package supervisor
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+type valueEncoder interface {
+	Encode(v any) error
+}
+
+type valueDecoder interface {
+	Decode(v any) error
+}
+
+// messageCodec creates encoders and decoders for a message encoding.
+type messageCodec struct {
+	encoding   MessageEncoding
+	newEncoder func(io.Writer) valueEncoder
+	newDecoder func(io.Reader) valueDecoder
+}
+
+// binary returns true if the codec does not use json.
+func (c messageCodec) binary() bool {
+	return c.encoding != JSONEncoding
+}
+
+// encode encodes a message using the codec. For binary encodings, the
+// message is converted to a binary-friendly model before encoding.
+func (c messageCodec) encode(w io.Writer, v any) error {
+	if c.binary() {
+		v = toBinaryModel(v)
+	}
+
+	return c.newEncoder(w).Encode(v)
+}
+
+// getMessageCodec returns the codec for the given encoding. If the
+// encoding is empty, json is used.
+func getMessageCodec(encoding MessageEncoding) (messageCodec, error) {
+	switch encoding {
+	case "", JSONEncoding:
+		return messageCodec{
+			encoding: JSONEncoding,
+			newEncoder: func(w io.Writer) valueEncoder {
+				return json.NewEncoder(w)
+			},
+			newDecoder: func(r io.Reader) valueDecoder {
+				return json.NewDecoder(r)
+			},
+		}, nil
+	case MsgPackEncoding:
+		return messageCodec{
+			encoding: MsgPackEncoding,
+			newEncoder: func(w io.Writer) valueEncoder {
+				enc := msgpack.NewEncoder(w)
+				enc.UseCompactInts(true)
+				return enc
+			},
+			newDecoder: func(r io.Reader) valueDecoder {
+				return msgpack.NewDecoder(r)
+			},
+		}, nil
+	case CBOREncoding:
+		return messageCodec{
+			encoding: CBOREncoding,
+			newEncoder: func(w io.Writer) valueEncoder {
+				return cbor.NewEncoder(w)
+			},
+			newDecoder: func(r io.Reader) valueDecoder {
+				return cbor.NewDecoder(r)
+			},
+		}, nil
+	}
+
+	return messageCodec{}, fmt.Errorf("%w: %s", ErrUnsupportedEncoding, encoding)
+}
+
+// toBinaryModel converts a value decoded from json to a model that is
+// encoded naturally by binary encodings. Numbers decoded as json.Number
+// are converted to integers if they are written as integers, and to
+// floats otherwise. float64 values are kept, so 1.0 is not sent as 1.
+func toBinaryModel(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for k, vv := range v {
+			m[k] = toBinaryModel(vv)
+		}
+		return m
+	case []any:
+		s := make([]any, len(v))
+		for i, vv := range v {
+			s[i] = toBinaryModel(vv)
+		}
+		return s
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		if u, err := strconv.ParseUint(string(v), 10, 64); err == nil {
+			return u
+		}
+		f, _ := v.Float64()
+		return f
+	default:
+		return v
+	}
+}
+
+// toJSONModel converts a value decoded from a binary encoding to the
+// model produced by decoding json with json.Decoder.UseNumber, i.e. maps
+// with string keys, slices, strings, bools and nil. Integers are kept as
+// json.Number, so they don't lose precision, and floats become float64.
+// This ensures messages can be validated independently of the encoding
+// used to exchange them.
+func toJSONModel(v any) (any, error) {
+	switch v := v.(type) {
+	case nil, bool, string, float64, json.Number:
+		return v, nil
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for k, vv := range v {
+			c, err := toJSONModel(vv)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = c
+		}
+		return m, nil
+	case map[any]any:
+		m := make(map[string]any, len(v))
+		for k, vv := range v {
+			key, ok := k.(string)
+			if !ok {
+				return nil, fmt.Errorf("unsupported map key of type %T", k)
+			}
+			c, err := toJSONModel(vv)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = c
+		}
+		return m, nil
+	case []any:
+		s := make([]any, len(v))
+		for i, vv := range v {
+			c, err := toJSONModel(vv)
+			if err != nil {
+				return nil, err
+			}
+			s[i] = c
+		}
+		return s, nil
+	case []byte:
+		// json encodes byte slices as base64 strings
+		return base64.StdEncoding.EncodeToString(v), nil
+	case time.Time:
+		return v.Format(time.RFC3339Nano), nil
+	case float32:
+		return float64(v), nil
+	case int:
+		return intNumber(int64(v)), nil
+	case int8:
+		return intNumber(int64(v)), nil
+	case int16:
+		return intNumber(int64(v)), nil
+	case int32:
+		return intNumber(int64(v)), nil
+	case int64:
+		return intNumber(v), nil
+	case uint:
+		return uintNumber(uint64(v)), nil
+	case uint8:
+		return uintNumber(uint64(v)), nil
+	case uint16:
+		return uintNumber(uint64(v)), nil
+	case uint32:
+		return uintNumber(uint64(v)), nil
+	case uint64:
+		return uintNumber(v), nil
+	}
+
+	return nil, fmt.Errorf("unsupported value of type %T", v)
+}
+
+func intNumber(i int64) json.Number {
+	return json.Number(strconv.FormatInt(i, 10))
+}
+
+func uintNumber(u uint64) json.Number {
+	return json.Number(strconv.FormatUint(u, 10))
+}
+
+// transcodingConn translates the json messages written by the rpc client
+// to a binary encoding, and the binary messages read from the worker back
+// to json. Each call to Write must contain complete json messages.
+type transcodingConn struct {
+	rwc   io.ReadWriteCloser
+	codec messageCodec
+
+	// dec decodes the messages read from the worker.
+	dec valueDecoder
+
+	// rbuf holds the json of the last message read from the worker,
+	// that has not yet been consumed by the rpc client.
+	rbuf bytes.Buffer
+}
+
+func newTranscodingConn(rwc io.ReadWriteCloser, codec messageCodec) *transcodingConn {
+	return &transcodingConn{
+		rwc:   rwc,
+		codec: codec,
+		dec:   codec.newDecoder(rwc),
+	}
+}
+
+func (c *transcodingConn) Read(p []byte) (int, error) {
+	if c.rbuf.Len() == 0 {
+		var v any
+		if err := c.dec.Decode(&v); err != nil {
+			return 0, err
+		}
+
+		v, err := toJSONModel(v)
+		if err != nil {
+			return 0, fmt.Errorf("error converting message: %w", err)
+		}
+
+		c.rbuf.Reset()
+		if err := json.NewEncoder(&c.rbuf).Encode(v); err != nil {
+			return 0, fmt.Errorf("error encoding message: %w", err)
+		}
+	}
+
+	return c.rbuf.Read(p)
+}
+
+func (c *transcodingConn) Write(p []byte) (int, error) {
+	dec := json.NewDecoder(bytes.NewReader(p))
+	dec.UseNumber()
+
+	var buf bytes.Buffer
+
+	for {
+		var v any
+		err := dec.Decode(&v)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return 0, fmt.Errorf("error decoding message: %w", err)
+		}
+
+		if err := c.codec.encode(&buf, v); err != nil {
+			return 0, fmt.Errorf("error encoding message: %w", err)
+		}
+	}
+
+	// write all messages at once, so framed transports
+	// send the messages in a single frame
+	if _, err := c.rwc.Write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+func (c *transcodingConn) Close() error {
+	return c.rwc.Close()
+}
@@ -0,0 +1,123 @@
+package supervisor
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetMessageCodec_DefaultsToJSON(t *testing.T) {
+	codec, err := getMessageCodec("")
+	require.NoError(t, err)
+
+	assert.Equal(t, JSONEncoding, codec.encoding)
+	assert.False(t, codec.binary())
+}
+
+func TestGetMessageCodec_FailsForUnknownEncoding(t *testing.T) {
+	_, err := getMessageCodec("xml")
+	assert.ErrorIs(t, err, ErrUnsupportedEncoding)
+}
+
+func TestToBinaryModel_ConvertsIntegralNumbers(t *testing.T) {
+	v := toBinaryModel(map[string]any{
+		"float":    float64(3),
+		"number":   json.Number("42"),
+		"integral": json.Number("1.0"),
+		"large":    json.Number("18446744073709551615"),
+		"list":     []any{json.Number("-1"), json.Number("2.5")},
+	})
+
+	assert.Equal(t, map[string]any{
+		"float":    float64(3),
+		"number":   int64(42),
+		"integral": float64(1),
+		"large":    uint64(18446744073709551615),
+		"list":     []any{int64(-1), 2.5},
+	}, v)
+}
+
+func TestToJSONModel_ConvertsValues(t *testing.T) {
+	v, err := toJSONModel(map[any]any{
+		"int":   int64(-1),
+		"uint":  uint64(2),
+		"bytes": []byte("hi"),
+		"list":  []any{int8(1), float32(0.5), nil, true},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]any{
+		"int":   json.Number("-1"),
+		"uint":  json.Number("2"),
+		"bytes": "aGk=",
+		"list":  []any{json.Number("1"), float64(0.5), nil, true},
+	}, v)
+}
+
+func TestToJSONModel_KeepsLargeIntegers(t *testing.T) {
+	v, err := toJSONModel(map[string]any{
+		"int":  int64(1<<53 + 1),
+		"uint": uint64(18446744073709551615),
+	})
+	require.NoError(t, err)
+
+	data, err := json.Marshal(v)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"int":9007199254740993,"uint":18446744073709551615}`, string(data))
+}
+
+func TestCodec_RoundTripsFloats(t *testing.T) {
+	for _, encoding := range []MessageEncoding{MsgPackEncoding, CBOREncoding} {
+		codec, err := getMessageCodec(encoding)
+		require.NoError(t, err)
+
+		var buf bytes.Buffer
+		require.NoError(t, codec.encode(&buf, map[string]any{"value": 1.0}))
+
+		var decoded any
+		require.NoError(t, codec.newDecoder(&buf).Decode(&decoded))
+
+		v, err := toJSONModel(decoded)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]any{"value": float64(1)}, v, encoding)
+	}
+}
+
+func TestToJSONModel_FailsForNonStringKeys(t *testing.T) {
+	_, err := toJSONModel(map[any]any{1: "one"})
+	assert.Error(t, err)
+}
+
+func TestTranscodingConn_TranslatesMessages(t *testing.T) {
+	codec, err := getMessageCodec(CBOREncoding)
+	require.NoError(t, err)
+
+	var written bytes.Buffer
+	read, _ := cbor.Marshal(map[string]any{"id": 1, "result": "ok"})
+
+	conn := newTranscodingConn(&rwc{Buffer: &written}, codec)
+
+	// json written by the client is encoded as cbor
+	_, err = conn.Write([]byte(`{"id":1,"method":"eval"}` + "\n"))
+	require.NoError(t, err)
+
+	var msg map[string]any
+	require.NoError(t, cbor.Unmarshal(written.Bytes(), &msg))
+	assert.Equal(t, map[string]any{"id": uint64(1), "method": "eval"}, msg)
+
+	// cbor read from the worker is decoded as json
+	written.Reset()
+	written.Write(read)
+
+	var res map[string]any
+	require.NoError(t, json.NewDecoder(conn).Decode(&res))
+	assert.Equal(t, map[string]any{"id": float64(1), "result": "ok"}, res)
+
+	_, err = conn.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, io.EOF)
+}
@@ -5,6 +5,7 @@ import "errors"
 var (
 	ErrUnsupportedIOInterface = errors.New("unsupported io interface")
 	ErrUnsupportedIOTransport = errors.New("unsupported io transport")
+	ErrUnsupportedEncoding    = errors.New("unsupported message encoding")
 )
 
 // IOInterface describes the interface used to communicate with the worker
@@ -38,3 +39,29 @@ const (
 	// Tcp describes communication w/ processes over tcp
 	TcpTransport IOTransport = "tcp"
 )
+
+// MessageEncoding describes the encoding of messages exchanged with the worker
+type MessageEncoding string
+
+const (
+	// JSONEncoding describes messages encoded as json
+	JSONEncoding MessageEncoding = "json"
+
+	// MsgPackEncoding describes messages encoded as MessagePack
+	MsgPackEncoding MessageEncoding = "msgpack"
+
+	// CBOREncoding describes messages encoded as CBOR
+	CBOREncoding MessageEncoding = "cbor"
+)
+
+// BalancingStrategy describes how messages are distributed across endpoints
+type BalancingStrategy string
+
+const (
+	// RoundRobinBalancing distributes messages across endpoints in turn
+	RoundRobinBalancing BalancingStrategy = "round_robin"
+
+	// LeastInflightBalancing sends messages to the endpoint with the
+	// fewest messages in flight
+	LeastInflightBalancing BalancingStrategy = "least_inflight"
+)
@@ -0,0 +1,89 @@
+package supervisor
+
+import (
+	"maps"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/lambda-feedback/shimmy/internal/execution/worker"
+)
+
+// Counters counts the lifecycle events of workers. A single instance
+// may be shared by multiple supervisors, e.g. all supervisors of a pool.
+type Counters struct {
+	boots        atomic.Int64
+	bootFailures atomic.Int64
+	crashes      atomic.Int64
+	recycles     atomic.Int64
+
+	exitsMu     sync.Mutex
+	exitCodes   map[string]int64
+	exitSignals map[string]int64
+}
+
+// WorkerStats is a snapshot of the worker lifecycle counters.
+type WorkerStats struct {
+	// Boots is the number of workers started successfully.
+	Boots int64 `json:"boots"`
+
+	// BootFailures is the number of workers that failed to start.
+	BootFailures int64 `json:"boot_failures"`
+
+	// Crashes is the number of messages that failed due to the worker
+	// or its connection, rather than an error reported by the worker.
+	Crashes int64 `json:"crashes"`
+
+	// Recycles is the number of transient workers terminated after
+	// handling a message.
+	Recycles int64 `json:"recycles"`
+
+	// ExitCodes counts the worker processes that exited, by exit code.
+	ExitCodes map[string]int64 `json:"exit_codes,omitempty"`
+
+	// ExitSignals counts the worker processes that were terminated by
+	// a signal, by signal number.
+	ExitSignals map[string]int64 `json:"exit_signals,omitempty"`
+}
+
+// observeExit counts the exit of a worker process.
+func (c *Counters) observeExit(evt worker.ExitEvent) {
+	c.exitsMu.Lock()
+	defer c.exitsMu.Unlock()
+
+	if evt.Code != nil {
+		if c.exitCodes == nil {
+			c.exitCodes = make(map[string]int64)
+		}
+
+		c.exitCodes[strconv.Itoa(*evt.Code)]++
+	}
+
+	if evt.Signal != nil {
+		if c.exitSignals == nil {
+			c.exitSignals = make(map[string]int64)
+		}
+
+		c.exitSignals[strconv.Itoa(*evt.Signal)]++
+	}
+}
+
+// Snapshot returns the current value of the counters.
+func (c *Counters) Snapshot() WorkerStats {
+	return WorkerStats{
+		Boots:        c.boots.Load(),
+		BootFailures: c.bootFailures.Load(),
+		Crashes:      c.crashes.Load(),
+		Recycles:     c.recycles.Load(),
+		ExitCodes:    c.exits(c.exitCodes),
+		ExitSignals:  c.exits(c.exitSignals),
+	}
+}
+
+// exits returns a copy of the exit counts.
+func (c *Counters) exits(counts map[string]int64) map[string]int64 {
+	c.exitsMu.Lock()
+	defer c.exitsMu.Unlock()
+
+	return maps.Clone(counts)
+}
@@ -6,9 +6,13 @@ import (
 	"sync"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 
 	"github.com/lambda-feedback/shimmy/internal/execution/worker"
+	"github.com/lambda-feedback/shimmy/internal/tracing"
+	"github.com/lambda-feedback/shimmy/util"
 )
 
 type Supervisor interface {
@@ -31,17 +35,74 @@ type Supervisor interface {
 	// Shutdown shuts down the worker. Both persistent and transient
 	// workers will be terminated.
 	Shutdown(ctx context.Context) (WaitFunc, error)
+
+	// Capabilities returns the capabilities reported by the worker, or
+	// nil if there is no running worker or it did not report any.
+	Capabilities() *Capabilities
+
+	// MemoryUsage returns the resident memory of the worker processes
+	// in bytes, or 0 if there is no running worker or it is unknown.
+	MemoryUsage() uint64
 }
 
 type workerRef struct {
 	cancel context.CancelFunc
 	worker Adapter
+
+	// processes are the worker processes started by the adapter
+	processes   []processWorker
+	processesMu sync.Mutex
+}
+
+// processWorker is a worker backed by a local process.
+type processWorker interface {
+	Pid() int
+}
+
+// exitNotifier is a worker reporting the exit of its process.
+type exitNotifier interface {
+	OnExit(func(worker.ExitEvent))
+}
+
+// track keeps a reference to the worker, if it is backed by a process.
+func (r *workerRef) track(w worker.Worker) {
+	p, ok := w.(processWorker)
+	if !ok {
+		return
+	}
+
+	r.processesMu.Lock()
+	defer r.processesMu.Unlock()
+
+	r.processes = append(r.processes, p)
+}
+
+// memoryUsage returns the resident memory of the worker processes.
+// Processes that already exited are skipped.
+func (r *workerRef) memoryUsage() uint64 {
+	r.processesMu.Lock()
+	defer r.processesMu.Unlock()
+
+	var total uint64
+	for _, p := range r.processes {
+		if rss, err := util.ProcessRSS(p.Pid()); err == nil {
+			total += rss
+		}
+	}
+
+	return total
 }
 
 type WorkerSupervisor struct {
 	persistent bool
 
-	sendLock sync.Mutex
+	// ctx is the context of the supervisor, which persistent workers
+	// are started in
+	ctx context.Context
+
+	// sendSlots limits the number of concurrent sends to the worker.
+	// Each in-flight message occupies one slot in the channel.
+	sendSlots chan struct{}
 
 	createWorker func() (*workerRef, error)
 
@@ -52,6 +113,9 @@ type WorkerSupervisor struct {
 	stopParams  StopConfig
 	sendParams  SendConfig
 
+	// counters counts the lifecycle events of the workers
+	counters *Counters
+
 	log *zap.Logger
 }
 
@@ -74,6 +138,10 @@ type Params struct {
 	// is called when the supervisor needs to create a new worker.
 	WorkerFactory WorkerFactoryFn
 
+	// Counters counts the lifecycle events of the workers. Counters
+	// may be shared by multiple supervisors. Default is unshared.
+	Counters *Counters
+
 	// Log is the logger to use for the supervisor
 	Log *zap.Logger
 }
@@ -94,11 +162,28 @@ func New(params Params) (Supervisor, error) {
 		params.AdapterFactory = defaultAdapterFactory
 	}
 
+	if params.Counters == nil {
+		params.Counters = &Counters{}
+	}
+
 	createAdapter := func() (*workerRef, error) {
 		workerCtx, cancel := context.WithCancel(params.Context)
 
+		ref := &workerRef{cancel: cancel}
+
 		workerFactory := func(config worker.StartConfig) (worker.Worker, error) {
-			return params.WorkerFactory(workerCtx, config, params.Log)
+			w, err := params.WorkerFactory(workerCtx, config, params.Log)
+			if err != nil {
+				return nil, err
+			}
+
+			ref.track(w)
+
+			if n, ok := w.(exitNotifier); ok {
+				n.OnExit(params.Counters.observeExit)
+			}
+
+			return w, nil
 		}
 
 		adapter, err := params.AdapterFactory(
@@ -111,21 +196,23 @@ func New(params Params) (Supervisor, error) {
 			return nil, fmt.Errorf("failed to create adapter: %w", err)
 		}
 
-		return &workerRef{
-			worker: adapter,
-			cancel: cancel,
-		}, nil
+		ref.worker = adapter
+
+		return ref, nil
 	}
 
 	// the worker is persistent if the IO interface is RPC
 	persistent := config.IO.Interface == RpcIO
 
 	return &WorkerSupervisor{
+		ctx:          params.Context,
 		createWorker: createAdapter,
 		persistent:   persistent,
+		sendSlots:    make(chan struct{}, config.Concurrency()),
 		startParams:  config.StartParams,
 		stopParams:   config.StopParams,
 		sendParams:   config.SendParams,
+		counters:     params.Counters,
 		log:          params.Log.Named("supervisor"),
 	}, nil
 }
@@ -149,11 +236,16 @@ func (s *WorkerSupervisor) Send(
 	method string,
 	data map[string]any,
 ) (*Result, error) {
-	// acquire send lock. should not be necessary as supervisors
-	// are managed by a resource pool, but it does no harm to make
-	// the supervisor thread-safe and serialize access.
-	s.sendLock.Lock()
-	defer s.sendLock.Unlock()
+	// acquire a send slot. persistent workers may handle multiple
+	// messages concurrently, up to the configured max concurrency.
+	// otherwise, access to the worker is serialized. waiting for a
+	// slot is aborted if the context is done.
+	select {
+	case s.sendSlots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, fmt.Errorf("failed to acquire send slot: %w", ctx.Err())
+	}
+	defer func() { <-s.sendSlots }()
 
 	worker, err := s.acquireWorker(ctx)
 	if err != nil {
@@ -163,6 +255,9 @@ func (s *WorkerSupervisor) Send(
 	// NOTICE: unconventional error handling ahead, as we need
 	//         to release the worker before returning the error.
 	resData, err := worker.Send(ctx, method, data, s.sendParams.Timeout)
+	if err != nil && !IsWorkerError(err) && ctx.Err() == nil {
+		s.counters.crashes.Add(1)
+	}
 
 	release, releaseErr := s.releaseWorker()
 	if releaseErr != nil {
@@ -190,7 +285,7 @@ func (s *WorkerSupervisor) Suspend(ctx context.Context) (WaitFunc, error) {
 }
 
 func (s *WorkerSupervisor) Shutdown(ctx context.Context) (WaitFunc, error) {
-	release, err := s.terminateWorker()
+	release, err := s.terminateWorker(false)
 	if err != nil {
 		return nil, err
 	}
@@ -200,6 +295,28 @@ func (s *WorkerSupervisor) Shutdown(ctx context.Context) (WaitFunc, error) {
 	}, nil
 }
 
+func (s *WorkerSupervisor) Capabilities() *Capabilities {
+	s.workerLock.Lock()
+	defer s.workerLock.Unlock()
+
+	if s.workerRef == nil {
+		return nil
+	}
+
+	return s.workerRef.worker.Capabilities()
+}
+
+func (s *WorkerSupervisor) MemoryUsage() uint64 {
+	s.workerLock.Lock()
+	defer s.workerLock.Unlock()
+
+	if s.workerRef == nil {
+		return 0
+	}
+
+	return s.workerRef.memoryUsage()
+}
+
 func (s *WorkerSupervisor) acquireWorker(ctx context.Context) (Adapter, error) {
 	s.workerLock.Lock()
 	defer s.workerLock.Unlock()
@@ -229,10 +346,12 @@ func (s *WorkerSupervisor) releaseWorker() (ReleaseFunc, error) {
 
 	s.log.Debug("transient: releasing worker")
 
-	return s.terminateWorker()
+	return s.terminateWorker(true)
 }
 
-func (s *WorkerSupervisor) terminateWorker() (ReleaseFunc, error) {
+// terminateWorker stops the worker, if any. If recycle is set, the
+// worker is counted as recycled after handling a message.
+func (s *WorkerSupervisor) terminateWorker(recycle bool) (ReleaseFunc, error) {
 	s.workerLock.Lock()
 	defer s.workerLock.Unlock()
 
@@ -255,6 +374,10 @@ func (s *WorkerSupervisor) terminateWorker() (ReleaseFunc, error) {
 		return nil, err
 	}
 
+	if recycle {
+		s.counters.recycles.Add(1)
+	}
+
 	// keep a reference to the worker context cancel function
 	cancel := s.workerRef.cancel
 
@@ -285,19 +408,49 @@ func (s *WorkerSupervisor) terminateWorker() (ReleaseFunc, error) {
 	}, nil
 }
 
-func (s *WorkerSupervisor) bootWorker(ctx context.Context) (*workerRef, error) {
+func (s *WorkerSupervisor) bootWorker(ctx context.Context) (_ *workerRef, err error) {
+	// persistent workers outlive the message they are started for, so
+	// they do not keep its values, e.g. its trace, tenant or progress
+	if s.persistent {
+		var cancel context.CancelFunc
+		ctx, cancel = detachContext(s.ctx, ctx)
+		defer cancel()
+	}
+
+	// the worker is started in the span, so it is able to continue the trace
+	ctx, span := tracing.Start(ctx, "shimmy.worker.boot",
+		trace.WithAttributes(attribute.Bool("shimmy.worker.persistent", s.persistent)),
+	)
+	defer func() { tracing.End(span, err) }()
+
 	ref, err := s.createWorker()
 	if err != nil {
+		s.counters.bootFailures.Add(1)
 		return nil, fmt.Errorf("failed to create worker: %w", err)
 	}
 
 	if err = ref.worker.Start(ctx, s.startParams); err != nil {
+		s.counters.bootFailures.Add(1)
 		return nil, fmt.Errorf("failed to start worker: %w", err)
 	}
 
+	s.counters.boots.Add(1)
+
 	return ref, nil
 }
 
+// detachContext returns a context with the values of base, which is
+// canceled once ctx is canceled.
+func detachContext(base, ctx context.Context) (context.Context, context.CancelFunc) {
+	detached, cancel := context.WithCancel(base)
+	stop := context.AfterFunc(ctx, cancel)
+
+	return detached, func() {
+		stop()
+		cancel()
+	}
+}
+
 func defaultWorkerFactory(
 	ctx context.Context,
 	config worker.StartConfig,
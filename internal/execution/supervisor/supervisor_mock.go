@@ -21,6 +21,98 @@ func (_m *MockSupervisor) EXPECT() *MockSupervisor_Expecter {
 	return &MockSupervisor_Expecter{mock: &_m.Mock}
 }
 
+// Capabilities provides a mock function with no fields
+func (_m *MockSupervisor) Capabilities() *Capabilities {
+	ret := _m.Called()
+
+	if len(ret) == 0 {
+		panic("no return value specified for Capabilities")
+	}
+
+	var r0 *Capabilities
+	if rf, ok := ret.Get(0).(func() *Capabilities); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*Capabilities)
+		}
+	}
+
+	return r0
+}
+
+// MockSupervisor_Capabilities_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Capabilities'
+type MockSupervisor_Capabilities_Call struct {
+	*mock.Call
+}
+
+// Capabilities is a helper method to define mock.On call
+func (_e *MockSupervisor_Expecter) Capabilities() *MockSupervisor_Capabilities_Call {
+	return &MockSupervisor_Capabilities_Call{Call: _e.mock.On("Capabilities")}
+}
+
+func (_c *MockSupervisor_Capabilities_Call) Run(run func()) *MockSupervisor_Capabilities_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run()
+	})
+	return _c
+}
+
+func (_c *MockSupervisor_Capabilities_Call) Return(_a0 *Capabilities) *MockSupervisor_Capabilities_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *MockSupervisor_Capabilities_Call) RunAndReturn(run func() *Capabilities) *MockSupervisor_Capabilities_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// MemoryUsage provides a mock function with no fields
+func (_m *MockSupervisor) MemoryUsage() uint64 {
+	ret := _m.Called()
+
+	if len(ret) == 0 {
+		panic("no return value specified for MemoryUsage")
+	}
+
+	var r0 uint64
+	if rf, ok := ret.Get(0).(func() uint64); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(uint64)
+	}
+
+	return r0
+}
+
+// MockSupervisor_MemoryUsage_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'MemoryUsage'
+type MockSupervisor_MemoryUsage_Call struct {
+	*mock.Call
+}
+
+// MemoryUsage is a helper method to define mock.On call
+func (_e *MockSupervisor_Expecter) MemoryUsage() *MockSupervisor_MemoryUsage_Call {
+	return &MockSupervisor_MemoryUsage_Call{Call: _e.mock.On("MemoryUsage")}
+}
+
+func (_c *MockSupervisor_MemoryUsage_Call) Run(run func()) *MockSupervisor_MemoryUsage_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run()
+	})
+	return _c
+}
+
+func (_c *MockSupervisor_MemoryUsage_Call) Return(_a0 uint64) *MockSupervisor_MemoryUsage_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *MockSupervisor_MemoryUsage_Call) RunAndReturn(run func() uint64) *MockSupervisor_MemoryUsage_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // Send provides a mock function with given fields: ctx, method, data
 func (_m *MockSupervisor) Send(ctx context.Context, method string, data map[string]interface{}) (*Result, error) {
 	ret := _m.Called(ctx, method, data)
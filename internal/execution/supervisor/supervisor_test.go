@@ -2,13 +2,17 @@ package supervisor_test
 
 import (
 	"context"
+	"errors"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"go.uber.org/zap"
 
 	"github.com/lambda-feedback/shimmy/internal/execution/supervisor"
+	"github.com/lambda-feedback/shimmy/internal/execution/worker"
 )
 
 func TestSupervisor_New_DefaultWorkerFactory(t *testing.T) {
@@ -85,6 +89,26 @@ func TestSupervisor_Start_Persistent_StartsWorker(t *testing.T) {
 	a.AssertCalled(t, "Start", mock.Anything, mock.Anything)
 }
 
+func TestSupervisor_Send_Persistent_StartsWorkerWithoutMessageValues(t *testing.T) {
+	type key struct{}
+
+	s, a, err := createSupervisor(t, supervisor.RpcIO)
+	assert.NoError(t, err)
+
+	data := map[string]any{"data": "data"}
+
+	a.EXPECT().Start(mock.Anything, mock.Anything).Run(func(ctx context.Context, _ worker.StartConfig) {
+		assert.Nil(t, ctx.Value(key{}))
+	}).Return(nil)
+	a.EXPECT().Send(mock.Anything, "test", data, mock.Anything).Return(data, nil)
+
+	// the message booting the worker does not pass on its values
+	ctx := context.WithValue(context.Background(), key{}, "message")
+
+	_, err = s.Send(ctx, "test", data)
+	assert.NoError(t, err)
+}
+
 func TestSupervisor_Start_Fails(t *testing.T) {
 	s, a, err := createSupervisor(t, supervisor.RpcIO)
 	assert.NoError(t, err)
@@ -280,6 +304,229 @@ func TestSupervisor_Send_Fails(t *testing.T) {
 	assert.NotNil(t, res)
 }
 
+func TestSupervisor_Send_Persistent_SendsConcurrently(t *testing.T) {
+	adapter := supervisor.NewMockAdapter(t)
+
+	s, err := createSupervisorWithConfig(supervisor.Config{
+		IO:             supervisor.IOConfig{Interface: supervisor.RpcIO},
+		MaxConcurrency: 2,
+	}, adapter)
+	assert.NoError(t, err)
+
+	data := map[string]any{"data": "data"}
+
+	var entered sync.WaitGroup
+	entered.Add(2)
+
+	adapter.EXPECT().Start(mock.Anything, mock.Anything).Return(nil)
+	adapter.EXPECT().Send(mock.Anything, "test", data, mock.Anything).RunAndReturn(
+		func(context.Context, string, map[string]any, time.Duration) (map[string]any, error) {
+			// block until both messages are in flight
+			entered.Done()
+			entered.Wait()
+			return data, nil
+		},
+	)
+
+	var done sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		done.Add(1)
+		go func() {
+			defer done.Done()
+			_, err := s.Send(context.Background(), "test", data)
+			assert.NoError(t, err)
+		}()
+	}
+
+	done.Wait()
+
+	adapter.AssertNumberOfCalls(t, "Start", 1)
+	adapter.AssertNumberOfCalls(t, "Send", 2)
+}
+
+func TestSupervisor_Send_Attach_SendsToEachEndpointConcurrently(t *testing.T) {
+	adapter := supervisor.NewMockAdapter(t)
+
+	s, err := createSupervisorWithConfig(supervisor.Config{
+		IO: supervisor.IOConfig{
+			Interface: supervisor.RpcIO,
+			Rpc: supervisor.RpcConfig{
+				Attach: supervisor.AttachConfig{Endpoints: []string{"a:1", "b:1"}},
+			},
+		},
+		MaxConcurrency: 1,
+	}, adapter)
+	assert.NoError(t, err)
+
+	data := map[string]any{"data": "data"}
+
+	var entered sync.WaitGroup
+	entered.Add(2)
+
+	adapter.EXPECT().Start(mock.Anything, mock.Anything).Return(nil)
+	adapter.EXPECT().Send(mock.Anything, "test", data, mock.Anything).RunAndReturn(
+		func(context.Context, string, map[string]any, time.Duration) (map[string]any, error) {
+			// block until a message is in flight to each endpoint
+			entered.Done()
+			entered.Wait()
+			return data, nil
+		},
+	)
+
+	var done sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		done.Add(1)
+		go func() {
+			defer done.Done()
+			_, err := s.Send(context.Background(), "test", data)
+			assert.NoError(t, err)
+		}()
+	}
+
+	done.Wait()
+
+	adapter.AssertNumberOfCalls(t, "Send", 2)
+}
+
+func TestSupervisor_Send_SerializesByDefault(t *testing.T) {
+	s, a, err := createSupervisor(t, supervisor.RpcIO)
+	assert.NoError(t, err)
+
+	data := map[string]any{"data": "data"}
+
+	entered := make(chan struct{})
+	unblock := make(chan struct{})
+
+	a.EXPECT().Start(mock.Anything, mock.Anything).Return(nil)
+	a.EXPECT().Send(mock.Anything, "test", data, mock.Anything).RunAndReturn(
+		func(context.Context, string, map[string]any, time.Duration) (map[string]any, error) {
+			close(entered)
+			<-unblock
+			return data, nil
+		},
+	).Once()
+
+	go func() {
+		_, _ = s.Send(context.Background(), "test", data)
+	}()
+
+	<-entered
+
+	// the second send must wait for the first one to finish,
+	// so it times out while waiting for a send slot.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err = s.Send(ctx, "test", data)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	close(unblock)
+}
+
+func TestSupervisor_Send_CountsWorkerEvents(t *testing.T) {
+	counters := &supervisor.Counters{}
+
+	a := supervisor.NewMockAdapter(t)
+
+	s, err := supervisor.New(supervisor.Params{
+		Config: supervisor.Config{
+			IO: supervisor.IOConfig{Interface: supervisor.FileIO},
+		},
+		Context: context.Background(),
+		AdapterFactory: func(supervisor.AdapterWorkerFactoryFn, supervisor.IOConfig, *zap.Logger) (supervisor.Adapter, error) {
+			return a, nil
+		},
+		Counters: counters,
+		Log:      zap.NewNop(),
+	})
+	assert.NoError(t, err)
+
+	data := map[string]any{"data": "data"}
+
+	a.EXPECT().Start(mock.Anything, mock.Anything).Return(nil)
+	a.EXPECT().Stop().Return(nil, nil)
+	a.EXPECT().Send(mock.Anything, "test", data, mock.Anything).Return(nil, nil).Once()
+	a.EXPECT().Send(mock.Anything, "test", data, mock.Anything).Return(nil, errors.New("failed")).Once()
+
+	for range 2 {
+		_, _ = s.Send(context.Background(), "test", data)
+	}
+
+	assert.Equal(t, supervisor.WorkerStats{
+		Boots:    2,
+		Crashes:  1,
+		Recycles: 2,
+	}, counters.Snapshot())
+}
+
+// exitingWorker is a worker whose process exits as soon as an exit
+// listener is registered.
+type exitingWorker struct {
+	worker.Worker
+
+	evt worker.ExitEvent
+}
+
+func (w *exitingWorker) OnExit(fn func(worker.ExitEvent)) {
+	fn(w.evt)
+}
+
+func TestSupervisor_CountsWorkerExits(t *testing.T) {
+	counters := &supervisor.Counters{}
+
+	code, signal := 1, 9
+	events := []worker.ExitEvent{{Code: &code}, {Code: &code}, {Signal: &signal}}
+
+	var createWorker supervisor.AdapterWorkerFactoryFn
+
+	a := supervisor.NewMockAdapter(t)
+
+	s, err := supervisor.New(supervisor.Params{
+		Config: supervisor.Config{
+			IO: supervisor.IOConfig{Interface: supervisor.FileIO},
+		},
+		Context: context.Background(),
+		WorkerFactory: func(context.Context, worker.StartConfig, *zap.Logger) (worker.Worker, error) {
+			evt := events[0]
+			events = events[1:]
+			return &exitingWorker{evt: evt}, nil
+		},
+		AdapterFactory: func(factory supervisor.AdapterWorkerFactoryFn, _ supervisor.IOConfig, _ *zap.Logger) (supervisor.Adapter, error) {
+			createWorker = factory
+			return a, nil
+		},
+		Counters: counters,
+		Log:      zap.NewNop(),
+	})
+	assert.NoError(t, err)
+
+	a.EXPECT().Start(mock.Anything, mock.Anything).Return(nil)
+	a.EXPECT().Stop().Return(nil, nil)
+	a.EXPECT().Send(mock.Anything, "test", mock.Anything, mock.Anything).
+		RunAndReturn(func(context.Context, string, map[string]any, time.Duration) (map[string]any, error) {
+			for range 3 {
+				_, err := createWorker(worker.StartConfig{})
+				assert.NoError(t, err)
+			}
+			return nil, nil
+		})
+
+	_, err = s.Send(context.Background(), "test", map[string]any{})
+	assert.NoError(t, err)
+
+	stats := counters.Snapshot()
+
+	assert.Equal(t, map[string]int64{"1": 2}, stats.ExitCodes)
+	assert.Equal(t, map[string]int64{"9": 1}, stats.ExitSignals)
+}
+
+func TestSupervisor_MemoryUsage_WithoutWorker(t *testing.T) {
+	s, _, err := createSupervisor(t, supervisor.RpcIO)
+	assert.NoError(t, err)
+
+	assert.Equal(t, uint64(0), s.MemoryUsage())
+}
+
 // MARK: - mocks
 
 func createSupervisor(t *testing.T, mode supervisor.IOInterface) (
@@ -314,3 +561,17 @@ func createSupervisorWithFactory(
 		Log:            zap.NewNop(),
 	})
 }
+
+func createSupervisorWithConfig(
+	config supervisor.Config,
+	adapter supervisor.Adapter,
+) (supervisor.Supervisor, error) {
+	return supervisor.New(supervisor.Params{
+		Config:  config,
+		Context: context.Background(),
+		AdapterFactory: func(supervisor.AdapterWorkerFactoryFn, supervisor.IOConfig, *zap.Logger) (supervisor.Adapter, error) {
+			return adapter, nil
+		},
+		Log: zap.NewNop(),
+	})
+}
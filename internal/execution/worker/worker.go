@@ -97,6 +97,9 @@ type ProcessWorker struct {
 	stderr   bytes.Buffer
 	stderrWg sync.WaitGroup
 
+	// onExit is called with the exit event once the process exited
+	onExit func(ExitEvent)
+
 	log *zap.Logger
 }
 
@@ -159,6 +162,8 @@ func (w *ProcessWorker) Start(ctx context.Context) error {
 		return w.cmd.Process.Kill()
 	}
 
+	onExit := w.onExit
+
 	// wait for the process to terminate,
 	// and send the exit event to the channel
 	go func() {
@@ -183,6 +188,10 @@ func (w *ProcessWorker) Start(ctx context.Context) error {
 			).Warn("process exited with non-zero code")
 		}
 
+		if onExit != nil {
+			onExit(evt)
+		}
+
 		// send the exit event to the channel
 		w.exit <- evt
 
@@ -302,6 +311,15 @@ func (w *ProcessWorker) halt(force bool) error {
 	return nil
 }
 
+// OnExit registers a function, which is called with the exit event
+// once the process exited. It must be called before starting the worker.
+func (w *ProcessWorker) OnExit(fn func(ExitEvent)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.onExit = fn
+}
+
 func (w *ProcessWorker) Pid() int {
 	w.mu.Lock()
 	defer w.mu.Unlock()
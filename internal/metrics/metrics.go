@@ -0,0 +1,118 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// DurationBuckets are the upper bounds of the buckets of latency
+// histograms, in seconds.
+var DurationBuckets = []float64{
+	0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60,
+}
+
+// fanOutBuckets are the upper bounds of the buckets of the number of
+// cases evaluated per request.
+var fanOutBuckets = []float64{1, 2, 4, 8, 16, 32, 64}
+
+// Metrics are the metrics of the application. All methods are safe to
+// call on a nil instance, in which case nothing is recorded.
+type Metrics struct {
+	registry *prometheus.Registry
+	handler  http.Handler
+
+	requests           *prometheus.CounterVec
+	requestDuration    *prometheus.HistogramVec
+	validationFailures *prometheus.CounterVec
+	caseEvaluations    *prometheus.HistogramVec
+}
+
+// New creates the metrics of the application.
+func New() *Metrics {
+	registry := prometheus.NewRegistry()
+
+	m := &Metrics{
+		registry: registry,
+		// responses are not compressed, as they are passed through the
+		// proxy source in lambda mode
+		handler: promhttp.HandlerFor(registry, promhttp.HandlerOpts{
+			DisableCompression: true,
+		}),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "shimmy_requests_total",
+			Help: "The number of handled requests.",
+		}, []string{"function", "command", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "shimmy_request_duration_seconds",
+			Help:    "The time to handle a request.",
+			Buckets: DurationBuckets,
+		}, []string{"function", "command", "status"}),
+		validationFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "shimmy_validation_failures_total",
+			Help: "The number of requests and responses failing schema validation.",
+		}, []string{"function", "command", "kind"}),
+		caseEvaluations: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "shimmy_case_evaluations",
+			Help:    "The number of cases evaluated for a request, in addition to the request itself.",
+			Buckets: fanOutBuckets,
+		}, []string{"function", "command"}),
+	}
+
+	registry.MustRegister(
+		m.requests,
+		m.requestDuration,
+		m.validationFailures,
+		m.caseEvaluations,
+	)
+
+	return m
+}
+
+// ObserveRequest records a handled request.
+func (m *Metrics) ObserveRequest(function, command string, status int, d time.Duration) {
+	if m == nil {
+		return
+	}
+
+	code := strconv.Itoa(status)
+
+	m.requests.WithLabelValues(function, command, code).Inc()
+	m.requestDuration.WithLabelValues(function, command, code).Observe(d.Seconds())
+}
+
+// ObserveValidationFailure records a request or response failing schema
+// validation. The kind is either `request`, `params` or `response`.
+func (m *Metrics) ObserveValidationFailure(function, command, kind string) {
+	if m == nil {
+		return
+	}
+
+	m.validationFailures.WithLabelValues(function, command, kind).Inc()
+}
+
+// ObserveCaseEvaluations records the number of cases evaluated for a request.
+func (m *Metrics) ObserveCaseEvaluations(function, command string, n int) {
+	if m == nil {
+		return
+	}
+
+	m.caseEvaluations.WithLabelValues(function, command).Observe(float64(n))
+}
+
+// Register adds a collector to the metrics.
+func (m *Metrics) Register(c prometheus.Collector) {
+	if m == nil {
+		return
+	}
+
+	m.registry.MustRegister(c)
+}
+
+// ServeHTTP writes all metrics in the Prometheus exposition format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	m.handler.ServeHTTP(w, req)
+}
@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics_ServeHTTP(t *testing.T) {
+	m := New()
+	m.ObserveRequest("", "eval", 200, 50*time.Millisecond)
+	m.ObserveRequest("", "eval", 200, 2*time.Second)
+	m.ObserveCaseEvaluations("", "eval", 3)
+
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	body := w.Body.String()
+
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/plain")
+	assert.Contains(t, body, "# TYPE shimmy_requests_total counter\n")
+	assert.Contains(t, body, `shimmy_requests_total{command="eval",function="",status="200"} 2`)
+	assert.Contains(t, body, `shimmy_request_duration_seconds_bucket{command="eval",function="",status="200",le="0.05"} 1`)
+	assert.Contains(t, body, `shimmy_request_duration_seconds_count{command="eval",function="",status="200"} 2`)
+	assert.Contains(t, body, `shimmy_case_evaluations_bucket{command="eval",function="",le="4"} 1`)
+}
+
+func TestMetrics_NilIsNoop(t *testing.T) {
+	var m *Metrics
+
+	assert.NotPanics(t, func() {
+		m.ObserveRequest("", "eval", 200, 0)
+		m.ObserveValidationFailure("", "eval", "request")
+		m.ObserveCaseEvaluations("", "eval", 2)
+		m.Register(prometheus.NewCounter(prometheus.CounterOpts{Name: "noop_total"}))
+	})
+}
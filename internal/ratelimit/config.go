@@ -0,0 +1,82 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/lambda-feedback/shimmy/runtime"
+)
+
+type Config struct {
+	// Rate is the number of requests per second each client may send
+	// on average, across commands without a limit of their own. Default
+	// is 0, which leaves them unlimited.
+	Rate float64 `conf:"rate"`
+
+	// Burst is the number of requests each client may send at once,
+	// before being limited to Rate. Default is Rate, rounded up.
+	Burst int `conf:"burst"`
+
+	// Commands are the limits of individual commands, as
+	// `command=rate` or `command=rate:burst`. The requests of each
+	// command are limited separately.
+	Commands []string `conf:"commands"`
+}
+
+// Enabled returns true if any requests are limited.
+func (c Config) Enabled() bool {
+	return c.Rate > 0 || len(c.Commands) > 0
+}
+
+// limit is the rate and bucket size of a token bucket.
+type limit struct {
+	rate  float64
+	burst float64
+}
+
+// newLimit returns the limit for the rate and burst, defaulting the
+// burst to the rate, rounded up.
+func newLimit(rate float64, burst int) limit {
+	if burst <= 0 {
+		burst = max(1, int(math.Ceil(rate)))
+	}
+
+	return limit{rate: rate, burst: float64(burst)}
+}
+
+// parseCommandLimits parses a list of `command=rate[:burst]` entries.
+func parseCommandLimits(entries []string) (map[string]limit, error) {
+	limits := make(map[string]limit, len(entries))
+
+	for _, entry := range entries {
+		command, value, ok := strings.Cut(entry, "=")
+		if !ok || command == "" {
+			return nil, fmt.Errorf("invalid rate limit '%s', expected command=rate", entry)
+		}
+
+		parsed, ok := runtime.ParseCommand(command)
+		if !ok {
+			return nil, fmt.Errorf("invalid rate limit '%s', unknown command '%s'", entry, command)
+		}
+
+		rateStr, burstStr, hasBurst := strings.Cut(value, ":")
+
+		rate, err := strconv.ParseFloat(rateStr, 64)
+		if err != nil || rate <= 0 {
+			return nil, fmt.Errorf("invalid rate limit '%s', expected a positive rate", entry)
+		}
+
+		burst := 0
+		if hasBurst {
+			if burst, err = strconv.Atoi(burstStr); err != nil || burst <= 0 {
+				return nil, fmt.Errorf("invalid rate limit '%s', expected a positive burst", entry)
+			}
+		}
+
+		limits[string(parsed)] = newLimit(rate, burst)
+	}
+
+	return limits, nil
+}
@@ -0,0 +1,266 @@
+package ratelimit
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/awslabs/aws-lambda-go-api-proxy/core"
+	"go.uber.org/zap"
+
+	"github.com/lambda-feedback/shimmy/internal/auth"
+	"github.com/lambda-feedback/shimmy/internal/server"
+	"github.com/lambda-feedback/shimmy/runtime"
+)
+
+// pruneInterval is the interval to remove the buckets of idle clients.
+const pruneInterval = time.Minute
+
+// bucketKey identifies the bucket of a client. Commands without a limit
+// of their own share the bucket with an empty command.
+type bucketKey struct {
+	client  string
+	command string
+}
+
+// bucket is a token bucket. Its tokens are refilled lazily, when the
+// client sends its next request.
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// refill adds the tokens accrued since the last update.
+func (b *bucket) refill(l limit, now time.Time) {
+	b.tokens = min(l.burst, b.tokens+now.Sub(b.updated).Seconds()*l.rate)
+	b.updated = now
+}
+
+// decision is the outcome of taking a token from a bucket.
+type decision struct {
+	allowed   bool
+	remaining float64
+	limit     limit
+}
+
+// Limiter limits the rate of the requests each client sends to the
+// command handlers, using a token bucket per client. Clients are
+// identified by the subject of their bearer token, the label of their
+// API key, or their IP address. All methods are safe to call on a nil
+// instance, which limits no request.
+type Limiter struct {
+	fallback limit
+	commands map[string]limit
+
+	keys   *auth.Keyring
+	tokens *auth.Verifier
+
+	mu        sync.Mutex
+	buckets   map[bucketKey]*bucket
+	nextPrune time.Time
+
+	// now returns the current time, to refill the buckets
+	now func() time.Time
+
+	log *zap.Logger
+}
+
+// NewLimiter creates a limiter for the config. It returns nil if no
+// requests are limited.
+func NewLimiter(config Config, keys *auth.Keyring, tokens *auth.Verifier, log *zap.Logger) (*Limiter, error) {
+	if !config.Enabled() {
+		return nil, nil
+	}
+
+	commands, err := parseCommandLimits(config.Commands)
+	if err != nil {
+		return nil, err
+	}
+
+	var fallback limit
+	if config.Rate > 0 {
+		fallback = newLimit(config.Rate, config.Burst)
+	}
+
+	return &Limiter{
+		fallback: fallback,
+		commands: commands,
+		keys:     keys,
+		tokens:   tokens,
+		buckets:  make(map[bucketKey]*bucket),
+		now:      time.Now,
+		log:      log.Named("ratelimit"),
+	}, nil
+}
+
+// Wrap limits the requests to the handler, if it serves commands.
+func (l *Limiter) Wrap(handler *server.HttpHandler) http.Handler {
+	if l == nil || !handler.Commands {
+		return handler.Handler
+	}
+
+	next := handler.Handler
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the command is resolved as by the handler, so requests are
+		// charged to the command that is run
+		command := runtime.RequestCommand(r)
+		if c, ok := runtime.ParseCommand(command); ok {
+			command = string(c)
+		}
+
+		client, r := l.client(r)
+
+		if d, limited := l.take(client, command); limited {
+			setHeaders(w.Header(), d)
+
+			if !d.allowed {
+				l.log.Debug("rate limit exceeded",
+					zap.String("client", client),
+					zap.String("command", command),
+				)
+
+				w.Header().Set("Retry-After", strconv.Itoa(seconds((1-d.remaining)/d.limit.rate)))
+				http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// client returns the identity the requests of r are limited by. Only
+// verified credentials are used, so clients can't evade their limit by
+// sending made up keys. The identity of a verified bearer token is added
+// to the context of the returned request, so it is not verified again
+// by the command handler.
+func (l *Limiter) client(r *http.Request) (string, *http.Request) {
+	if token, ok := auth.BearerToken(r); ok {
+		if identity, err := l.tokens.Verify(token); err == nil {
+			r = r.WithContext(auth.ContextWithIdentity(r.Context(), identity))
+
+			if identity.Subject != "" {
+				return "subject:" + identity.Subject, r
+			}
+		}
+	}
+
+	if key, ok := l.keys.Authenticate(r.Header.Get("api-key")); ok {
+		return "key:" + key.Label, r
+	}
+
+	return "ip:" + remoteIP(r), r
+}
+
+// remoteIP returns the IP address of the client. The lambda handler
+// sets the remote address to the bare source IP of API Gateway events.
+// ALB events carry no source IP, so the address appended to the
+// X-Forwarded-For header by the load balancer is used instead.
+func remoteIP(r *http.Request) string {
+	if _, ok := core.GetTargetGroupRequetFromContextALB(r.Context()); ok {
+		if ip := forwardedFor(r); ip != "" {
+			return ip
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// forwardedFor returns the last address of the X-Forwarded-For header,
+// which is the one appended by the load balancer. Preceding addresses
+// are sent by the client, and can't be trusted.
+func forwardedFor(r *http.Request) string {
+	values := r.Header.Values("X-Forwarded-For")
+	if len(values) == 0 {
+		return ""
+	}
+
+	addrs := strings.Split(values[len(values)-1], ",")
+
+	return strings.TrimSpace(addrs[len(addrs)-1])
+}
+
+// take takes a token from the bucket of the client for the command. It
+// returns false if the command is not limited.
+func (l *Limiter) take(client, command string) (decision, bool) {
+	key := bucketKey{client: client}
+
+	lim, ok := l.commands[command]
+	if ok {
+		key.command = command
+	} else {
+		lim = l.fallback
+	}
+
+	if lim.rate <= 0 {
+		return decision{}, false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.prune(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: lim.burst, updated: now}
+		l.buckets[key] = b
+	}
+
+	b.refill(lim, now)
+
+	d := decision{limit: lim}
+	if b.tokens >= 1 {
+		b.tokens--
+		d.allowed = true
+	}
+
+	d.remaining = b.tokens
+
+	return d, true
+}
+
+// prune removes the buckets that are full, as they are equivalent to
+// the bucket of a new client.
+func (l *Limiter) prune(now time.Time) {
+	if now.Before(l.nextPrune) {
+		return
+	}
+
+	for key, b := range l.buckets {
+		lim, ok := l.commands[key.command]
+		if !ok {
+			lim = l.fallback
+		}
+
+		if b.refill(lim, now); b.tokens >= lim.burst {
+			delete(l.buckets, key)
+		}
+	}
+
+	l.nextPrune = now.Add(pruneInterval)
+}
+
+// setHeaders sets the `RateLimit-*` headers describing the bucket.
+func setHeaders(header http.Header, d decision) {
+	header.Set("RateLimit-Limit", strconv.Itoa(int(d.limit.burst)))
+	header.Set("RateLimit-Remaining", strconv.Itoa(int(d.remaining)))
+	header.Set("RateLimit-Reset", strconv.Itoa(seconds((d.limit.burst-d.remaining)/d.limit.rate)))
+	header.Set("RateLimit-Policy", strconv.Itoa(int(d.limit.burst))+";w="+strconv.Itoa(seconds(d.limit.burst/d.limit.rate)))
+}
+
+// seconds rounds the duration in seconds up to whole seconds.
+func seconds(s float64) int {
+	return int(math.Ceil(s))
+}
@@ -0,0 +1,216 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/awslabs/aws-lambda-go-api-proxy/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/lambda-feedback/shimmy/internal/auth"
+	"github.com/lambda-feedback/shimmy/internal/server"
+)
+
+// testClock is a clock advanced manually by tests.
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newTestLimiter(t *testing.T, config Config, keys *auth.Keyring) (*Limiter, *testClock) {
+	l, err := NewLimiter(config, keys, nil, zap.NewNop())
+	require.NoError(t, err)
+
+	clock := &testClock{now: time.Now()}
+	l.now = clock.Now
+
+	return l, clock
+}
+
+// newTestHandler returns the command handler wrapped by the limiter.
+func newTestHandler(l *Limiter) http.Handler {
+	mux := server.NewServeMux([]*server.HttpHandler{
+		server.AsCommandHttpHandler("/{command}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})).Handler,
+		server.AsCommandHttpHandler("/legacy/{path}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})).Handler,
+		server.AsHttpHandler("/health", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})).Handler,
+	}, []server.Middleware{l})
+
+	return mux
+}
+
+func send(handler http.Handler, path string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	return w
+}
+
+func TestLimiter_TokenBucket(t *testing.T) {
+	l, clock := newTestLimiter(t, Config{Rate: 1, Burst: 3}, nil)
+	handler := newTestHandler(l)
+
+	for i := range 3 {
+		w := send(handler, "/eval", nil)
+		require.Equal(t, http.StatusOK, w.Code, i)
+		assert.Equal(t, "3", w.Header().Get("RateLimit-Limit"))
+		assert.Equal(t, "3;w=3", w.Header().Get("RateLimit-Policy"))
+	}
+
+	w := send(handler, "/eval", nil)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "3", w.Header().Get("RateLimit-Reset"))
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+
+	// tokens are refilled at the rate
+	clock.Advance(time.Second)
+	assert.Equal(t, http.StatusOK, send(handler, "/eval", nil).Code)
+	assert.Equal(t, http.StatusTooManyRequests, send(handler, "/eval", nil).Code)
+
+	// other endpoints are not limited
+	w = send(handler, "/health", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("RateLimit-Limit"))
+}
+
+func TestLimiter_CommandLimits(t *testing.T) {
+	l, _ := newTestLimiter(t, Config{Commands: []string{"preview=1:2"}}, nil)
+	handler := newTestHandler(l)
+
+	assert.Equal(t, http.StatusOK, send(handler, "/preview", nil).Code)
+	assert.Equal(t, http.StatusOK, send(handler, "/PREVIEW", nil).Code)
+	assert.Equal(t, http.StatusTooManyRequests, send(handler, "/preview", nil).Code)
+
+	// the command header takes precedence over the path
+	assert.Equal(t, http.StatusTooManyRequests, send(handler, "/eval", http.Header{"Command": {"preview"}}).Code)
+
+	// commands without a limit are not limited, without a default rate
+	for range 5 {
+		assert.Equal(t, http.StatusOK, send(handler, "/eval", nil).Code)
+	}
+
+	// paths not naming the command run, and are charged to, `eval`
+	for range 5 {
+		assert.Equal(t, http.StatusOK, send(handler, "/legacy/preview", nil).Code)
+	}
+}
+
+func TestLimiter_IdentifiesClients(t *testing.T) {
+	keys, err := auth.NewKeyring(auth.Config{Keys: []auth.Key{
+		{Label: "grader", Key: "grader-secret"},
+		{Label: "frontend", Key: "frontend-secret"},
+	}}, zap.NewNop())
+	require.NoError(t, err)
+
+	l, _ := newTestLimiter(t, Config{Rate: 1}, keys)
+	handler := newTestHandler(l)
+
+	grader := http.Header{"Api-Key": {"grader-secret"}}
+	frontend := http.Header{"Api-Key": {"frontend-secret"}}
+
+	assert.Equal(t, http.StatusOK, send(handler, "/eval", grader).Code)
+	assert.Equal(t, http.StatusTooManyRequests, send(handler, "/eval", grader).Code)
+	assert.Equal(t, http.StatusOK, send(handler, "/eval", frontend).Code)
+
+	// invalid keys are limited by IP address, so they share a bucket
+	assert.Equal(t, http.StatusOK, send(handler, "/eval", http.Header{"Api-Key": {"made-up-1"}}).Code)
+	assert.Equal(t, http.StatusTooManyRequests, send(handler, "/eval", http.Header{"Api-Key": {"made-up-2"}}).Code)
+}
+
+func TestLimiter_IdentifiesClientsBehindALB(t *testing.T) {
+	l, _ := newTestLimiter(t, Config{Rate: 1}, nil)
+	handler := newTestHandler(l)
+
+	// sendALB sends a request converted from an ALB event, as the lambda
+	// handler does
+	sendALB := func(forwardedFor string) int {
+		req, err := (&core.RequestAccessorALB{}).EventToRequestWithContext(context.Background(), events.ALBTargetGroupRequest{
+			HTTPMethod: http.MethodPost,
+			Path:       "/eval",
+			Headers:    map[string]string{"x-forwarded-for": forwardedFor},
+		})
+		require.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, sendALB("203.0.113.1"))
+	assert.Equal(t, http.StatusTooManyRequests, sendALB("203.0.113.1"))
+	assert.Equal(t, http.StatusOK, sendALB("203.0.113.2"))
+
+	// addresses sent by the client are ignored
+	assert.Equal(t, http.StatusTooManyRequests, sendALB("198.51.100.7, 203.0.113.1"))
+
+	// the header is ignored for requests not sent through an ALB
+	assert.Equal(t, http.StatusOK, send(handler, "/eval", http.Header{"X-Forwarded-For": {"198.51.100.8"}}).Code)
+	assert.Equal(t, http.StatusTooManyRequests, send(handler, "/eval", http.Header{"X-Forwarded-For": {"198.51.100.9"}}).Code)
+}
+
+func TestLimiter_PrunesFullBuckets(t *testing.T) {
+	l, clock := newTestLimiter(t, Config{Rate: 1, Burst: 2}, nil)
+
+	_, limited := l.take("ip:192.0.2.1", "eval")
+	require.True(t, limited)
+	assert.Len(t, l.buckets, 1)
+
+	clock.Advance(pruneInterval)
+
+	_, limited = l.take("ip:192.0.2.2", "eval")
+	require.True(t, limited)
+	assert.Len(t, l.buckets, 1)
+	assert.Contains(t, l.buckets, bucketKey{client: "ip:192.0.2.2"})
+}
+
+func TestLimiter_Disabled(t *testing.T) {
+	l, err := NewLimiter(Config{}, nil, nil, zap.NewNop())
+	require.NoError(t, err)
+	assert.Nil(t, l)
+
+	handler := newTestHandler(l)
+	for range 5 {
+		assert.Equal(t, http.StatusOK, send(handler, "/eval", nil).Code)
+	}
+}
+
+func TestNewLimiter_InvalidCommandLimits(t *testing.T) {
+	for entry, message := range map[string]string{
+		"preview":            "expected command=rate",
+		"evaluate=1":         "unknown command 'evaluate'",
+		"preview=fast":       "expected a positive rate",
+		"preview=0":          "expected a positive rate",
+		"preview=1:":         "expected a positive burst",
+		"preview=1:-2":       "expected a positive burst",
+		"preview=1:a_little": "expected a positive burst",
+	} {
+		_, err := NewLimiter(Config{Commands: []string{entry}}, nil, nil, zap.NewNop())
+		assert.ErrorContains(t, err, message, entry)
+	}
+}
@@ -0,0 +1,28 @@
+package ratelimit
+
+import (
+	"go.uber.org/fx"
+
+	"github.com/lambda-feedback/shimmy/internal/server"
+)
+
+// Module provides a middleware limiting the rate of the requests each
+// client sends to the command handlers.
+func Module(config Config) fx.Option {
+	return fx.Module(
+		"ratelimit",
+
+		// provide rate limit config
+		fx.Supply(config),
+
+		// provide limiter
+		fx.Provide(NewLimiter),
+
+		// wrap the handlers
+		fx.Provide(NewMiddleware),
+	)
+}
+
+func NewMiddleware(limiter *Limiter) server.MiddlewareResult {
+	return server.AsMiddleware(limiter)
+}
@@ -1,7 +1,52 @@
 package server
 
+import "time"
+
 type HttpConfig struct {
 	Host string `conf:"host"`
 	Port int    `conf:"port"`
 	H2c  bool   `conf:"h2c"`
+
+	// TLS serves HTTPS, if a certificate is configured
+	TLS TLSConfig `conf:"tls"`
+}
+
+// ClientAuth is the policy for client certificates.
+type ClientAuth string
+
+const (
+	// RequireClientCert rejects clients without a valid certificate.
+	RequireClientCert ClientAuth = "require"
+
+	// OptionalClientCert verifies the certificate of clients that
+	// present one, and accepts clients without a certificate.
+	OptionalClientCert ClientAuth = "optional"
+)
+
+type TLSConfig struct {
+	// CertFile is the path to the PEM encoded certificate chain. If
+	// empty, the server serves plaintext.
+	CertFile string `conf:"cert"`
+
+	// KeyFile is the path to the PEM encoded private key.
+	KeyFile string `conf:"key"`
+
+	// ClientCAFile is the path to the PEM encoded CA bundle to verify
+	// client certificates against. If empty, clients are not asked
+	// for a certificate.
+	ClientCAFile string `conf:"client_ca"`
+
+	// ClientAuth is the policy for client certificates, if a client
+	// CA bundle is configured. Default is require.
+	ClientAuth ClientAuth `conf:"client_auth"`
+
+	// ReloadInterval is the interval to check the files for changes.
+	// Changed files are reloaded, so certificates can be rotated
+	// without a restart. Default is 10s.
+	ReloadInterval time.Duration `conf:"reload_interval"`
+}
+
+// Enabled returns true if the server serves HTTPS.
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != ""
 }
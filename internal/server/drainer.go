@@ -0,0 +1,26 @@
+package server
+
+import (
+	"context"
+
+	"go.uber.org/fx"
+)
+
+// Drainer is drained by the server on shutdown, before the server stops
+// accepting connections. This allows components to reject new requests
+// and finish in-flight requests, while clients are still able to connect.
+type Drainer interface {
+	Drain(context.Context) error
+}
+
+type DrainerResult struct {
+	fx.Out
+
+	Drainer Drainer `group:"drainers"`
+}
+
+func AsDrainer(drainer Drainer) DrainerResult {
+	return DrainerResult{
+		Drainer: drainer,
+	}
+}
@@ -9,6 +9,10 @@ import (
 type HttpHandler struct {
 	Name    string
 	Handler http.Handler
+
+	// Commands is true if the handler serves commands, which are run
+	// by the workers of a function
+	Commands bool
 }
 
 type HttpHandlerResult struct {
@@ -28,3 +32,14 @@ func AsHttpHandler(
 		},
 	}
 }
+
+// AsCommandHttpHandler registers a handler serving commands.
+func AsCommandHttpHandler(
+	name string,
+	handler http.Handler,
+) HttpHandlerResult {
+	result := AsHttpHandler(name, handler)
+	result.Handler.Commands = true
+
+	return result
+}
@@ -0,0 +1,45 @@
+package server
+
+import (
+	"net/http"
+
+	"go.uber.org/fx"
+)
+
+// Middleware wraps the handlers registered through HttpHandler, both
+// by the standalone server and the lambda handler.
+type Middleware interface {
+	Wrap(handler *HttpHandler) http.Handler
+}
+
+type MiddlewareResult struct {
+	fx.Out
+
+	Middleware Middleware `group:"middlewares"`
+}
+
+func AsMiddleware(middleware Middleware) MiddlewareResult {
+	return MiddlewareResult{
+		Middleware: middleware,
+	}
+}
+
+// NewServeMux returns a mux serving the handlers, each wrapped by the
+// middlewares. The first middleware is the outermost.
+func NewServeMux(handlers []*HttpHandler, middlewares []Middleware) *http.ServeMux {
+	mux := http.NewServeMux()
+
+	for _, handler := range handlers {
+		wrapped := handler.Handler
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			inner := *handler
+			inner.Handler = wrapped
+
+			wrapped = middlewares[i].Wrap(&inner)
+		}
+
+		mux.Handle(handler.Name, wrapped)
+	}
+
+	return mux
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// tagMiddleware appends its tag to the body of command handlers.
+type tagMiddleware string
+
+func (m tagMiddleware) Wrap(handler *HttpHandler) http.Handler {
+	if !handler.Commands {
+		return handler.Handler
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, string(m)+">")
+		handler.Handler.ServeHTTP(w, r)
+	})
+}
+
+func TestNewServeMux_WrapsHandlers(t *testing.T) {
+	serve := func(body string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, body)
+		})
+	}
+
+	eval := AsCommandHttpHandler("/eval", serve("eval")).Handler
+	health := AsHttpHandler("/health", serve("ok")).Handler
+
+	mux := NewServeMux([]*HttpHandler{eval, health}, []Middleware{tagMiddleware("outer"), tagMiddleware("inner")})
+
+	for path, body := range map[string]string{
+		"/eval":   "outer>inner>eval",
+		"/health": "ok",
+	} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, body, w.Body.String(), path)
+	}
+
+	// the registered handlers are left untouched
+	w := httptest.NewRecorder()
+	eval.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/eval", nil))
+	assert.Equal(t, "eval", w.Body.String())
+}
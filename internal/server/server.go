@@ -2,9 +2,11 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
+	"sync"
 
 	"go.uber.org/fx"
 	"go.uber.org/zap"
@@ -19,24 +21,24 @@ type HttpServerParams struct {
 
 	Config HttpConfig
 
-	Handlers []*HttpHandler `group:"handlers"`
-	Logger   *zap.Logger
+	Handlers    []*HttpHandler `group:"handlers"`
+	Middlewares []Middleware   `group:"middlewares"`
+	Drainers    []Drainer      `group:"drainers"`
+	Logger      *zap.Logger
 }
 
 type HttpServer struct {
-	ctx    context.Context
-	host   string
-	port   int
-	server *http.Server
-	log    *zap.Logger
+	ctx      context.Context
+	host     string
+	port     int
+	server   *http.Server
+	tls      *tlsReloader
+	drainers []Drainer
+	log      *zap.Logger
 }
 
-func NewHttpServer(params HttpServerParams) *HttpServer {
-	mux := http.NewServeMux()
-
-	for _, handler := range params.Handlers {
-		mux.Handle(handler.Name, handler.Handler)
-	}
+func NewHttpServer(params HttpServerParams) (*HttpServer, error) {
+	mux := NewServeMux(params.Handlers, params.Middlewares)
 
 	var handler http.Handler = mux
 	if params.Config.H2c {
@@ -48,17 +50,32 @@ func NewHttpServer(params HttpServerParams) *HttpServer {
 		Handler: handler,
 	}
 
-	return &HttpServer{
-		ctx:    params.Context,
-		host:   params.Config.Host,
-		port:   params.Config.Port,
-		server: server,
-		log:    params.Logger,
+	var reloader *tlsReloader
+	if params.Config.TLS.Enabled() {
+		var err error
+		if reloader, err = newTLSReloader(params.Config.TLS, params.Logger); err != nil {
+			return nil, err
+		}
+
+		server.TLSConfig = reloader.tlsConfig()
 	}
+
+	return &HttpServer{
+		ctx:      params.Context,
+		host:     params.Config.Host,
+		port:     params.Config.Port,
+		server:   server,
+		tls:      reloader,
+		drainers: params.Drainers,
+		log:      params.Logger,
+	}, nil
 }
 
-func NewLifecycleServer(params HttpServerParams, lc fx.Lifecycle) *HttpServer {
-	server := NewHttpServer(params)
+func NewLifecycleServer(params HttpServerParams, lc fx.Lifecycle) (*HttpServer, error) {
+	server, err := NewHttpServer(params)
+	if err != nil {
+		return nil, err
+	}
 	lc.Append(fx.Hook{
 		OnStart: func(ctx context.Context) error {
 			go server.Serve(ctx)
@@ -68,7 +85,7 @@ func NewLifecycleServer(params HttpServerParams, lc fx.Lifecycle) *HttpServer {
 			return server.Shutdown(ctx)
 		},
 	})
-	return server
+	return server, nil
 }
 
 func (s *HttpServer) Serve(context.Context) error {
@@ -88,9 +105,12 @@ func (s *HttpServer) Serve(context.Context) error {
 		return err
 	}
 
-	s.log.With(zap.String("address", listener.Addr().String())).Info("listening")
+	s.log.With(
+		zap.String("address", listener.Addr().String()),
+		zap.Bool("tls", s.tls != nil),
+	).Info("listening")
 
-	if err := s.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+	if err := s.serve(ctx, listener); err != nil && err != http.ErrServerClosed {
 		s.log.With(zap.Error(err)).Error("failed to serve")
 		return err
 	}
@@ -98,7 +118,26 @@ func (s *HttpServer) Serve(context.Context) error {
 	return nil
 }
 
+// serve serves plaintext, or HTTPS if TLS is configured. Certificates
+// are reloaded in the background while serving.
+func (s *HttpServer) serve(ctx context.Context, listener net.Listener) error {
+	if s.tls == nil {
+		return s.server.Serve(listener)
+	}
+
+	go s.tls.watch(ctx)
+
+	// the certificate is resolved by the tls config
+	return s.server.ServeTLS(listener, "", "")
+}
+
 func (s *HttpServer) Shutdown(ctx context.Context) error {
+	// drain before closing the listener, so new requests
+	// are rejected gracefully while in-flight requests finish
+	if err := s.drain(ctx); err != nil {
+		s.log.With(zap.Error(err)).Error("failed to drain")
+	}
+
 	if err := s.server.Shutdown(ctx); err != nil {
 		s.log.With(zap.Error(err)).Error("failed to shutdown")
 		return err
@@ -106,3 +145,20 @@ func (s *HttpServer) Shutdown(ctx context.Context) error {
 
 	return nil
 }
+
+func (s *HttpServer) drain(ctx context.Context) error {
+	errs := make([]error, len(s.drainers))
+
+	var wg sync.WaitGroup
+	for i, drainer := range s.drainers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = drainer.Drain(ctx)
+		}()
+	}
+
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
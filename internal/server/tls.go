@@ -0,0 +1,210 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// defaultReloadInterval is the default interval to check the
+// certificate files for changes.
+const defaultReloadInterval = 10 * time.Second
+
+// fileStamp identifies the version of a file.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// tlsReloader holds the certificate and client CA bundle of the server,
+// and reloads them when the files change. Handshakes always use the
+// most recently loaded files.
+type tlsReloader struct {
+	config   TLSConfig
+	interval time.Duration
+
+	cert      atomic.Pointer[tls.Certificate]
+	clientCAs atomic.Pointer[x509.CertPool]
+
+	// stamps are the versions of the loaded files, by path. They are
+	// only accessed by the reload loop, after the initial load.
+	stamps map[string]fileStamp
+
+	log *zap.Logger
+}
+
+// newTLSReloader loads the certificate and client CA bundle. It fails
+// if the config is invalid, or the files can't be loaded.
+func newTLSReloader(config TLSConfig, log *zap.Logger) (*tlsReloader, error) {
+	if config.CertFile == "" || config.KeyFile == "" {
+		return nil, errors.New("tls: both a certificate and a key are required")
+	}
+
+	switch config.ClientAuth {
+	case "", RequireClientCert, OptionalClientCert:
+	default:
+		return nil, fmt.Errorf("tls: invalid client auth '%s'", config.ClientAuth)
+	}
+
+	interval := config.ReloadInterval
+	if interval <= 0 {
+		interval = defaultReloadInterval
+	}
+
+	r := &tlsReloader{
+		config:   config,
+		interval: interval,
+		stamps:   make(map[string]fileStamp),
+		log:      log.Named("tls"),
+	}
+
+	if _, err := r.reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// files returns the paths of the files to load.
+func (r *tlsReloader) files() []string {
+	files := []string{r.config.CertFile, r.config.KeyFile}
+	if r.config.ClientCAFile != "" {
+		files = append(files, r.config.ClientCAFile)
+	}
+
+	return files
+}
+
+// reload loads the files, if any changed since they were last loaded.
+// If loading fails, the previously loaded files are kept.
+func (r *tlsReloader) reload() (bool, error) {
+	stamps := make(map[string]fileStamp)
+	changed := false
+
+	for _, file := range r.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return false, fmt.Errorf("tls: %w", err)
+		}
+
+		stamp := fileStamp{modTime: info.ModTime(), size: info.Size()}
+		if r.stamps[file] != stamp {
+			changed = true
+		}
+
+		stamps[file] = stamp
+	}
+
+	if !changed {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.config.CertFile, r.config.KeyFile)
+	if err != nil {
+		return false, fmt.Errorf("tls: failed to load certificate: %w", err)
+	}
+
+	var clientCAs *x509.CertPool
+	if r.config.ClientCAFile != "" {
+		data, err := os.ReadFile(r.config.ClientCAFile)
+		if err != nil {
+			return false, fmt.Errorf("tls: failed to read client CA bundle: %w", err)
+		}
+
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(data) {
+			return false, errors.New("tls: client CA bundle contains no certificates")
+		}
+	}
+
+	r.cert.Store(&cert)
+	r.clientCAs.Store(clientCAs)
+	r.stamps = stamps
+
+	return true, nil
+}
+
+// watch reloads changed files periodically, until ctx is done.
+func (r *tlsReloader) watch(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		reloaded, err := r.reload()
+		if err != nil {
+			r.log.Error("failed to reload certificates, keeping previous", zap.Error(err))
+			continue
+		}
+
+		if reloaded {
+			r.log.Info("reloaded certificates")
+		}
+	}
+}
+
+// tlsConfig returns the config of the server, which resolves the
+// certificate and client CA bundle on every handshake.
+func (r *tlsReloader) tlsConfig() *tls.Config {
+	base := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{"h2", "http/1.1"},
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return r.cert.Load(), nil
+		},
+	}
+
+	if r.config.ClientCAFile == "" {
+		return base
+	}
+
+	clientAuth := tls.RequireAndVerifyClientCert
+	if r.config.ClientAuth == OptionalClientCert {
+		clientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			config := base.Clone()
+			config.ClientAuth = clientAuth
+			config.ClientCAs = r.clientCAs.Load()
+			return config, nil
+		},
+	}
+}
+
+// ClientCertificate returns the certificate the client authenticated
+// with, if it presented a certificate verified against the client CA
+// bundle.
+func ClientCertificate(r *http.Request) (*x509.Certificate, bool) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil, false
+	}
+
+	return r.TLS.VerifiedChains[0][0], true
+}
+
+// ClientSubject returns the subject of the certificate the client
+// authenticated with, e.g. `CN=grader,O=Example`.
+func ClientSubject(r *http.Request) (string, bool) {
+	cert, ok := ClientCertificate(r)
+	if !ok {
+		return "", false
+	}
+
+	return cert.Subject.String(), true
+}
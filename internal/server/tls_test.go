@@ -0,0 +1,255 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// testCA issues certificates for tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &testCA{
+		cert: cert,
+		key:  key,
+		pem:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}
+}
+
+// issue returns a PEM encoded certificate and key for the common name.
+func (ca *testCA) issue(t *testing.T, serial int64, commonName string) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+}
+
+// writeFile writes the file, and moves its modification time forward,
+// so the change is detected regardless of the file system resolution.
+func writeFile(t *testing.T, path string, data []byte, modTime time.Time) {
+	require.NoError(t, os.WriteFile(path, data, 0600))
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+func writeTLSFiles(t *testing.T, ca *testCA, serial int64, modTime time.Time) TLSConfig {
+	dir := t.TempDir()
+
+	cert, key := ca.issue(t, serial, "server")
+
+	config := TLSConfig{
+		CertFile:     filepath.Join(dir, "cert.pem"),
+		KeyFile:      filepath.Join(dir, "key.pem"),
+		ClientCAFile: filepath.Join(dir, "ca.pem"),
+	}
+
+	writeFile(t, config.CertFile, cert, modTime)
+	writeFile(t, config.KeyFile, key, modTime)
+	writeFile(t, config.ClientCAFile, ca.pem, modTime)
+
+	return config
+}
+
+func servedSerial(t *testing.T, r *tlsReloader) int64 {
+	leaf, err := x509.ParseCertificate(r.cert.Load().Certificate[0])
+	require.NoError(t, err)
+
+	return leaf.SerialNumber.Int64()
+}
+
+func TestTLSReloader_ReloadsChangedFiles(t *testing.T) {
+	ca := newTestCA(t)
+	config := writeTLSFiles(t, ca, 2, time.Now().Add(-time.Minute))
+
+	r, err := newTLSReloader(config, zap.NewNop())
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), servedSerial(t, r))
+
+	reloaded, err := r.reload()
+	require.NoError(t, err)
+	assert.False(t, reloaded)
+
+	cert, key := ca.issue(t, 3, "server")
+	writeFile(t, config.CertFile, cert, time.Now())
+	writeFile(t, config.KeyFile, key, time.Now())
+
+	reloaded, err = r.reload()
+	require.NoError(t, err)
+	assert.True(t, reloaded)
+	assert.Equal(t, int64(3), servedSerial(t, r))
+}
+
+func TestTLSReloader_KeepsPreviousOnInvalidFiles(t *testing.T) {
+	ca := newTestCA(t)
+	config := writeTLSFiles(t, ca, 2, time.Now().Add(-time.Minute))
+
+	r, err := newTLSReloader(config, zap.NewNop())
+	require.NoError(t, err)
+
+	// e.g. the certificate was written before the key
+	cert, _ := ca.issue(t, 3, "server")
+	writeFile(t, config.CertFile, cert, time.Now())
+
+	_, err = r.reload()
+	assert.ErrorContains(t, err, "failed to load certificate")
+	assert.Equal(t, int64(2), servedSerial(t, r))
+}
+
+func TestTLSReloader_InvalidConfig(t *testing.T) {
+	_, err := newTLSReloader(TLSConfig{CertFile: "cert.pem"}, zap.NewNop())
+	assert.ErrorContains(t, err, "both a certificate and a key are required")
+
+	ca := newTestCA(t)
+	config := writeTLSFiles(t, ca, 2, time.Now())
+	config.ClientAuth = "sometimes"
+
+	_, err = newTLSReloader(config, zap.NewNop())
+	assert.ErrorContains(t, err, "invalid client auth 'sometimes'")
+}
+
+// startTLSServer serves the client subject, or `anonymous`.
+func startTLSServer(t *testing.T, config TLSConfig) *httptest.Server {
+	r, err := newTLSReloader(config, zap.NewNop())
+	require.NoError(t, err)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		subject, ok := ClientSubject(req)
+		if !ok {
+			subject = "anonymous"
+		}
+
+		io.WriteString(w, subject)
+	}))
+
+	server.TLS = r.tlsConfig()
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func newTLSClient(ca *testCA, certs ...tls.Certificate) *http.Client {
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	return &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certs},
+	}}
+}
+
+func get(client *http.Client, url string) (string, error) {
+	res, err := client.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	return string(body), err
+}
+
+func TestTLS_ClientCertificates(t *testing.T) {
+	ca := newTestCA(t)
+
+	clientPEM, clientKey := ca.issue(t, 10, "grader")
+	clientCert, err := tls.X509KeyPair(clientPEM, clientKey)
+	require.NoError(t, err)
+
+	t.Run("require", func(t *testing.T) {
+		server := startTLSServer(t, writeTLSFiles(t, ca, 2, time.Now()))
+
+		subject, err := get(newTLSClient(ca, clientCert), server.URL)
+		require.NoError(t, err)
+		assert.Equal(t, "CN=grader", subject)
+
+		_, err = get(newTLSClient(ca), server.URL)
+		assert.Error(t, err)
+	})
+
+	t.Run("optional", func(t *testing.T) {
+		config := writeTLSFiles(t, ca, 2, time.Now())
+		config.ClientAuth = OptionalClientCert
+
+		server := startTLSServer(t, config)
+
+		subject, err := get(newTLSClient(ca, clientCert), server.URL)
+		require.NoError(t, err)
+		assert.Equal(t, "CN=grader", subject)
+
+		subject, err = get(newTLSClient(ca), server.URL)
+		require.NoError(t, err)
+		assert.Equal(t, "anonymous", subject)
+	})
+
+	t.Run("untrusted", func(t *testing.T) {
+		other := newTestCA(t)
+		otherPEM, otherKey := other.issue(t, 11, "intruder")
+		otherCert, err := tls.X509KeyPair(otherPEM, otherKey)
+		require.NoError(t, err)
+
+		config := writeTLSFiles(t, ca, 2, time.Now())
+		config.ClientAuth = OptionalClientCert
+
+		server := startTLSServer(t, config)
+
+		_, err = get(newTLSClient(ca, otherCert), server.URL)
+		assert.Error(t, err)
+	})
+}
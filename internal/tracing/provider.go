@@ -0,0 +1,142 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// serviceName is the default name of the service reporting the spans.
+// It may be overridden using the `OTEL_SERVICE_NAME` env variable.
+const serviceName = "shimmy"
+
+// Exporter is the destination spans are exported to.
+type Exporter string
+
+const (
+	// NoExporter disables exporting spans.
+	NoExporter Exporter = "none"
+
+	// StdoutExporter writes spans to stdout, one JSON object per span.
+	StdoutExporter Exporter = "stdout"
+
+	// OTLPExporter sends spans to an OTLP collector, using HTTP.
+	OTLPExporter Exporter = "otlp"
+)
+
+type Config struct {
+	// Exporter is the destination spans are exported to. Default is
+	// none, which disables tracing. The trace context sent by clients
+	// is passed to the worker regardless.
+	Exporter Exporter `conf:"exporter"`
+
+	// Endpoint is the URL of the OTLP collector, e.g.
+	// `http://localhost:4318`. Default is read from the standard
+	// `OTEL_EXPORTER_OTLP_*` env variables.
+	Endpoint string `conf:"endpoint"`
+
+	// SampleRatio is the fraction of traces started by the shim that
+	// are recorded, between 0 and 1. Traces continued from a client
+	// follow the sampling decision of the client.
+	SampleRatio float64 `conf:"sample_ratio"`
+}
+
+// Enabled returns true if spans are exported.
+func (c Config) Enabled() bool {
+	return c.Exporter != "" && c.Exporter != NoExporter
+}
+
+// NewTracerProvider creates a tracer provider exporting spans to the
+// configured exporter. It returns nil if tracing is disabled.
+func NewTracerProvider(ctx context.Context, config Config) (*sdktrace.TracerProvider, error) {
+	if !config.Enabled() {
+		return nil, nil
+	}
+
+	exporter, err := newExporter(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attribute.String("service.name", serviceName)),
+		resource.WithTelemetrySDK(),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tracing resource: %w", err)
+	}
+
+	sampleRatio := min(max(config.SampleRatio, 0), 1)
+
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+	), nil
+}
+
+func newExporter(ctx context.Context, config Config) (sdktrace.SpanExporter, error) {
+	switch config.Exporter {
+	case StdoutExporter:
+		return stdouttrace.New()
+	case OTLPExporter:
+		var opts []otlptracehttp.Option
+		if config.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpointURL(config.Endpoint))
+		}
+
+		return otlptracehttp.New(ctx, opts...)
+	default:
+		return nil, fmt.Errorf("unsupported trace exporter: %s", config.Exporter)
+	}
+}
+
+// Module provides a tracing module, registering the tracer provider
+// globally. Pending spans are flushed when the application stops.
+func Module(config Config) fx.Option {
+	return fx.Module(
+		"tracing",
+
+		// provide tracing config
+		fx.Supply(config),
+
+		// register the tracer provider
+		fx.Invoke(registerTracerProvider),
+	)
+}
+
+func registerTracerProvider(lc fx.Lifecycle, config Config, log *zap.Logger) error {
+	provider, err := NewTracerProvider(context.Background(), config)
+	if err != nil {
+		return err
+	}
+
+	if provider == nil {
+		return nil
+	}
+
+	log = log.Named("tracing")
+
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagator)
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		log.Warn("tracing error", zap.Error(err))
+	}))
+
+	log.Info("exporting traces", zap.String("exporter", string(config.Exporter)))
+
+	lc.Append(fx.Hook{
+		OnStop: provider.Shutdown,
+	})
+
+	return nil
+}
@@ -0,0 +1,79 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName is the name of the tracer creating the spans
+// of the application.
+const instrumentationName = "github.com/lambda-feedback/shimmy"
+
+const (
+	// TraceparentEnv is the environment variable holding the W3C
+	// traceparent of the span a worker process is started in.
+	TraceparentEnv = "TRACEPARENT"
+
+	// TracestateEnv is the environment variable holding the W3C
+	// tracestate of the span a worker process is started in.
+	TracestateEnv = "TRACESTATE"
+)
+
+// propagator propagates the trace context in the W3C format. It is used
+// regardless of the configured exporter, so traces of clients are
+// continued by the worker even if the shim does not export spans.
+var propagator = propagation.TraceContext{}
+
+// Start starts a span using the tracer provider registered globally.
+// If tracing is disabled, the span is not recorded, but carries the
+// trace context of ctx.
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, opts...)
+}
+
+// End ends the span, recording err if it is not nil.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
+
+// Extract returns a context carrying the trace context sent by a client
+// in the `traceparent` and `tracestate` headers, if any.
+func Extract(ctx context.Context, header http.Header) context.Context {
+	return propagator.Extract(ctx, propagation.HeaderCarrier(header))
+}
+
+// Metadata returns the W3C trace context of ctx, by field name, e.g.
+// `traceparent`. It is empty if ctx does not carry a valid span context.
+func Metadata(ctx context.Context) map[string]string {
+	carrier := propagation.MapCarrier{}
+	propagator.Inject(ctx, carrier)
+
+	return carrier
+}
+
+// Environ returns the environment variables passing the W3C trace
+// context of ctx to a process, e.g. `TRACEPARENT=00-...`.
+func Environ(ctx context.Context) []string {
+	metadata := Metadata(ctx)
+
+	env := make([]string, 0, len(metadata))
+	if traceparent, ok := metadata["traceparent"]; ok {
+		env = append(env, TraceparentEnv+"="+traceparent)
+	}
+
+	if tracestate, ok := metadata["tracestate"]; ok {
+		env = append(env, TracestateEnv+"="+tracestate)
+	}
+
+	return env
+}
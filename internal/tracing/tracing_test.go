@@ -0,0 +1,73 @@
+package tracing_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/lambda-feedback/shimmy/internal/tracing"
+)
+
+const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestExtract_ContinuesClientTrace(t *testing.T) {
+	header := http.Header{}
+	header.Set("traceparent", traceparent)
+	header.Set("tracestate", "vendor=value")
+
+	ctx := tracing.Extract(context.Background(), header)
+
+	sc := trace.SpanContextFromContext(ctx)
+	require.True(t, sc.IsValid())
+	assert.True(t, sc.IsRemote())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID().String())
+
+	assert.Equal(t, []string{
+		"TRACEPARENT=" + traceparent,
+		"TRACESTATE=vendor=value",
+	}, tracing.Environ(ctx))
+}
+
+func TestStart_PropagatesWithoutProvider(t *testing.T) {
+	header := http.Header{}
+	header.Set("traceparent", traceparent)
+
+	ctx, span := tracing.Start(tracing.Extract(context.Background(), header), "test")
+	defer span.End()
+
+	// spans are not recorded, but carry the trace of the client
+	assert.Equal(t, traceparent, tracing.Metadata(ctx)["traceparent"])
+}
+
+func TestMetadata_EmptyWithoutTrace(t *testing.T) {
+	assert.Empty(t, tracing.Metadata(context.Background()))
+	assert.Empty(t, tracing.Environ(context.Background()))
+}
+
+func TestNewTracerProvider_Disabled(t *testing.T) {
+	for _, exporter := range []tracing.Exporter{"", tracing.NoExporter} {
+		provider, err := tracing.NewTracerProvider(context.Background(), tracing.Config{Exporter: exporter})
+		require.NoError(t, err)
+		assert.Nil(t, provider)
+	}
+}
+
+func TestNewTracerProvider_Stdout(t *testing.T) {
+	provider, err := tracing.NewTracerProvider(context.Background(), tracing.Config{
+		Exporter:    tracing.StdoutExporter,
+		SampleRatio: 1,
+	})
+	require.NoError(t, err)
+	require.NotNil(t, provider)
+
+	assert.NoError(t, provider.Shutdown(context.Background()))
+}
+
+func TestNewTracerProvider_UnsupportedExporter(t *testing.T) {
+	_, err := tracing.NewTracerProvider(context.Background(), tracing.Config{Exporter: "zipkin"})
+	assert.ErrorContains(t, err, "unsupported trace exporter: zipkin")
+}
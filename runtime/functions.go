@@ -0,0 +1,183 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+
+	"github.com/lambda-feedback/shimmy/internal/metrics"
+)
+
+// Function is a named evaluation function, hosted alongside other
+// functions. Each function has its own runtime and workers.
+type Function struct {
+	// Name is the name of the function, used to route requests.
+	Name string
+
+	// Config is the runtime config of the function.
+	Config Config
+
+	// Runtime is the runtime of the function.
+	Runtime Runtime
+
+	// Handler handles the requests of the function.
+	Handler Handler
+}
+
+// FunctionConfigs are the runtime configs of the hosted functions, by name.
+type FunctionConfigs map[string]Config
+
+// Functions are the hosted evaluation functions, by name.
+type Functions map[string]*Function
+
+// FunctionsParams defines the dependencies for the functions.
+type FunctionsParams struct {
+	fx.In
+
+	// Context is the context to use for the underlying runtimes
+	Context context.Context
+
+	// Configs are the configs of the functions, by name
+	Configs FunctionConfigs
+
+	// Metrics records the metrics of the functions, if set
+	Metrics *metrics.Metrics `optional:"true"`
+
+	// Log is the logger to use for the runtimes
+	Log *zap.Logger
+}
+
+// NewFunctions creates a runtime and handler for each function.
+func NewFunctions(params FunctionsParams) (Functions, error) {
+	functions := make(Functions, len(params.Configs))
+
+	for name, config := range params.Configs {
+		log := params.Log.With(zap.String("function", name))
+
+		rt, err := NewRuntime(RuntimeParams{
+			Context: params.Context,
+			Config:  config,
+			Log:     log,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error creating runtime for function '%s': %w", name, err)
+		}
+
+		handler, err := NewRuntimeHandler(HandlerParams{
+			Runtime:  rt,
+			Metrics:  params.Metrics,
+			Function: name,
+			Log:      log,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error creating handler for function '%s': %w", name, err)
+		}
+
+		functions[name] = &Function{
+			Name:    name,
+			Config:  config,
+			Runtime: rt,
+			Handler: handler,
+		}
+	}
+
+	return functions, nil
+}
+
+func NewLifecycleFunctions(params FunctionsParams, lc fx.Lifecycle) (Functions, error) {
+	functions, err := NewFunctions(params)
+	if err != nil {
+		return nil, err
+	}
+
+	log := params.Log.Named("functions")
+
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			functions.Start(ctx, log)
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			return functions.Shutdown(ctx)
+		},
+	})
+
+	return functions, nil
+}
+
+// Names returns the sorted names of the functions.
+func (f Functions) Names() []string {
+	return slices.Sorted(maps.Keys(f))
+}
+
+// Start starts all functions. A function failing to start does not
+// prevent the other functions from starting, so the error is logged,
+// and the function reports not to be ready.
+func (f Functions) Start(ctx context.Context, log *zap.Logger) {
+	for _, name := range f.Names() {
+		if err := f[name].Runtime.Start(ctx); err != nil {
+			log.Error("failed to start function",
+				zap.String("function", name),
+				zap.Error(err),
+			)
+		}
+	}
+}
+
+// Ready returns true if any function is ready, so a single broken
+// function does not affect the readiness of the others.
+func (f Functions) Ready() bool {
+	for _, fn := range f {
+		if fn.Runtime.Ready() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Drain drains all functions concurrently.
+func (f Functions) Drain(ctx context.Context) error {
+	return f.each(func(rt Runtime) error {
+		return rt.Drain(ctx)
+	})
+}
+
+// Shutdown shuts down all functions concurrently.
+func (f Functions) Shutdown(ctx context.Context) error {
+	return f.each(func(rt Runtime) error {
+		return rt.Shutdown(ctx)
+	})
+}
+
+// each calls fn for the runtime of each function concurrently, and
+// returns the joined errors.
+func (f Functions) each(fn func(Runtime) error) error {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+
+	var errs []error
+
+	for name, function := range f {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if err := fn(function.Runtime); err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("function '%s': %w", name, err))
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
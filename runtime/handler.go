@@ -1,6 +1,7 @@
 package runtime
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
@@ -9,9 +10,13 @@ import (
 	"net/http"
 	"strings"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/fx"
 	"go.uber.org/zap"
 
+	"github.com/lambda-feedback/shimmy/internal/metrics"
+	"github.com/lambda-feedback/shimmy/internal/tracing"
 	"github.com/lambda-feedback/shimmy/runtime/schema"
 )
 
@@ -21,6 +26,7 @@ var (
 	errCommandNotFound  = errors.New("command not found")
 	errInvalidCommand   = errors.New("invalid command")
 	errValidationFailed = errors.New("validation failed")
+	errNotSupported     = errors.New("command not supported by function")
 )
 
 var wellKnownErrors = map[error]int{
@@ -29,6 +35,7 @@ var wellKnownErrors = map[error]int{
 	errCommandNotFound:  http.StatusNotFound,
 	errInvalidCommand:   http.StatusBadRequest,
 	errValidationFailed: http.StatusBadRequest,
+	errNotSupported:     http.StatusNotImplemented,
 }
 
 // HandlerParams defines the dependencies for the runtime handler.
@@ -37,6 +44,12 @@ type HandlerParams struct {
 
 	Runtime Runtime
 
+	// Metrics records validation failures and case evaluations, if set
+	Metrics *metrics.Metrics `optional:"true"`
+
+	// Function is the name of the function, if hosting multiple functions
+	Function string `optional:"true"`
+
 	Log *zap.Logger
 }
 
@@ -62,6 +75,16 @@ type RuntimeHandler struct {
 
 	schemas map[validationType]*schema.Schema
 
+	// params caches the compiled params schema of the function
+	params paramsSchema
+
+	metrics  *metrics.Metrics
+	function string
+
+	// shadow sends a sample of the requests to the shadow runtime, if set
+	shadow        *ShadowRuntime
+	shadowHandler *RuntimeHandler
+
 	log *zap.Logger
 }
 
@@ -82,11 +105,27 @@ func NewRuntimeHandler(params HandlerParams) (Handler, error) {
 		validationTypeResponse: responseSchema,
 	}
 
-	return &RuntimeHandler{
-		runtime: params.Runtime,
-		schemas: schemas,
-		log:     params.Log.Named("runtime_handler"),
-	}, nil
+	h := &RuntimeHandler{
+		runtime:  params.Runtime,
+		schemas:  schemas,
+		metrics:  params.Metrics,
+		function: params.Function,
+		log:      params.Log.Named("runtime_handler"),
+	}
+
+	// shadow requests are handled the same way as client requests, but
+	// neither validation failures nor cases are recorded in the metrics
+	if shadow, ok := params.Runtime.(*ShadowRuntime); ok {
+		h.shadow = shadow
+		h.shadowHandler = &RuntimeHandler{
+			runtime:  shadow.shadow,
+			schemas:  schemas,
+			function: params.Function,
+			log:      params.Log.Named("shadow_handler"),
+		}
+	}
+
+	return h, nil
 }
 
 // Handle handles a runtime request.
@@ -125,6 +164,15 @@ func (h *RuntimeHandler) handle(ctx context.Context, req Request) ([]byte, error
 		return nil, errInvalidCommand
 	}
 
+	// Reject commands the evaluation function does not support. Health
+	// checks are always forwarded, so functions that only declare their
+	// evaluation commands remain healthy.
+	caps := h.runtime.Capabilities()
+	if command != CommandHealth && caps != nil && !caps.SupportsCommand(string(command)) {
+		log.Debug("command not supported by function")
+		return nil, errNotSupported
+	}
+
 	resData, err := SendCommand(req, command, h, ctx)
 	if err != nil {
 		log.Debug("unable to send command")
@@ -156,6 +204,12 @@ func (h *RuntimeHandler) handle(ctx context.Context, req Request) ([]byte, error
 		return nil, err
 	}
 
+	if h.shadow != nil {
+		h.shadow.mirror(ctx, command, resData, func(ctx context.Context) ([]byte, error) {
+			return h.shadowHandler.handle(ctx, req)
+		})
+	}
+
 	// Return the response data
 	return resData, nil
 }
@@ -193,17 +247,32 @@ func ProcessEval(reqBody map[string]any, result map[string]any, req Request, com
 	}
 }
 
-func SendCommand(req Request, command Command, h *RuntimeHandler, ctx context.Context) ([]byte, error) {
+func SendCommand(req Request, command Command, h *RuntimeHandler, ctx context.Context) (_ []byte, err error) {
+	ctx, span := tracing.Start(ctx, "shimmy.command",
+		trace.WithAttributes(attribute.String("shimmy.command", string(command))),
+	)
+	defer func() { tracing.End(span, err) }()
+
 	var reqData map[string]any
 
-	// Parse the request data into a map
-	if err := json.Unmarshal(req.Body, &reqData); err != nil {
+	// Parse the request data into a map. Numbers are kept as json.Number,
+	// so integers and floats are passed to the function as they were sent.
+	dec := json.NewDecoder(bytes.NewReader(req.Body))
+	dec.UseNumber()
+	if err := dec.Decode(&reqData); err != nil {
 		log.Debug("failed to unmarshal request data", zap.Error(err))
 		return nil, err
 	}
 
-	// Validate the request data against the request schema
-	if err := h.validate(validationTypeRequest, command, reqData); err != nil {
+	// Validate the request data against the request schema, and the
+	// request params against the function's params schema
+	if err := traceValidation(ctx, validationTypeRequest, func() error {
+		if err := h.validate(validationTypeRequest, command, reqData); err != nil {
+			return err
+		}
+
+		return h.validateParams(command, reqData)
+	}); err != nil {
 		return nil, err
 	}
 
@@ -218,7 +287,9 @@ func SendCommand(req Request, command Command, h *RuntimeHandler, ctx context.Co
 	}
 
 	// Validate the response data against the response schema
-	if err = h.validate(validationTypeResponse, command, responseMsg); err != nil {
+	if err = traceValidation(ctx, validationTypeResponse, func() error {
+		return h.validate(validationTypeResponse, command, responseMsg)
+	}); err != nil {
 		log.Error("failed to validate response data", zap.Error(err))
 		return nil, err
 	}
@@ -274,7 +345,23 @@ func FindFirstMatchingCase(params map[string]any, cases []interface{}, req Reque
 	var feedback []string
 	var warnings []CaseWarning
 
+	ctx, span := tracing.Start(ctx, "shimmy.cases",
+		trace.WithAttributes(attribute.Int("shimmy.cases.total", len(cases))),
+	)
+
+	evaluated := 0
+	defer func() {
+		h.metrics.ObserveCaseEvaluations(h.function, string(command), evaluated)
+
+		span.SetAttributes(
+			attribute.Int("shimmy.cases.evaluated", evaluated),
+			attribute.Int("shimmy.cases.matched", len(matches)),
+		)
+		span.End()
+	}()
+
 	for index, c := range cases {
+		evaluated++
 		result := EvaluateCase(params, c.(map[string]interface{}), index, req, command, h, ctx)
 
 		if result.Warning != nil {
@@ -293,6 +380,11 @@ func FindFirstMatchingCase(params map[string]any, cases []interface{}, req Reque
 
 func EvaluateCase(params map[string]any, caseData map[string]any, index int, req Request, command Command,
 	h *RuntimeHandler, ctx context.Context) CaseResult {
+	ctx, span := tracing.Start(ctx, "shimmy.case",
+		trace.WithAttributes(attribute.Int("shimmy.case.index", index)),
+	)
+	defer span.End()
+
 	// Check for required fields
 	if _, hasAnswer := caseData["answer"]; !hasAnswer {
 		return CaseResult{
@@ -1,6 +1,9 @@
 package runtime
 
-import "net/http"
+import (
+	"cmp"
+	"net/http"
+)
 
 // Request represents an incoming request.
 type Request struct {
@@ -16,3 +19,11 @@ type Response struct {
 	Body       []byte
 	Header     http.Header
 }
+
+// RequestCommand returns the command of an HTTP request: the `command`
+// header, the command in the path of function routes, or `eval`. Every
+// handler of the request reads the command using it, so they agree on
+// the command that is run.
+func RequestCommand(r *http.Request) string {
+	return cmp.Or(r.Header.Get("command"), r.PathValue("command"), string(CommandEvaluate))
+}
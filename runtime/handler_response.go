@@ -2,7 +2,11 @@ package runtime
 
 import (
 	"encoding/json"
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 // getErrorStatusCode returns the status code for the given error.
@@ -15,12 +19,19 @@ func getErrorStatusCode(err error) int {
 		return http.StatusUnprocessableEntity
 	}
 
+	if errors.Is(err, ErrOverloaded) ||
+		errors.Is(err, ErrDraining) ||
+		errors.Is(err, ErrCircuitOpen) {
+		return http.StatusServiceUnavailable
+	}
+
 	return http.StatusInternalServerError
 }
 
 // newErrorResponse creates a new error response.
 func newErrorResponse(err error) Response {
 	statusCode := getErrorStatusCode(err)
+	retryAfter, retry := getRetryAfter(err)
 
 	type responseError struct {
 		Message string              `json:"message"`
@@ -48,7 +59,34 @@ func newErrorResponse(err error) Response {
 		return Response{StatusCode: http.StatusInternalServerError}
 	}
 
-	return newResponse(statusCode, body)
+	res := newResponse(statusCode, body)
+
+	if retry {
+		res.Header.Set("Retry-After", retryAfter)
+	}
+
+	return res
+}
+
+// getRetryAfter returns the value of the Retry-After header in whole
+// seconds, if the request was rejected as the runtime is overloaded,
+// or the circuit breaker is open.
+func getRetryAfter(err error) (string, bool) {
+	var retryAfter time.Duration
+
+	var overloaded *OverloadedError
+	var circuitOpen *CircuitOpenError
+
+	switch {
+	case errors.As(err, &overloaded):
+		retryAfter = overloaded.RetryAfter
+	case errors.As(err, &circuitOpen):
+		retryAfter = circuitOpen.RetryAfter
+	default:
+		return "", false
+	}
+
+	return strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))), true
 }
 
 // newResponse creates a new response.
@@ -7,15 +7,21 @@ import (
 	"github.com/lambda-feedback/shimmy/runtime"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zaptest"
 	"net/http"
 	"testing"
+	"time"
 )
 
 // mockRuntime implements the runtime.Runtime interface.
 type mockRuntime struct {
 	mock.Mock
+
+	capabilities *runtime.Capabilities
 }
 
 func (m *mockRuntime) Handle(ctx context.Context, request runtime.EvaluationRequest) (runtime.EvaluationResponse, error) {
@@ -36,11 +42,32 @@ func (m *mockRuntime) Start(ctx context.Context) error {
 	panic("Not required")
 }
 
+func (m *mockRuntime) Drain(ctx context.Context) error {
+	//Not required for tests
+	panic("Not required")
+}
+
 func (m *mockRuntime) Shutdown(ctx context.Context) error {
 	//Not required for tests
 	panic("Not required")
 }
 
+func (m *mockRuntime) QueueDepth() int {
+	return 0
+}
+
+func (m *mockRuntime) Stats() runtime.Stats {
+	return runtime.Stats{}
+}
+
+func (m *mockRuntime) Ready() bool {
+	return true
+}
+
+func (m *mockRuntime) Capabilities() *runtime.Capabilities {
+	return m.capabilities
+}
+
 func setupLogger(t *testing.T) *zap.Logger {
 	return zaptest.NewLogger(t)
 }
@@ -544,3 +571,181 @@ func TestRunTimeHandler_Invalid_Preview_Incorrect_Args(t *testing.T) {
 	require.Equal(t, "request validation error", responseErrors["message"])
 
 }
+
+func TestRuntimeHandler_Handle_UnsupportedCommand(t *testing.T) {
+	handler, err := runtime.NewRuntimeHandler(runtime.HandlerParams{
+		Runtime: &mockRuntime{
+			capabilities: &runtime.Capabilities{Commands: []string{"eval"}},
+		},
+		Log: setupLogger(t),
+	})
+	require.NoError(t, err)
+
+	body := createRequestBody(t, map[string]any{
+		"response": 1,
+	})
+
+	req := createRequest(http.MethodPost, "/preview", body, http.Header{
+		"Command": []string{"preview"},
+	})
+
+	resp := handler.Handle(context.Background(), req)
+
+	require.Equal(t, http.StatusNotImplemented, resp.StatusCode)
+}
+
+func TestRuntimeHandler_Handle_HealthcheckAlwaysSupported(t *testing.T) {
+	mockRT := &mockRuntime{
+		capabilities: &runtime.Capabilities{Commands: []string{"eval", "preview"}},
+	}
+	mockRT.On("Handle", mock.Anything, mock.Anything).Return(runtime.EvaluationResponse{
+		"command": "healthcheck",
+		"result": map[string]any{
+			"tests_passed": true,
+			"successes":    []any{},
+			"failures":     []any{},
+			"errors":       []any{},
+		},
+	}, nil)
+
+	handler, err := runtime.NewRuntimeHandler(runtime.HandlerParams{
+		Runtime: mockRT,
+		Log:     setupLogger(t),
+	})
+	require.NoError(t, err)
+
+	req := createRequest(http.MethodPost, "/", createRequestBody(t, map[string]any{}), http.Header{
+		"Command": []string{"healthcheck"},
+	})
+
+	resp := handler.Handle(context.Background(), req)
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	mockRT.AssertCalled(t, "Handle", mock.Anything, mock.Anything)
+}
+
+func TestRuntimeHandler_Handle_ParamsSchema(t *testing.T) {
+	mockRT := &mockRuntime{
+		capabilities: &runtime.Capabilities{
+			Commands:     []string{"eval"},
+			ParamsSchema: json.RawMessage(`{"type":"object","required":["strict"]}`),
+		},
+	}
+	mockRT.On("Handle", mock.Anything, mock.Anything).Return(runtime.EvaluationResponse{
+		"command": "eval",
+		"result":  map[string]any{"is_correct": true},
+	}, nil)
+
+	handler, err := runtime.NewRuntimeHandler(runtime.HandlerParams{
+		Runtime: mockRT,
+		Log:     setupLogger(t),
+	})
+	require.NoError(t, err)
+
+	invalid := createRequestBody(t, map[string]any{
+		"response": 1,
+		"answer":   1,
+		"params":   map[string]any{},
+	})
+
+	resp := handler.Handle(context.Background(), createRequest(http.MethodPost, "/eval", invalid, http.Header{}))
+	require.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	mockRT.AssertNotCalled(t, "Handle", mock.Anything, mock.Anything)
+
+	valid := createRequestBody(t, map[string]any{
+		"response": 1,
+		"answer":   1,
+		"params":   map[string]any{"strict": true},
+	})
+
+	resp = handler.Handle(context.Background(), createRequest(http.MethodPost, "/eval", valid, http.Header{}))
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestRuntimeHandler_Handle_Overloaded(t *testing.T) {
+	mockRT := new(mockRuntime)
+	mockRT.On("Handle", mock.Anything, mock.Anything).Return(runtime.EvaluationResponse(nil), &runtime.OverloadedError{
+		Reason:     "queue full",
+		RetryAfter: 1500 * time.Millisecond,
+	})
+
+	handler, err := runtime.NewRuntimeHandler(runtime.HandlerParams{
+		Runtime: mockRT,
+		Log:     setupLogger(t),
+	})
+	require.NoError(t, err)
+
+	body := createRequestBody(t, map[string]any{
+		"response": 1,
+		"answer":   1,
+	})
+
+	resp := handler.Handle(context.Background(), createRequest(http.MethodPost, "/eval", body, http.Header{}))
+	require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	require.Equal(t, "2", resp.Header.Get("Retry-After"))
+}
+
+func TestRuntimeHandler_Handle_CircuitOpen(t *testing.T) {
+	mockRT := new(mockRuntime)
+	mockRT.On("Handle", mock.Anything, mock.Anything).Return(runtime.EvaluationResponse(nil), &runtime.CircuitOpenError{
+		Reason:     "failed to start worker",
+		RetryAfter: 30 * time.Second,
+	})
+
+	handler, err := runtime.NewRuntimeHandler(runtime.HandlerParams{
+		Runtime: mockRT,
+		Log:     setupLogger(t),
+	})
+	require.NoError(t, err)
+
+	body := createRequestBody(t, map[string]any{
+		"response": 1,
+		"answer":   1,
+	})
+
+	resp := handler.Handle(context.Background(), createRequest(http.MethodPost, "/eval", body, http.Header{}))
+	require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	require.Equal(t, "30", resp.Header.Get("Retry-After"))
+	require.Contains(t, string(resp.Body), "failed to start worker")
+}
+
+func TestRuntimeHandler_Handle_TracesCaseFanOut(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	handler := setupHandlerWithMockFunc(t, mockEvalFunc)
+
+	body := createRequestBody(t, map[string]any{
+		"response": "yes",
+		"answer":   "world",
+		"params": map[string]any{
+			"cases": []map[string]any{
+				{"answer": "hello", "feedback": "should be 'hello'."},
+				{"answer": "yes", "feedback": "should be 'yes'."},
+			},
+		},
+	})
+
+	req := createRequest(http.MethodPost, "/eval", body, http.Header{
+		"command": []string{"eval"},
+	})
+
+	ctx, span := otel.Tracer("test").Start(context.Background(), "test")
+	handler.Handle(ctx, req)
+	span.End()
+
+	names := make(map[string]int)
+	for _, s := range recorder.Ended() {
+		names[s.Name()]++
+		require.Equal(t, span.SpanContext().TraceID(), s.SpanContext().TraceID())
+	}
+
+	// the request itself, and one command per case
+	require.Equal(t, 3, names["shimmy.command"])
+	require.Equal(t, 6, names["shimmy.validate"])
+	require.Equal(t, 1, names["shimmy.cases"])
+	require.Equal(t, 2, names["shimmy.case"])
+}
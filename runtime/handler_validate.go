@@ -1,11 +1,16 @@
 package runtime
 
 import (
+	"context"
 	"fmt"
+	"sync"
 
 	"github.com/xeipuuv/gojsonschema"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 
+	"github.com/lambda-feedback/shimmy/internal/tracing"
 	"github.com/lambda-feedback/shimmy/runtime/schema"
 )
 
@@ -50,6 +55,18 @@ func (e *validationError) Error() string {
 	return fmt.Sprintf("%s validation error", e.Type)
 }
 
+// traceValidation runs the validation fn in a span.
+func traceValidation(ctx context.Context, t validationType, fn func() error) error {
+	_, span := tracing.Start(ctx, "shimmy.validate",
+		trace.WithAttributes(attribute.Stringer("shimmy.validation", t)),
+	)
+
+	err := fn()
+	tracing.End(span, err)
+
+	return err
+}
+
 // validate validates the data against the schema for the given command.
 func (r *RuntimeHandler) validate(t validationType, command Command, data map[string]any) error {
 	log := r.log.With(
@@ -84,9 +101,90 @@ func (r *RuntimeHandler) validate(t validationType, command Command, data map[st
 		return nil
 	}
 
+	r.metrics.ObserveValidationFailure(r.function, string(command), t.String())
+
 	return newValidationError(t, res)
 }
 
+// paramsSchema is the compiled params schema reported by the function.
+type paramsSchema struct {
+	mu sync.Mutex
+
+	// source are the capabilities the schema was compiled from
+	source *Capabilities
+
+	// schema is the compiled schema, or nil if there is none
+	schema *gojsonschema.Schema
+}
+
+// get returns the compiled params schema for the given capabilities,
+// compiling it if the capabilities changed since the last call.
+func (p *paramsSchema) get(caps *Capabilities) (*gojsonschema.Schema, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if caps == p.source {
+		return p.schema, nil
+	}
+
+	var compiled *gojsonschema.Schema
+	if caps != nil && len(caps.ParamsSchema) > 0 {
+		var err error
+		compiled, err = gojsonschema.NewSchema(gojsonschema.NewBytesLoader(caps.ParamsSchema))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	p.source = caps
+	p.schema = compiled
+
+	return compiled, nil
+}
+
+// validateParams validates the request params against the params schema
+// reported by the evaluation function. If the function did not report a
+// schema, the params are not validated.
+func (r *RuntimeHandler) validateParams(command Command, data map[string]any) error {
+	if command == CommandHealth {
+		// Health does not have params, no need to validate
+		return nil
+	}
+
+	log := r.log.With(zap.String("command", string(command)))
+
+	schema, err := r.params.get(r.runtime.Capabilities())
+	if err != nil {
+		// an invalid schema is the function's fault, so we skip
+		// validation rather than rejecting every request.
+		log.Warn("invalid params schema", zap.Error(err))
+		return nil
+	}
+
+	if schema == nil {
+		return nil
+	}
+
+	params, ok := data["params"].(map[string]any)
+	if !ok {
+		params = map[string]any{}
+	}
+
+	res, err := schema.Validate(gojsonschema.NewGoLoader(params))
+	if err != nil {
+		log.Error("params validation failed", zap.Error(err))
+		return errValidationFailed
+	}
+
+	if res.Valid() {
+		return nil
+	}
+
+	r.metrics.ObserveValidationFailure(r.function, string(command), "params")
+
+	return newValidationError(validationTypeRequest, res)
+}
+
 // getSchemaType returns the schema type for the given command.
 func getSchemaType(command Command) (schema.SchemaType, error) {
 	switch command {
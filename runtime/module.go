@@ -2,14 +2,18 @@ package runtime
 
 import "go.uber.org/fx"
 
-// Module provides a runtime module.
-func Module(config Config) fx.Option {
+// Module provides a runtime module, optionally sending shadow traffic
+// to a second version of the evaluation function.
+func Module(config Config, shadow ShadowConfig) fx.Option {
 	return fx.Module(
 		"runtime",
 
 		// provide runtime config
 		fx.Supply(config),
 
+		// provide shadow config
+		fx.Supply(shadow),
+
 		// provide runtime
 		fx.Provide(NewLifecycleRuntime),
 
@@ -17,3 +21,16 @@ func Module(config Config) fx.Option {
 		fx.Provide(NewRuntimeHandler),
 	)
 }
+
+// FunctionsModule provides a runtime module hosting multiple functions.
+func FunctionsModule(configs FunctionConfigs) fx.Option {
+	return fx.Module(
+		"runtime",
+
+		// provide function configs
+		fx.Supply(configs),
+
+		// provide a runtime and handler per function
+		fx.Provide(NewLifecycleFunctions),
+	)
+}
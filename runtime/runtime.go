@@ -2,6 +2,7 @@ package runtime
 
 import (
 	"context"
+	"fmt"
 
 	"go.uber.org/fx"
 	"go.uber.org/zap"
@@ -15,7 +16,26 @@ type Runtime interface {
 
 	Start(context.Context) error
 
+	// Drain rejects new requests, and waits for in-flight requests
+	// to finish, or aborts them after the drain timeout.
+	Drain(context.Context) error
+
 	Shutdown(context.Context) error
+
+	// QueueDepth returns the number of requests waiting for a worker.
+	QueueDepth() int
+
+	// Stats returns the state of the workers and queue, and the
+	// history of the runtime, e.g. to size the worker pool.
+	Stats() Stats
+
+	// Ready returns true once the runtime is able to handle requests
+	// without waiting for the evaluation function to boot.
+	Ready() bool
+
+	// Capabilities returns the capabilities reported by the evaluation
+	// function during the handshake, or nil if none were reported.
+	Capabilities() *Capabilities
 }
 
 // Params is the runtime-specific params type.
@@ -27,6 +47,61 @@ type Dispatcher = execution.Dispatcher
 // Config is the runtime-specific type for the config.
 type Config = execution.Config
 
+// MessageEncoding is the runtime-specific type for message encodings.
+type MessageEncoding = execution.MessageEncoding
+
+const (
+	JSONEncoding    = execution.JSONEncoding
+	MsgPackEncoding = execution.MsgPackEncoding
+	CBOREncoding    = execution.CBOREncoding
+)
+
+// OverloadedError is the runtime-specific type for rejected requests.
+type OverloadedError = execution.OverloadedError
+
+// CircuitOpenError is the runtime-specific type for requests rejected
+// by the circuit breaker.
+type CircuitOpenError = execution.CircuitOpenError
+
+// ErrCircuitOpen is returned if a request is rejected, as the evaluation
+// function failed repeatedly and the circuit breaker is open.
+var ErrCircuitOpen = execution.ErrCircuitOpen
+
+// ErrDraining is returned if a request is rejected, as the runtime is
+// draining in-flight requests before shutting down.
+var ErrDraining = execution.ErrDraining
+
+// ErrOverloaded is returned if a request is rejected, as all workers are
+// busy and the queue of waiting requests exceeds the configured limits.
+var ErrOverloaded = execution.ErrOverloaded
+
+// ContextWithTenant returns a context that carries the given tenant. If
+// all workers are busy, requests of different tenants are queued fairly.
+var ContextWithTenant = execution.ContextWithTenant
+
+// TenantFromContext returns the tenant in ctx, or an empty string.
+var TenantFromContext = execution.TenantFromContext
+
+// Stats is the runtime-specific type for runtime statistics.
+type Stats = execution.Stats
+
+// Capabilities is the runtime-specific type for function capabilities.
+type Capabilities = execution.Capabilities
+
+// Progress is the runtime-specific type for worker progress.
+type Progress = execution.Progress
+
+// ProgressFunc is the runtime-specific type for progress listeners.
+type ProgressFunc = execution.ProgressFunc
+
+// ContextWithProgressListener returns a context that carries the given
+// progress listener. Progress reported by the evaluation function while
+// handling a request with the context is passed to the listener.
+var ContextWithProgressListener = execution.ContextWithProgressListener
+
+// ProgressListenerFromContext returns the progress listener in ctx, if any.
+var ProgressListenerFromContext = execution.ProgressListenerFromContext
+
 // EvaluationRuntime is a runtime that uses the execution manager.
 type EvaluationRuntime struct {
 	dispatcher Dispatcher
@@ -46,16 +121,54 @@ type RuntimeParams struct {
 	// Config is the config for the underlying runtime manager
 	Config Config
 
+	// Shadow is the config for an optional shadow version of the
+	// evaluation function
+	Shadow ShadowConfig `optional:"true"`
+
 	// Log is the logger to use for the runtime
 	Log *zap.Logger
 }
 
-// NewRuntime creates a new runtime.
+// NewRuntime creates a new runtime. If a shadow version is configured,
+// a sample of the requests is sent to the shadow version as well.
 func NewRuntime(params RuntimeParams) (Runtime, error) {
+	rt, err := newEvaluationRuntime(params.Context, params.Config, params.Log)
+	if err != nil {
+		return nil, err
+	}
+
+	if !params.Shadow.Enabled() {
+		return rt, nil
+	}
+
+	log := params.Log.Named("shadow")
+	config := params.Shadow.runtimeConfig(params.Config)
+
+	shadow, err := newEvaluationRuntime(params.Context, config, log)
+	if err != nil {
+		return nil, fmt.Errorf("error creating shadow runtime: %w", err)
+	}
+
+	log.Info("sending shadow traffic",
+		zap.String("cmd", params.Shadow.Cmd),
+		zap.Float64("sample_rate", params.Shadow.SampleRate),
+	)
+
+	return NewShadowRuntime(
+		params.Context,
+		rt,
+		shadow,
+		params.Shadow,
+		shadow.Stats().Pool.Max*config.Supervisor.Concurrency(),
+		log,
+	), nil
+}
+
+func newEvaluationRuntime(ctx context.Context, config Config, log *zap.Logger) (*EvaluationRuntime, error) {
 	dispatcher, err := execution.NewDispatcher(Params{
-		Context: params.Context,
-		Config:  params.Config,
-		Log:     params.Log,
+		Context: ctx,
+		Config:  config,
+		Log:     log,
 	})
 	if err != nil {
 		return nil, err
@@ -63,7 +176,7 @@ func NewRuntime(params RuntimeParams) (Runtime, error) {
 
 	return &EvaluationRuntime{
 		dispatcher: dispatcher,
-		log:        params.Log.Named("runtime"),
+		log:        log.Named("runtime"),
 	}, nil
 }
 
@@ -96,6 +209,26 @@ func (r *EvaluationRuntime) Handle(
 	return r.dispatcher.Send(ctx, string(message.Command), message.Data)
 }
 
+func (r *EvaluationRuntime) QueueDepth() int {
+	return r.dispatcher.QueueDepth()
+}
+
+func (r *EvaluationRuntime) Stats() Stats {
+	return r.dispatcher.Stats()
+}
+
+func (r *EvaluationRuntime) Ready() bool {
+	return r.dispatcher.Ready()
+}
+
+func (r *EvaluationRuntime) Capabilities() *Capabilities {
+	return r.dispatcher.Capabilities()
+}
+
+func (r *EvaluationRuntime) Drain(ctx context.Context) error {
+	return r.dispatcher.Drain(ctx)
+}
+
 func (r *EvaluationRuntime) Shutdown(ctx context.Context) error {
 	return r.dispatcher.Shutdown(ctx)
 }
@@ -0,0 +1,350 @@
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/rand/v2"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// defaultShadowTimeout is the default time a shadow request may take.
+const defaultShadowTimeout = 30 * time.Second
+
+// ShadowConfig describes a second version of the evaluation function,
+// which handles a sample of the requests in the background. Its results
+// are compared with the results of the primary version, but are never
+// returned to the client.
+type ShadowConfig struct {
+	// Cmd is the command of the shadow version. If empty, shadow
+	// traffic is disabled.
+	Cmd string `conf:"cmd"`
+
+	// Cwd is the working directory of the shadow version. Default is
+	// the working directory of the primary version.
+	Cwd string `conf:"cwd"`
+
+	// Args are the arguments to pass to the shadow command.
+	Args []string `conf:"arg"`
+
+	// Env are additional environment variables for the shadow version,
+	// added to those of the primary version.
+	Env []string `conf:"env"`
+
+	// SampleRate is the fraction of requests sent to the shadow version,
+	// between 0 and 1. Default is 0, which disables shadow traffic.
+	SampleRate float64 `conf:"sample_rate"`
+
+	// Timeout is the time a shadow request may take. Default is 30s.
+	Timeout time.Duration `conf:"timeout"`
+}
+
+// Enabled returns true if a shadow version is configured.
+func (c ShadowConfig) Enabled() bool {
+	return c.Cmd != "" && c.SampleRate > 0
+}
+
+// runtimeConfig returns the runtime config of the shadow version, which
+// inherits the config of the primary version.
+func (c ShadowConfig) runtimeConfig(primary Config) Config {
+	config := primary
+
+	start := &config.Supervisor.StartParams
+	start.Cmd = c.Cmd
+	start.Args = c.Args
+	start.Env = append(start.Env[:len(start.Env):len(start.Env)], c.Env...)
+	if c.Cwd != "" {
+		start.Cwd = c.Cwd
+	}
+
+	// the shadow version is spawned, and must not use the endpoints
+	// of the primary version
+	config.Supervisor.IO.Rpc.Attach.Endpoints = nil
+	config.Supervisor.IO.Rpc.AllocateEndpoint = true
+
+	return config
+}
+
+// ShadowStats describes the comparison of the primary and shadow versions.
+type ShadowStats struct {
+	// SampleRate is the fraction of requests sent to the shadow version.
+	SampleRate float64 `json:"sample_rate"`
+
+	// Sampled is the number of requests sent to the shadow version.
+	Sampled int64 `json:"sampled"`
+
+	// Skipped is the number of sampled requests not sent to the shadow
+	// version, as it was busy with previous requests.
+	Skipped int64 `json:"skipped"`
+
+	// Errors is the number of requests the shadow version failed to handle.
+	Errors int64 `json:"errors"`
+
+	// Compared is the number of requests handled by both versions.
+	Compared int64 `json:"compared"`
+
+	// Agreed is the number of requests both versions agreed on.
+	Agreed int64 `json:"agreed"`
+
+	// CorrectnessMismatches is the number of requests the versions
+	// disagreed on whether the response is correct.
+	CorrectnessMismatches int64 `json:"correctness_mismatches"`
+
+	// FeedbackMismatches is the number of requests the versions
+	// returned different feedback for.
+	FeedbackMismatches int64 `json:"feedback_mismatches"`
+
+	// AgreementRate is the fraction of compared requests both versions
+	// agreed on.
+	AgreementRate float64 `json:"agreement_rate"`
+}
+
+// ShadowReporter is implemented by runtimes sending shadow traffic.
+type ShadowReporter interface {
+	// ShadowStats returns the comparison of the primary and shadow versions.
+	ShadowStats() ShadowStats
+}
+
+// ShadowRuntime is a runtime that handles requests using the primary
+// runtime. The handler of the runtime sends a sample of the requests to
+// a shadow runtime in the background, to compare the results of both.
+type ShadowRuntime struct {
+	Runtime
+
+	shadow     Runtime
+	sampleRate float64
+	timeout    time.Duration
+
+	// ctx is the base context of shadow requests, as they outlive the
+	// requests of the client
+	ctx context.Context
+
+	// slots bounds the number of concurrent shadow requests
+	slots chan struct{}
+
+	// mu guards draining, so no shadow request starts once the runtime
+	// is draining, and the wait group is not added to while waited on
+	mu       sync.Mutex
+	draining bool
+
+	wg sync.WaitGroup
+
+	sampled               atomic.Int64
+	skipped               atomic.Int64
+	errors                atomic.Int64
+	compared              atomic.Int64
+	agreed                atomic.Int64
+	correctnessMismatches atomic.Int64
+	feedbackMismatches    atomic.Int64
+
+	// sample returns true if a request is sent to the shadow runtime
+	sample func() bool
+
+	log *zap.Logger
+}
+
+var _ Runtime = (*ShadowRuntime)(nil)
+var _ ShadowReporter = (*ShadowRuntime)(nil)
+
+// NewShadowRuntime creates a runtime sending shadow traffic from the
+// primary runtime to the shadow runtime. The number of concurrent
+// shadow requests is limited by maxInflight.
+func NewShadowRuntime(
+	ctx context.Context,
+	primary, shadow Runtime,
+	config ShadowConfig,
+	maxInflight int,
+	log *zap.Logger,
+) *ShadowRuntime {
+	timeout := config.Timeout
+	if timeout <= 0 {
+		timeout = defaultShadowTimeout
+	}
+
+	sampleRate := min(max(config.SampleRate, 0), 1)
+
+	return &ShadowRuntime{
+		Runtime:    primary,
+		shadow:     shadow,
+		sampleRate: sampleRate,
+		timeout:    timeout,
+		ctx:        ctx,
+		slots:      make(chan struct{}, max(maxInflight, 1)),
+		sample: func() bool {
+			return rand.Float64() < sampleRate
+		},
+		log: log,
+	}
+}
+
+// Start starts the primary and shadow runtimes. The shadow runtime
+// failing to start does not prevent the primary runtime from serving.
+func (r *ShadowRuntime) Start(ctx context.Context) error {
+	if err := r.Runtime.Start(ctx); err != nil {
+		return err
+	}
+
+	if err := r.shadow.Start(ctx); err != nil {
+		r.log.Error("failed to start shadow", zap.Error(err))
+	}
+
+	return nil
+}
+
+// mirror sends a sample of the client requests to the shadow runtime in
+// the background. handle handles the request using the shadow runtime,
+// including the evaluation of cases, so the final result of both
+// versions is compared.
+func (r *ShadowRuntime) mirror(
+	ctx context.Context,
+	command Command,
+	primary []byte,
+	handle func(context.Context) ([]byte, error),
+) {
+	if command == CommandHealth {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.draining || !r.sample() {
+		return
+	}
+
+	r.sampled.Add(1)
+
+	select {
+	case r.slots <- struct{}{}:
+	default:
+		r.skipped.Add(1)
+		return
+	}
+
+	// shadow requests are queued fairly, but do not report progress
+	shadowCtx := ContextWithTenant(r.ctx, TenantFromContext(ctx))
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		defer func() { <-r.slots }()
+
+		r.compare(shadowCtx, command, primary, handle)
+	}()
+}
+
+// compare handles the request using the shadow runtime, and compares
+// its final result with the final result of the primary runtime.
+func (r *ShadowRuntime) compare(
+	ctx context.Context,
+	command Command,
+	primary []byte,
+	handle func(context.Context) ([]byte, error),
+) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	log := r.log.With(zap.String("command", string(command)))
+
+	shadow, err := handle(ctx)
+	if err != nil {
+		r.errors.Add(1)
+		log.Warn("shadow failed to handle request", zap.Error(err))
+		return
+	}
+
+	r.compared.Add(1)
+
+	primaryResult := shadowResult(primary)
+	shadowResult := shadowResult(shadow)
+
+	correctnessMatch := reflect.DeepEqual(primaryResult["is_correct"], shadowResult["is_correct"])
+	feedbackMatch := reflect.DeepEqual(primaryResult["feedback"], shadowResult["feedback"])
+
+	if !correctnessMatch {
+		r.correctnessMismatches.Add(1)
+	}
+
+	if !feedbackMatch {
+		r.feedbackMismatches.Add(1)
+	}
+
+	if correctnessMatch && feedbackMatch {
+		r.agreed.Add(1)
+		return
+	}
+
+	log.Warn("shadow disagrees with primary",
+		zap.Bool("correctness_match", correctnessMatch),
+		zap.Bool("feedback_match", feedbackMatch),
+		zap.ByteString("primary", primary),
+		zap.ByteString("shadow", shadow),
+		zap.Float64("agreement_rate", r.ShadowStats().AgreementRate),
+	)
+}
+
+// shadowResult returns the result in the response data of a version.
+func shadowResult(data []byte) map[string]any {
+	var response struct {
+		Result map[string]any `json:"result"`
+	}
+
+	_ = json.Unmarshal(data, &response)
+
+	return response.Result
+}
+
+// ShadowStats returns the comparison of the primary and shadow runtimes.
+func (r *ShadowRuntime) ShadowStats() ShadowStats {
+	stats := ShadowStats{
+		SampleRate:            r.sampleRate,
+		Sampled:               r.sampled.Load(),
+		Skipped:               r.skipped.Load(),
+		Errors:                r.errors.Load(),
+		Compared:              r.compared.Load(),
+		Agreed:                r.agreed.Load(),
+		CorrectnessMismatches: r.correctnessMismatches.Load(),
+		FeedbackMismatches:    r.feedbackMismatches.Load(),
+	}
+
+	if stats.Compared > 0 {
+		stats.AgreementRate = float64(stats.Agreed) / float64(stats.Compared)
+	}
+
+	return stats
+}
+
+// Drain drains the primary runtime, and waits for the pending shadow
+// requests, before draining the shadow runtime.
+func (r *ShadowRuntime) Drain(ctx context.Context) error {
+	// requests finishing while the primary runtime drains are not
+	// sent to the shadow runtime
+	r.mu.Lock()
+	r.draining = true
+	r.mu.Unlock()
+
+	err := r.Runtime.Drain(ctx)
+
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+
+	return errors.Join(err, r.shadow.Drain(ctx))
+}
+
+// Shutdown shuts down the primary and shadow runtimes.
+func (r *ShadowRuntime) Shutdown(ctx context.Context) error {
+	return errors.Join(r.Runtime.Shutdown(ctx), r.shadow.Shutdown(ctx))
+}
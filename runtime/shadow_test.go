@@ -0,0 +1,263 @@
+package runtime_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/lambda-feedback/shimmy/runtime"
+)
+
+// fakeRuntime responds to every request using handle.
+type fakeRuntime struct {
+	runtime.Runtime
+
+	handle func(context.Context, runtime.EvaluationRequest) (runtime.EvaluationResponse, error)
+	calls  atomic.Int64
+}
+
+func (r *fakeRuntime) Handle(ctx context.Context, req runtime.EvaluationRequest) (runtime.EvaluationResponse, error) {
+	r.calls.Add(1)
+	return r.handle(ctx, req)
+}
+
+func (r *fakeRuntime) Capabilities() *runtime.Capabilities {
+	return nil
+}
+
+func (r *fakeRuntime) Drain(context.Context) error {
+	return nil
+}
+
+func respond(isCorrect bool, feedback string) func(context.Context, runtime.EvaluationRequest) (runtime.EvaluationResponse, error) {
+	return func(context.Context, runtime.EvaluationRequest) (runtime.EvaluationResponse, error) {
+		return runtime.EvaluationResponse{
+			"command": "eval",
+			"result": map[string]any{
+				"is_correct": isCorrect,
+				"feedback":   feedback,
+			},
+		}, nil
+	}
+}
+
+// newShadowHandler creates a handler for a shadow runtime, sending all
+// requests to the shadow version.
+func newShadowHandler(t *testing.T, primary, shadow runtime.Runtime, maxInflight int) (runtime.Handler, *runtime.ShadowRuntime) {
+	rt := runtime.NewShadowRuntime(
+		context.Background(),
+		primary,
+		shadow,
+		runtime.ShadowConfig{Cmd: "shadow", SampleRate: 1},
+		maxInflight,
+		zap.NewNop(),
+	)
+
+	handler, err := runtime.NewRuntimeHandler(runtime.HandlerParams{
+		Runtime: rt,
+		Log:     setupLogger(t),
+	})
+	require.NoError(t, err)
+
+	return handler, rt
+}
+
+func evalRequest(t *testing.T, body map[string]any) runtime.Request {
+	return createRequest(http.MethodPost, "/eval", createRequestBody(t, body), http.Header{
+		"command": []string{"eval"},
+	})
+}
+
+func TestShadowRuntime_ReturnsPrimaryResponse(t *testing.T) {
+	primary := &fakeRuntime{handle: respond(true, "well done")}
+	shadow := &fakeRuntime{handle: respond(false, "try again")}
+
+	handler, rt := newShadowHandler(t, primary, shadow, 1)
+
+	resp := handler.Handle(context.Background(), evalRequest(t, map[string]any{"response": "x", "answer": "x"}))
+	require.NoError(t, rt.Drain(context.Background()))
+
+	result := parseResponseBody(t, resp)["result"].(map[string]any)
+
+	assert.Equal(t, true, result["is_correct"])
+	assert.Equal(t, int64(1), shadow.calls.Load())
+}
+
+func TestShadowRuntime_ComparesResults(t *testing.T) {
+	primary := &fakeRuntime{handle: respond(true, "well done")}
+
+	// the shadow responds with the feedback sent as the response, and
+	// is correct if the answer is
+	shadow := &fakeRuntime{handle: func(ctx context.Context, req runtime.EvaluationRequest) (runtime.EvaluationResponse, error) {
+		return respond(req.Data["answer"] == "correct", req.Data["response"].(string))(ctx, req)
+	}}
+
+	handler, rt := newShadowHandler(t, primary, shadow, 4)
+
+	for _, body := range []map[string]any{
+		{"answer": "correct", "response": "well done"},
+		{"answer": "correct", "response": "good job"},
+		{"answer": "incorrect", "response": "try again"},
+		{"answer": "correct", "response": "well done"},
+	} {
+		handler.Handle(context.Background(), evalRequest(t, body))
+	}
+
+	require.NoError(t, rt.Drain(context.Background()))
+
+	stats := rt.ShadowStats()
+
+	assert.Equal(t, int64(4), stats.Sampled)
+	assert.Equal(t, int64(4), stats.Compared)
+	assert.Equal(t, int64(2), stats.Agreed)
+	assert.Equal(t, int64(1), stats.CorrectnessMismatches)
+	assert.Equal(t, int64(2), stats.FeedbackMismatches)
+	assert.Equal(t, 0.5, stats.AgreementRate)
+}
+
+func TestShadowRuntime_ComparesFinalResultOfCases(t *testing.T) {
+	// both versions are incorrect with different feedback, which is
+	// replaced by the feedback of the matching case
+	evaluate := func(feedback string) func(context.Context, runtime.EvaluationRequest) (runtime.EvaluationResponse, error) {
+		return func(ctx context.Context, req runtime.EvaluationRequest) (runtime.EvaluationResponse, error) {
+			return respond(req.Data["answer"] == req.Data["response"], feedback)(ctx, req)
+		}
+	}
+
+	primary := &fakeRuntime{handle: evaluate("should be 'hello'.")}
+	shadow := &fakeRuntime{handle: evaluate("expected 'hello'.")}
+
+	handler, rt := newShadowHandler(t, primary, shadow, 1)
+
+	resp := handler.Handle(context.Background(), evalRequest(t, map[string]any{
+		"response": "other",
+		"answer":   "hello",
+		"params": map[string]any{
+			"cases": []map[string]any{
+				{"answer": "nope", "feedback": "not this one."},
+				{"answer": "other", "feedback": "close, but no."},
+			},
+		},
+	}))
+	require.NoError(t, rt.Drain(context.Background()))
+
+	result := parseResponseBody(t, resp)["result"].(map[string]any)
+	assert.Equal(t, "close, but no.", result["feedback"])
+
+	// the request and its cases are evaluated by both versions, but
+	// compared once
+	assert.Equal(t, int64(3), primary.calls.Load())
+	assert.Equal(t, int64(3), shadow.calls.Load())
+
+	stats := rt.ShadowStats()
+
+	assert.Equal(t, int64(1), stats.Sampled)
+	assert.Equal(t, int64(1), stats.Compared)
+	assert.Equal(t, int64(1), stats.Agreed)
+}
+
+func TestShadowRuntime_CountsShadowErrors(t *testing.T) {
+	primary := &fakeRuntime{handle: respond(true, "well done")}
+	shadow := &fakeRuntime{handle: func(context.Context, runtime.EvaluationRequest) (runtime.EvaluationResponse, error) {
+		return nil, errors.New("shadow crashed")
+	}}
+
+	handler, rt := newShadowHandler(t, primary, shadow, 1)
+
+	handler.Handle(context.Background(), evalRequest(t, map[string]any{"response": "x", "answer": "x"}))
+	require.NoError(t, rt.Drain(context.Background()))
+
+	stats := rt.ShadowStats()
+
+	assert.Equal(t, int64(1), stats.Errors)
+	assert.Equal(t, int64(0), stats.Compared)
+}
+
+func TestShadowRuntime_SkipsFailedPrimaryRequests(t *testing.T) {
+	primary := &fakeRuntime{handle: func(context.Context, runtime.EvaluationRequest) (runtime.EvaluationResponse, error) {
+		return nil, runtime.ErrOverloaded
+	}}
+	shadow := &fakeRuntime{handle: respond(true, "well done")}
+
+	handler, rt := newShadowHandler(t, primary, shadow, 1)
+
+	resp := handler.Handle(context.Background(), evalRequest(t, map[string]any{"response": "x", "answer": "x"}))
+	require.NoError(t, rt.Drain(context.Background()))
+
+	assert.NotEqual(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, int64(0), shadow.calls.Load())
+	assert.Equal(t, int64(0), rt.ShadowStats().Sampled)
+}
+
+func TestShadowRuntime_SkipsWhileShadowBusy(t *testing.T) {
+	release := make(chan struct{})
+
+	primary := &fakeRuntime{handle: respond(true, "well done")}
+	shadow := &fakeRuntime{handle: func(ctx context.Context, req runtime.EvaluationRequest) (runtime.EvaluationResponse, error) {
+		<-release
+		return respond(true, "well done")(ctx, req)
+	}}
+
+	handler, rt := newShadowHandler(t, primary, shadow, 1)
+
+	for range 3 {
+		handler.Handle(context.Background(), evalRequest(t, map[string]any{"response": "x", "answer": "x"}))
+	}
+
+	close(release)
+	require.NoError(t, rt.Drain(context.Background()))
+
+	stats := rt.ShadowStats()
+
+	assert.Equal(t, int64(3), stats.Sampled)
+	assert.Equal(t, int64(2), stats.Skipped)
+	assert.Equal(t, int64(1), stats.Agreed)
+}
+
+func TestShadowRuntime_SkipsWhileDraining(t *testing.T) {
+	primary := &fakeRuntime{handle: respond(true, "well done")}
+	shadow := &fakeRuntime{handle: respond(true, "well done")}
+
+	handler, rt := newShadowHandler(t, primary, shadow, 1)
+
+	require.NoError(t, rt.Drain(context.Background()))
+
+	// requests finishing after draining started are not mirrored
+	resp := handler.Handle(context.Background(), evalRequest(t, map[string]any{"response": "x", "answer": "x"}))
+	require.NoError(t, rt.Drain(context.Background()))
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, int64(0), shadow.calls.Load())
+	assert.Equal(t, int64(0), rt.ShadowStats().Sampled)
+}
+
+func TestShadowRuntime_DrainsConcurrentRequests(t *testing.T) {
+	primary := &fakeRuntime{handle: respond(true, "well done")}
+	shadow := &fakeRuntime{handle: respond(true, "well done")}
+
+	handler, rt := newShadowHandler(t, primary, shadow, 4)
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			handler.Handle(context.Background(), evalRequest(t, map[string]any{"response": "x", "answer": "x"}))
+		}()
+	}
+
+	require.NoError(t, rt.Drain(context.Background()))
+	wg.Wait()
+
+	// shadow requests started before draining were waited for
+	stats := rt.ShadowStats()
+	assert.Equal(t, stats.Sampled-stats.Skipped, stats.Compared)
+	assert.Equal(t, stats.Compared, shadow.calls.Load())
+}
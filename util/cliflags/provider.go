@@ -19,6 +19,18 @@ type CLIFlags struct {
 // If a delim is provided, it indicates that the keys are flat
 // and the map needs to be unflatted by delim.
 func Provider(ctx *cli.Context, delim string, cb func(string) string) *CLIFlags {
+	return newProvider(ctx, delim, cb, false)
+}
+
+// SetProvider returns a CLI Provider that only provides the flags
+// that are set, either on the command line or using their env vars.
+// This allows to layer flags over other sources, without overriding
+// them with the default values of the flags.
+func SetProvider(ctx *cli.Context, delim string, cb func(string) string) *CLIFlags {
+	return newProvider(ctx, delim, cb, true)
+}
+
+func newProvider(ctx *cli.Context, delim string, cb func(string) string, onlySet bool) *CLIFlags {
 	// get all visible flags for the root-level app
 	appFlags := ctx.App.VisibleFlags()
 	commandFlags := ctx.Command.VisibleFlags()
@@ -37,6 +49,10 @@ func Provider(ctx *cli.Context, delim string, cb func(string) string) *CLIFlags
 	// iterate over the flags and store the values in the map,
 	// transforming the flag names if a callback is provided
 	for flagName, flag := range flags {
+		if onlySet && !ctx.IsSet(flagName) {
+			continue
+		}
+
 		value, err := getFlagValue(ctx, flag)
 		if err != nil {
 			continue
@@ -91,8 +107,8 @@ func getFlagValue(ctx *cli.Context, flag cli.Flag) (any, error) {
 		return ctx.Float64(name), nil
 	} else if _, ok := flag.(*cli.Float64SliceFlag); ok {
 		return ctx.Float64Slice(name), nil
-	} else if f, ok := flag.(*cli.DurationFlag); ok {
-		return f.Value, nil
+	} else if _, ok := flag.(*cli.DurationFlag); ok {
+		return ctx.Duration(name), nil
 	}
 
 	return nil, fmt.Errorf("unsupported flag type %T", flag)
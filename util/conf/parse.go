@@ -29,6 +29,11 @@ type ParseOptions struct {
 
 	// FileName is the name of the configuration file to load
 	FileName string
+
+	// Inherit maps the key of a map of named entries, to the key of the
+	// defaults each entry inherits. Values set on an entry take
+	// precedence over the inherited values.
+	Inherit map[string]string
 }
 
 func Parse[C any](opt ParseOptions) (C, error) {
@@ -40,6 +45,25 @@ func Parse[C any](opt ParseOptions) (C, error) {
 
 	var config C
 
+	transformFlag := func(s string) string {
+		if opt.CliMap != nil {
+			if name, ok := opt.CliMap[s]; ok {
+				return name
+			}
+		}
+
+		// replace - with _
+		return strings.ReplaceAll(strings.ToLower(s), "-", "_")
+	}
+
+	// the default values of the flags have the lowest precedence,
+	// so they don't override the values in the configuration file
+	if opt.Cli != nil {
+		if err := k.Load(cliflags.Provider(opt.Cli, ".", transformFlag), nil); err != nil {
+			return config, fmt.Errorf("error parsing cli flags: %w", err)
+		}
+	}
+
 	if opt.FileName != "" {
 		if err := k.Load(file.Provider(opt.FileName), json.Parser()); err != nil {
 			return config, fmt.Errorf("error parsing file '%s': %w", opt.FileName, err)
@@ -54,20 +78,16 @@ func Parse[C any](opt ParseOptions) (C, error) {
 		return config, fmt.Errorf("error parsing env vars: %w", err)
 	}
 
+	// flags that are set take precedence over all other sources
 	if opt.Cli != nil {
-		transformFlag := func(s string) string {
-			if opt.CliMap != nil {
-				if name, ok := opt.CliMap[s]; ok {
-					return name
-				}
-			}
-
-			// replace - with _
-			return strings.ReplaceAll(strings.ToLower(s), "-", "_")
+		if err := k.Load(cliflags.SetProvider(opt.Cli, ".", transformFlag), nil); err != nil {
+			return config, fmt.Errorf("error parsing cli flags: %w", err)
 		}
+	}
 
-		if err := k.Load(cliflags.Provider(opt.Cli, ".", transformFlag), nil); err != nil {
-			return config, fmt.Errorf("error parsing cli flags: %w", err)
+	for key, defaults := range opt.Inherit {
+		if err := inherit(k, key, defaults); err != nil {
+			return config, fmt.Errorf("error inheriting '%s' from '%s': %w", key, defaults, err)
 		}
 	}
 
@@ -90,3 +110,24 @@ func transformEnv(s, prefix string) string {
 	// create final string
 	return strings.Join(parts, ".")
 }
+
+// inherit merges each entry in the map at key onto a copy of the values
+// at defaults, so the entry inherits all values it does not set itself.
+func inherit(k *koanf.Koanf, key, defaults string) error {
+	for _, name := range k.MapKeys(key) {
+		path := key + "." + name
+
+		entry := k.Cut(defaults)
+		if err := entry.Merge(k.Cut(path)); err != nil {
+			return err
+		}
+
+		k.Delete(path)
+
+		if err := k.MergeAt(entry, path); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,113 @@
+package conf
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+)
+
+type testEntry struct {
+	Cmd  string   `conf:"cmd"`
+	Args []string `conf:"arg"`
+	Max  int      `conf:"max"`
+}
+
+type testConfig struct {
+	Defaults testEntry            `conf:"defaults"`
+	Entries  map[string]testEntry `conf:"entries"`
+}
+
+func TestParse_Inherit(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(file, []byte(`{
+		"defaults": { "cmd": "python", "arg": ["main.py"], "max": 4 },
+		"entries": {
+			"a": { "arg": ["a.py"] },
+			"b": { "cmd": "node", "max": 1 }
+		}
+	}`), 0o600))
+
+	config, err := Parse[testConfig](ParseOptions{
+		FileName:  file,
+		EnvPrefix: "SHIMMY_CONF_TEST_",
+		Inherit:   map[string]string{"entries": "defaults"},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, testEntry{Cmd: "python", Args: []string{"main.py"}, Max: 4}, config.Defaults)
+	assert.Equal(t, map[string]testEntry{
+		"a": {Cmd: "python", Args: []string{"a.py"}, Max: 4},
+		"b": {Cmd: "node", Args: []string{"main.py"}, Max: 1},
+	}, config.Entries)
+}
+
+type testFlagConfig struct {
+	Key     string        `conf:"key"`
+	Max     int           `conf:"max"`
+	Timeout time.Duration `conf:"timeout"`
+	Cmd     string        `conf:"cmd"`
+}
+
+func TestParse_FileTakesPrecedenceOverFlagDefaults(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(file, []byte(`{
+		"key": "secret", "max": 4, "timeout": "5s", "cmd": "python"
+	}`), 0o600))
+
+	var config testFlagConfig
+
+	app := &cli.App{
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "auth-key"},
+			&cli.IntFlag{Name: "max"},
+			&cli.DurationFlag{Name: "timeout", Value: time.Second},
+			&cli.StringFlag{Name: "cmd", Value: "node"},
+		},
+		Action: func(ctx *cli.Context) (err error) {
+			config, err = Parse[testFlagConfig](ParseOptions{
+				Cli:       ctx,
+				CliMap:    map[string]string{"auth-key": "key"},
+				EnvPrefix: "SHIMMY_CONF_TEST_",
+				FileName:  file,
+			})
+			return err
+		},
+	}
+
+	// flags that are set override the file, unset flags don't
+	require.NoError(t, app.Run([]string{"shimmy", "--cmd", "ruby"}))
+
+	assert.Equal(t, testFlagConfig{
+		Key:     "secret",
+		Max:     4,
+		Timeout: 5 * time.Second,
+		Cmd:     "ruby",
+	}, config)
+}
+
+func TestParse_FlagDefaultsApplyWithoutFile(t *testing.T) {
+	var config testFlagConfig
+
+	app := &cli.App{
+		Flags: []cli.Flag{
+			&cli.DurationFlag{Name: "timeout", Value: time.Second},
+			&cli.StringFlag{Name: "cmd", Value: "node"},
+		},
+		Action: func(ctx *cli.Context) (err error) {
+			config, err = Parse[testFlagConfig](ParseOptions{
+				Cli:       ctx,
+				EnvPrefix: "SHIMMY_CONF_TEST_",
+			})
+			return err
+		},
+	}
+
+	require.NoError(t, app.Run([]string{"shimmy", "--timeout", "2s"}))
+
+	assert.Equal(t, testFlagConfig{Timeout: 2 * time.Second, Cmd: "node"}, config)
+}
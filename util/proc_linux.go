@@ -0,0 +1,29 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ProcessRSS returns the resident set size of the process in bytes.
+func ProcessRSS(pid int) (uint64, error) {
+	statm, err := os.ReadFile(fmt.Sprintf("/proc/%d/statm", pid))
+	if err != nil {
+		return 0, err
+	}
+
+	// statm holds the sizes in pages, the second field being the rss
+	fields := strings.Fields(string(statm))
+	if len(fields) < 2 {
+		return 0, fmt.Errorf("unexpected statm format: %q", statm)
+	}
+
+	pages, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("error parsing rss: %w", err)
+	}
+
+	return pages * uint64(os.Getpagesize()), nil
+}
@@ -0,0 +1,23 @@
+package util_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/lambda-feedback/shimmy/util"
+)
+
+func TestProcessRSS(t *testing.T) {
+	rss, err := util.ProcessRSS(os.Getpid())
+	require.NoError(t, err)
+
+	assert.Greater(t, rss, uint64(0))
+}
+
+func TestProcessRSS_UnknownProcess(t *testing.T) {
+	_, err := util.ProcessRSS(-1)
+	assert.Error(t, err)
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package util
+
+import "errors"
+
+// ProcessRSS returns the resident set size of the process in bytes.
+// It is only supported on linux.
+func ProcessRSS(int) (uint64, error) {
+	return 0, errors.ErrUnsupported
+}